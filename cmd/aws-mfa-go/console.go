@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/jlis/aws-mfa-go/internal/app"
+
+	"github.com/spf13/cobra"
+)
+
+func newConsoleCmd(global *globalFlags) *cobra.Command {
+	var (
+		destination   string
+		printURL      bool
+		federationURL string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "console",
+		Short: "Open the AWS Management Console with a profile's short-term role or federation credentials",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deps := app.DefaultDeps()
+			deps.Stdout = cmd.OutOrStdout()
+			deps.Stderr = cmd.ErrOrStderr()
+
+			return app.Console(cmd.Context(), app.ConsoleInputs{
+				Inputs:               global.inputs(cmd.Flags()),
+				Destination:          destination,
+				Print:                printURL,
+				FederationURL:        federationURL,
+				FederationURLChanged: flagChanged(cmd.Flags(), "federation-url"),
+			}, deps)
+		},
+	}
+
+	cmd.Flags().StringVar(&destination, "destination", "", "Console path (for example /ec2/home) or https URL to open after sign-in")
+	cmd.Flags().BoolVar(&printURL, "print", false, "Print the sign-in URL instead of opening a browser")
+	cmd.Flags().StringVar(&federationURL, "federation-url", "", "Federation endpoint (env: MFA_FEDERATION_URL, or federation_url in long-term section, default: the partition's signin endpoint)")
+
+	return cmd
+}
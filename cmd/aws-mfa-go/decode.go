@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+
+	"github.com/jlis/aws-mfa-go/internal/app"
+
+	"github.com/spf13/cobra"
+)
+
+func newDecodeAuthMessageCmd(global *globalFlags) *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "decode-auth-message [encoded-message|-]",
+		Short: "Decode an \"encoded authorization failure message\" with a profile's short-term credentials",
+		Long: "Decode an \"encoded authorization failure message\" with STS DecodeAuthorizationMessage, using the\n" +
+			"short-term credentials of the profile (which need sts:DecodeAuthorizationMessage).\n" +
+			"The message is read from stdin when omitted or -. A whole error line can be passed as is.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deps := app.DefaultDeps()
+			deps.Stdout = cmd.OutOrStdout()
+			deps.Stderr = cmd.ErrOrStderr()
+			deps.Stdin = os.Stdin
+
+			in := app.DecodeInputs{
+				Inputs: global.inputs(cmd.Flags()),
+				Region: global.region,
+				JSON:   asJSON,
+			}
+			if len(args) == 1 {
+				in.Message = args[0]
+			}
+			return app.DecodeAuthMessage(cmd.Context(), in, deps)
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print only the decoded JSON document")
+
+	return cmd
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/jlis/aws-mfa-go/internal/app"
+
+	"github.com/spf13/cobra"
+)
+
+func newKeysCmd(global *globalFlags) *cobra.Command {
+	var (
+		maxAgeDays int
+		asJSON     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Inspect the long-term access keys in the credentials file",
+		Args:  cobra.NoArgs,
+	}
+
+	audit := &cobra.Command{
+		Use:   "audit",
+		Short: "Report the age and last use of every long-term key, and keys that need attention",
+		Long: "Report the age and last use of the access key of every long-term section (or only --profile's),\n" +
+			"warning about keys older than --max-age-days, second active keys, and attached\n" +
+			"AWSCompromisedKeyQuarantine policies.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deps := app.DefaultDeps()
+			deps.Stdout = cmd.OutOrStdout()
+			deps.Stderr = cmd.ErrOrStderr()
+
+			return app.KeysAudit(cmd.Context(), app.KeysAuditInputs{
+				Inputs:            global.inputs(cmd.Flags()),
+				Region:            global.region,
+				MaxAgeDays:        maxAgeDays,
+				MaxAgeDaysChanged: flagChanged(cmd.Flags(), "max-age-days"),
+				JSON:              asJSON,
+			}, deps)
+		},
+	}
+	audit.Flags().IntVar(&maxAgeDays, "max-age-days", 90, "Warn about keys older than this many days (env: MFA_KEY_MAX_AGE_DAYS)")
+	audit.Flags().BoolVar(&asJSON, "json", false, "Print the result as JSON")
+
+	cmd.AddCommand(audit)
+	return cmd
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/jlis/aws-mfa-go/internal/app"
+
+	"github.com/spf13/cobra"
+)
+
+func newMFACmd(global *globalFlags) *cobra.Command {
+	var (
+		device      string
+		asJSON      bool
+		yes         bool
+		deviceName  string
+		qrCodeFile  string
+		seedCommand string
+	)
+
+	// run builds the inputs shared by the mfa subcommands and calls fn.
+	run := func(fn func(context.Context, app.MFAInputs, app.Deps) error) func(*cobra.Command, []string) error {
+		return func(cmd *cobra.Command, args []string) error {
+			deps := app.DefaultDeps()
+			deps.Stdout = cmd.OutOrStdout()
+			deps.Stderr = cmd.ErrOrStderr()
+			deps.Stdin = os.Stdin
+
+			in := app.MFAInputs{
+				Inputs: global.inputs(cmd.Flags()),
+				Region: global.region,
+				JSON:   asJSON,
+				Yes:    yes,
+
+				DeviceName:  deviceName,
+				QRCodeFile:  qrCodeFile,
+				SeedCommand: seedCommand,
+			}
+			in.Device = device
+			in.DeviceChanged = flagChanged(cmd.Flags(), "device")
+			return fn(cmd.Context(), in, deps)
+		}
+	}
+
+	cmd := &cobra.Command{
+		Use:   "mfa",
+		Short: "Manage the MFA devices of the IAM user a profile's long-term keys belong to",
+		Args:  cobra.NoArgs,
+	}
+	cmd.PersistentFlags().StringVar(&device, "device", "", "MFA device ARN/serial (env: MFA_DEVICE, or aws_mfa_device in long-term section, default: the only device, else a choice)")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the MFA devices with their enable dates",
+		Args:  cobra.NoArgs,
+		RunE:  run(app.MFAList),
+	}
+	list.Flags().BoolVar(&asJSON, "json", false, "Print the result as JSON")
+
+	resync := &cobra.Command{
+		Use:   "resync",
+		Short: "Resynchronize a drifted MFA device with two consecutive codes",
+		Args:  cobra.NoArgs,
+		RunE:  run(app.MFAResync),
+	}
+
+	deactivate := &cobra.Command{
+		Use:   "deactivate",
+		Short: "Deactivate an MFA device, after confirmation",
+		Args:  cobra.NoArgs,
+		RunE:  run(app.MFADeactivate),
+	}
+	deactivate.Flags().BoolVar(&yes, "yes", false, "Do not ask for confirmation")
+
+	enroll := &cobra.Command{
+		Use:   "enroll",
+		Short: "Create and enable a virtual MFA device, and save it as aws_mfa_device",
+		Args:  cobra.NoArgs,
+		RunE:  run(app.MFAEnroll),
+	}
+	enroll.Flags().StringVar(&deviceName, "name", "", "Name of the virtual MFA device (default: the IAM user name)")
+	enroll.Flags().StringVar(&qrCodeFile, "qr-png", "", "Also save the QR code as a PNG file (it contains the seed)")
+	enroll.Flags().StringVar(&seedCommand, "seed-command", "", "Command that receives the base32 seed on stdin to store it, for example 'pass insert -m aws/mfa'")
+
+	cmd.AddCommand(list, resync, deactivate, enroll)
+	return cmd
+}
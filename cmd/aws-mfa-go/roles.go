@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+
+	"github.com/jlis/aws-mfa-go/internal/app"
+
+	"github.com/spf13/cobra"
+)
+
+func newRolesCmd(global *globalFlags) *cobra.Command {
+	var (
+		target     string
+		configFile string
+		asJSON     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "roles",
+		Short: "Find the roles a profile's IAM user may assume",
+		Args:  cobra.NoArgs,
+	}
+
+	discover := &cobra.Command{
+		Use:   "discover",
+		Short: "List the roles the IAM user's policies allow to assume, and generate profiles for them",
+		Long: "Read the attached, inline and group policies of the profile's IAM user with its long-term keys,\n" +
+			"list the sts:AssumeRole resources, and offer to generate a profile for each role: in the AWS\n" +
+			"config file (role_arn and source_profile), or as aws-mfa-go profiles in the credentials file\n" +
+			"(assume_role and source_profile). Wildcard resources are listed for completion by hand.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deps := app.DefaultDeps()
+			deps.Stdout = cmd.OutOrStdout()
+			deps.Stderr = cmd.ErrOrStderr()
+			deps.Stdin = os.Stdin
+
+			return app.RolesDiscover(cmd.Context(), app.RolesDiscoverInputs{
+				Inputs:     global.inputs(cmd.Flags()),
+				Region:     global.region,
+				Target:     target,
+				ConfigFile: configFile,
+				JSON:       asJSON,
+			}, deps)
+		},
+	}
+	discover.Flags().StringVar(&target, "target", "", "Generate profiles without asking: config (AWS config file), tool (credentials file) or both")
+	discover.Flags().StringVar(&configFile, "config-file", "", "AWS config file for --target config or both (env: AWS_CONFIG_FILE, default: ~/.aws/config)")
+	discover.Flags().BoolVar(&asJSON, "json", false, "Print the roles as JSON (profiles are only generated with --target)")
+
+	cmd.AddCommand(discover)
+	return cmd
+}
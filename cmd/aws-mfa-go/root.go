@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/jlis/aws-mfa-go/internal/app"
 
@@ -13,22 +17,70 @@ import (
 // Example: go build -ldflags "-X main.version=v0.1.0" ./cmd/aws-mfa-go
 var version = "dev"
 
-// Execute runs the root command.
+// runApp is app.Run; tests replace it to inspect the parsed inputs.
+var runApp = app.Run
+
+// Execute runs the root command and exits with the code documented in the
+// README. Ctrl-C cancels the command's context.
 func Execute() {
-	rootCmd := newRootCmd()
-	cobra.CheckErr(rootCmd.Execute())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := newRootCmd().ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		os.Exit(app.ExitCode(err))
+	}
+}
+
+// globalFlags are shared by the root command and its subcommands.
+type globalFlags struct {
+	profile         string
+	longTermSuffix  string
+	shortTermSuffix string
+	credentialsFile string
+	stsEndpointURL  string
+	region          string
+	timeout         time.Duration
+}
+
+// inputs returns the app.Inputs fields backed by global flags.
+func (g *globalFlags) inputs(flags *pflag.FlagSet) app.Inputs {
+	return app.Inputs{
+		Profile:         g.profile,
+		ProfileChanged:  flagChanged(flags, "profile"),
+		LongTermSuffix:  g.longTermSuffix,
+		ShortTermSuffix: g.shortTermSuffix,
+		CredentialsFile: g.credentialsFile,
+		Timeout:         g.timeout,
+
+		STSEndpointURL:        g.stsEndpointURL,
+		STSEndpointURLChanged: flagChanged(flags, "sts-endpoint-url"),
+	}
 }
 
 func newRootCmd() *cobra.Command {
 	var (
-		profile         string
+		global          globalFlags
 		device          string
-		durationSeconds int
+		duration        string
+		sessionDuration string
+		clampDuration   bool
 		token           string
+		assumeRole      string
+		roleChain       string
+		roleSessionName string
+		externalID      string
+		sessionTags     []string
+		transitiveKeys  []string
+		sourceIdentity  string
+		policyFile      string
+		policyARNs      []string
+		mode            string
+		federatedUser   string
+		webIdentityFile string
+		samlFile        string
+		samlHelper      string
 		force           bool
-		longTermSuffix  string
-		shortTermSuffix string
-		credentialsFile string
+		skipVerify      bool
 	)
 
 	cmd := &cobra.Command{
@@ -43,36 +95,96 @@ func newRootCmd() *cobra.Command {
 			deps.Stderr = cmd.ErrOrStderr()
 			deps.Stdin = os.Stdin
 
-			return app.Run(cmd.Context(), app.RunInputs{
-				Inputs: app.Inputs{
-					Profile:                profile,
-					ProfileChanged:         flagChanged(flags, "profile"),
-					Device:                 device,
-					DeviceChanged:          flagChanged(flags, "device"),
-					DurationSeconds:        durationSeconds,
-					DurationSecondsChanged: flagChanged(flags, "duration"),
-					Token:                  token,
-					TokenChanged:           flagChanged(flags, "token"),
-					Force:                  force,
-					LongTermSuffix:         longTermSuffix,
-					ShortTermSuffix:        shortTermSuffix,
-					CredentialsFile:        credentialsFile,
-				},
-			}, deps)
+			in := global.inputs(flags)
+			in.Device = device
+			in.DeviceChanged = flagChanged(flags, "device")
+			in.Duration = duration
+			in.DurationChanged = flagChanged(flags, "duration")
+			in.SessionDuration = sessionDuration
+			in.SessionDurationChanged = flagChanged(flags, "session-duration")
+			in.ClampDuration = clampDuration
+			in.ClampDurationChanged = flagChanged(flags, "clamp-duration")
+			in.Token = token
+			in.TokenChanged = flagChanged(flags, "token")
+			in.AssumeRole = assumeRole
+			in.AssumeRoleChanged = flagChanged(flags, "assume-role")
+			in.RoleChain = roleChain
+			in.RoleChainChanged = flagChanged(flags, "role-chain")
+			in.RoleSessionName = roleSessionName
+			in.RoleSessionNameChanged = flagChanged(flags, "role-session-name")
+			in.ExternalID = externalID
+			in.ExternalIDChanged = flagChanged(flags, "external-id")
+			in.SessionTags = sessionTags
+			in.SessionTagsChanged = flagChanged(flags, "tag")
+			in.TransitiveTagKeys = transitiveKeys
+			in.TransitiveTagKeysChanged = flagChanged(flags, "transitive-tag-key")
+			in.SourceIdentity = sourceIdentity
+			in.SourceIdentityChanged = flagChanged(flags, "source-identity")
+			in.PolicyFile = policyFile
+			in.PolicyFileChanged = flagChanged(flags, "policy-file")
+			in.PolicyARNs = policyARNs
+			in.PolicyARNsChanged = flagChanged(flags, "policy-arn")
+			in.Mode = mode
+			in.ModeChanged = flagChanged(flags, "mode")
+			in.FederatedUserName = federatedUser
+			in.FederatedUserNameChanged = flagChanged(flags, "federated-user-name")
+			in.WebIdentityTokenFile = webIdentityFile
+			in.WebIdentityTokenFileChanged = flagChanged(flags, "web-identity-token-file")
+			in.SAMLAssertionFile = samlFile
+			in.SAMLAssertionFileChanged = flagChanged(flags, "saml-assertion-file")
+			in.SAMLHelper = samlHelper
+			in.SAMLHelperChanged = flagChanged(flags, "saml-helper")
+			in.Force = force
+			in.SkipVerify = skipVerify
+
+			return runApp(cmd.Context(), app.RunInputs{Inputs: in, Region: global.region}, deps)
 		},
 	}
 
 	cmd.Version = version
 	cmd.SetVersionTemplate("{{.Version}}\n")
 
-	cmd.Flags().StringVar(&profile, "profile", "", "AWS profile name (env: AWS_PROFILE, default: default)")
+	cmd.PersistentFlags().StringVar(&global.profile, "profile", "", "AWS profile name (env: AWS_PROFILE, default: default)")
+	cmd.PersistentFlags().StringVar(&global.longTermSuffix, "long-term-suffix", "long-term", "Suffix for long-term section (<profile>-<suffix>). Use 'none' for <profile>")
+	cmd.PersistentFlags().StringVar(&global.shortTermSuffix, "short-term-suffix", "none", "Suffix for short-term section (<profile>-<suffix>). Use 'none' for <profile>")
+	cmd.PersistentFlags().StringVar(&global.credentialsFile, "credentials-file", "~/.aws/credentials", "Path to shared credentials file")
+	cmd.PersistentFlags().DurationVar(&global.timeout, "timeout", 30*time.Second, "Timeout for each STS call, including retries (0 disables it)")
+	cmd.PersistentFlags().StringVar(&global.region, "region", "", "AWS region for STS calls (env: AWS_REGION or AWS_DEFAULT_REGION, or region in long-term section, default: us-east-1 or the MFA device's partition default)")
+	cmd.PersistentFlags().StringVar(&global.stsEndpointURL, "sts-endpoint-url", "", "Custom STS endpoint URL (env: AWS_ENDPOINT_URL_STS or AWS_ENDPOINT_URL, or sts_endpoint_url in long-term section)")
+
 	cmd.Flags().StringVar(&device, "device", "", "MFA device ARN/serial (env: MFA_DEVICE, or aws_mfa_device in long-term section)")
-	cmd.Flags().IntVar(&durationSeconds, "duration", 0, "STS session duration seconds (env: MFA_STS_DURATION, default: 43200)")
+	cmd.Flags().StringVar(&duration, "duration", "", "STS session duration, in seconds or like 8h (env: MFA_STS_DURATION, default: 43200, or 3600 with --assume-role)")
+	cmd.Flags().StringVar(&sessionDuration, "session-duration", "", "Duration of the cached MFA session roles are assumed from, in seconds or like 12h (env: MFA_SESSION_DURATION, or mfa_session_duration in long-term section, default: 43200)")
+	cmd.Flags().BoolVar(&clampDuration, "clamp-duration", false, "Adjust durations outside the STS or role limits instead of failing (env: MFA_CLAMP_DURATION, or clamp_duration in long-term section)")
 	cmd.Flags().StringVar(&token, "token", "", "MFA token code (6 digits). If omitted, prompts on stdin")
+	cmd.Flags().StringVar(&assumeRole, "assume-role", "", "Role ARN to assume with MFA (env: MFA_ASSUME_ROLE, or assume_role in long-term section)")
+	cmd.Flags().StringVar(&roleChain, "role-chain", "", "Comma-separated role ARNs to assume in order, each from the previous one's credentials (env: MFA_ROLE_CHAIN, or role_chain in long-term section)")
+	cmd.Flags().StringVar(&roleSessionName, "role-session-name", "", "Role session name (env: MFA_ROLE_SESSION_NAME, or role_session_name in long-term section, default: local username)")
+	cmd.Flags().StringVar(&externalID, "external-id", "", "External ID for the role trust policy (env: MFA_EXTERNAL_ID, or external_id in long-term section)")
+	cmd.Flags().StringArrayVar(&sessionTags, "tag", nil, "Session tag Key=Value for the role session, repeatable; values may use {{username}} or {{git_email}} (env: MFA_SESSION_TAGS, or session_tags in long-term section)")
+	cmd.Flags().StringSliceVar(&transitiveKeys, "transitive-tag-key", nil, "Session tag key that persists through role chaining, repeatable (env: MFA_TRANSITIVE_TAG_KEYS, or transitive_tag_keys in long-term section)")
+	cmd.Flags().StringVar(&sourceIdentity, "source-identity", "", "SourceIdentity for the role session; may use {{username}} or {{git_email}} (env: MFA_SOURCE_IDENTITY, or source_identity in long-term section)")
+	cmd.Flags().StringVar(&policyFile, "policy-file", "", "JSON session policy document that scopes the credentials down (env: MFA_POLICY_FILE, or policy_file in long-term section)")
+	cmd.Flags().StringSliceVar(&policyARNs, "policy-arn", nil, "Managed policy ARN that scopes the credentials down, repeatable (env: MFA_POLICY_ARNS, or policy_arns in long-term section)")
+	cmd.Flags().StringVar(&mode, "mode", "", "How to obtain credentials: session, role, federation, web-identity, oidc, saml, sso or roles-anywhere (env: MFA_MODE, or mode in long-term section, default: role when a role is configured, else session)")
+	cmd.Flags().StringVar(&federatedUser, "federated-user-name", "", "Federated user name in federation mode (env: MFA_FEDERATED_USER_NAME, or federated_user_name in long-term section, default: local username)")
+	cmd.Flags().StringVar(&webIdentityFile, "web-identity-token-file", "", "OIDC token file to exchange for --assume-role credentials, selects web-identity mode (env: AWS_WEB_IDENTITY_TOKEN_FILE in that mode, or web_identity_token_file in long-term section)")
+	cmd.Flags().StringVar(&samlFile, "saml-assertion-file", "", "File with a base64 SAMLResponse to exchange for role credentials, - for stdin; selects saml mode (env: MFA_SAML_ASSERTION_FILE, or saml_assertion_file in long-term section)")
+	cmd.Flags().StringVar(&samlHelper, "saml-helper", "", "Command printing a base64 SAMLResponse to exchange for role credentials; selects saml mode (env: MFA_SAML_HELPER, or saml_helper in long-term section)")
 	cmd.Flags().BoolVar(&force, "force", false, "Refresh credentials even if still valid")
-	cmd.Flags().StringVar(&longTermSuffix, "long-term-suffix", "long-term", "Suffix for long-term section (<profile>-<suffix>). Use 'none' for <profile>")
-	cmd.Flags().StringVar(&shortTermSuffix, "short-term-suffix", "none", "Suffix for short-term section (<profile>-<suffix>). Use 'none' for <profile>")
-	cmd.Flags().StringVar(&credentialsFile, "credentials-file", "~/.aws/credentials", "Path to shared credentials file")
+	cmd.Flags().BoolVar(&skipVerify, "skip-verify", false, "Skip checking new credentials with STS GetCallerIdentity")
+
+	cmd.AddCommand(newWhoamiCmd(&global))
+	cmd.AddCommand(newConsoleCmd(&global))
+	cmd.AddCommand(newDecodeAuthMessageCmd(&global))
+	cmd.AddCommand(newMFACmd(&global))
+	cmd.AddCommand(newRotateKeysCmd(&global))
+	cmd.AddCommand(newKeysCmd(&global))
+	cmd.AddCommand(newRolesCmd(&global))
+
+	cmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return &app.ConfigError{Err: err}
+	})
 
 	cmd.SetOut(os.Stdout)
 	cmd.SetErr(os.Stderr)
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/jlis/aws-mfa-go/internal/app"
+)
+
+// parseRootInputs runs the root command with args and returns the inputs it
+// passes to app.Run.
+func parseRootInputs(t *testing.T, args ...string) app.RunInputs {
+	t.Helper()
+	var got app.RunInputs
+	called := false
+	orig := runApp
+	runApp = func(ctx context.Context, in app.RunInputs, deps app.Deps) error {
+		got = in
+		called = true
+		return nil
+	}
+	t.Cleanup(func() { runApp = orig })
+
+	cmd := newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !called {
+		t.Fatal("expected app.Run to be called")
+	}
+	return got
+}
+
+func TestRootPassesRoleChain(t *testing.T) {
+	in := parseRootInputs(t, "--role-chain", "a,b")
+	if in.RoleChain != "a,b" || !in.RoleChainChanged {
+		t.Fatalf("expected role chain %q set, got %q (changed %v)", "a,b", in.RoleChain, in.RoleChainChanged)
+	}
+
+	in = parseRootInputs(t)
+	if in.RoleChainChanged {
+		t.Fatal("expected the role chain to be unset without the flag")
+	}
+}
+
+func TestRootPassesSessionTagFlags(t *testing.T) {
+	in := parseRootInputs(t,
+		"--tag", "team=platform", "--tag", "email={{git_email}}",
+		"--transitive-tag-key", "team",
+		"--source-identity", "{{username}}",
+	)
+	if len(in.SessionTags) != 2 || in.SessionTags[1] != "email={{git_email}}" || !in.SessionTagsChanged {
+		t.Fatalf("expected two session tags, got %q (changed %v)", in.SessionTags, in.SessionTagsChanged)
+	}
+	if len(in.TransitiveTagKeys) != 1 || in.TransitiveTagKeys[0] != "team" || !in.TransitiveTagKeysChanged {
+		t.Fatalf("expected transitive tag key team, got %q (changed %v)", in.TransitiveTagKeys, in.TransitiveTagKeysChanged)
+	}
+	if in.SourceIdentity != "{{username}}" || !in.SourceIdentityChanged {
+		t.Fatalf("expected source identity {{username}}, got %q (changed %v)", in.SourceIdentity, in.SourceIdentityChanged)
+	}
+}
+
+func TestRootPassesSessionPolicyFlags(t *testing.T) {
+	in := parseRootInputs(t,
+		"--policy-file", "readonly.json",
+		"--policy-arn", "arn:aws:iam::aws:policy/ReadOnlyAccess", "--policy-arn", "arn:aws:iam::aws:policy/job-function/ViewOnlyAccess",
+	)
+	if in.PolicyFile != "readonly.json" || !in.PolicyFileChanged {
+		t.Fatalf("expected policy file readonly.json, got %q (changed %v)", in.PolicyFile, in.PolicyFileChanged)
+	}
+	if len(in.PolicyARNs) != 2 || in.PolicyARNs[0] != "arn:aws:iam::aws:policy/ReadOnlyAccess" || !in.PolicyARNsChanged {
+		t.Fatalf("expected two policy ARNs, got %q (changed %v)", in.PolicyARNs, in.PolicyARNsChanged)
+	}
+}
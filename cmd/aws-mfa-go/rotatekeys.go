@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/jlis/aws-mfa-go/internal/app"
+
+	"github.com/spf13/cobra"
+)
+
+func newRotateKeysCmd(global *globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rotate-keys",
+		Short: "Replace a profile's long-term access key with a new one, deleting the old key",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deps := app.DefaultDeps()
+			deps.Stdout = cmd.OutOrStdout()
+			deps.Stderr = cmd.ErrOrStderr()
+
+			return app.RotateKeys(cmd.Context(), app.RotateKeysInputs{
+				Inputs: global.inputs(cmd.Flags()),
+				Region: global.region,
+			}, deps)
+		},
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/jlis/aws-mfa-go/internal/app"
+
+	"github.com/spf13/cobra"
+)
+
+func newWhoamiCmd(global *globalFlags) *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "whoami",
+		Short: "Show the account, ARN and remaining lifetime of a profile's short-term credentials",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			deps := app.DefaultDeps()
+			deps.Stdout = cmd.OutOrStdout()
+			deps.Stderr = cmd.ErrOrStderr()
+
+			return app.Whoami(cmd.Context(), app.WhoamiInputs{
+				Inputs: global.inputs(cmd.Flags()),
+				Region: global.region,
+				JSON:   asJSON,
+			}, deps)
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the result as JSON")
+
+	return cmd
+}
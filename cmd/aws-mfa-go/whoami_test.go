@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWhoamiUsesGlobalFlags(t *testing.T) {
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs([]string{
+		"whoami",
+		"--profile", "prod",
+		"--short-term-suffix", "admin",
+		"--credentials-file", filepath.Join(t.TempDir(), "credentials"),
+	})
+
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "[prod-admin]") {
+		t.Fatalf("expected missing section error for [prod-admin], got %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+package app
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+// openBrowser opens url in the default browser.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url) //nolint:gosec // G204: url is built by us
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url) //nolint:gosec // G204: url is built by us
+	default:
+		cmd = exec.Command("xdg-open", url) //nolint:gosec // G204: url is built by us
+	}
+	return cmd.Start()
+}
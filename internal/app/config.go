@@ -1,14 +1,21 @@
 package app
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
+	"net/url"
+	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/jlis/aws-mfa-go/internal/awssts"
 	"github.com/jlis/aws-mfa-go/internal/credentials"
+	"github.com/jlis/aws-mfa-go/internal/rolesanywhere"
 )
 
 // Inputs are the raw values coming from the CLI layer.
@@ -17,17 +24,80 @@ type Inputs struct {
 	Profile        string
 	ProfileChanged bool
 
+	// Mode is one of the Mode* constants; empty derives it from the role settings.
+	Mode        string
+	ModeChanged bool
+
 	Device        string
 	DeviceChanged bool
 
-	DurationSeconds        int
-	DurationSecondsChanged bool
+	// Duration and SessionDuration are seconds ("3600") or Go durations ("8h").
+	Duration        string
+	DurationChanged bool
+
+	SessionDuration        string
+	SessionDurationChanged bool
+
+	// ClampDuration adjusts durations outside the STS limits instead of failing.
+	ClampDuration        bool
+	ClampDurationChanged bool
 
 	Token        string
 	TokenChanged bool
 
+	AssumeRole        string
+	AssumeRoleChanged bool
+
+	RoleChain        string
+	RoleChainChanged bool
+
+	RoleSessionName        string
+	RoleSessionNameChanged bool
+
+	ExternalID        string
+	ExternalIDChanged bool
+
+	// SessionTags are Key=Value pairs, one per entry (values may contain commas);
+	// values may use templates (see expandTemplates).
+	SessionTags        []string
+	SessionTagsChanged bool
+
+	TransitiveTagKeys        []string
+	TransitiveTagKeysChanged bool
+
+	SourceIdentity        string
+	SourceIdentityChanged bool
+
+	PolicyFile        string
+	PolicyFileChanged bool
+
+	PolicyARNs        []string
+	PolicyARNsChanged bool
+
+	WebIdentityTokenFile        string
+	WebIdentityTokenFileChanged bool
+
+	FederatedUserName        string
+	FederatedUserNameChanged bool
+
+	// SAMLAssertionFile holds a base64 SAMLResponse; "-" reads it from stdin.
+	SAMLAssertionFile        string
+	SAMLAssertionFileChanged bool
+
+	SAMLHelper        string
+	SAMLHelperChanged bool
+
 	Force bool
 
+	// SkipVerify disables the GetCallerIdentity check after a refresh.
+	SkipVerify bool
+
+	STSEndpointURL        string
+	STSEndpointURLChanged bool
+
+	// Timeout bounds each STS call; zero means no timeout.
+	Timeout time.Duration
+
 	LongTermSuffix  string
 	ShortTermSuffix string
 
@@ -42,11 +112,75 @@ type Resolved struct {
 	Profile          string
 	LongTermSection  string
 	ShortTermSection string
+	// KeysSection holds the access keys and MFA device: LongTermSection, or
+	// the long-term section of its source_profile.
+	KeysSection string
+
+	// Mode is how the short-term credentials are obtained (a Mode* constant).
+	Mode string
 
+	// Device is empty in modes that do not use MFA, and when none is
+	// configured (Run then discovers it).
 	Device          string
 	DurationSeconds int32
-	Token           string
-	Force           bool
+	// ClampDuration adjusts durations to the limits of the role (see
+	// limitRoleDuration); DurationNotes describe adjustments already made.
+	ClampDuration bool
+	DurationNotes []string
+	Token         string
+	Force         bool
+	SkipVerify    bool
+
+	// RoleARN is set when running in role mode (STS AssumeRole instead of GetSessionToken).
+	RoleARN         string
+	RoleSessionName string
+	ExternalID      string
+
+	// SessionTags, TransitiveTagKeys and SourceIdentity are attached to the
+	// first AssumeRole call of the run. Values may still contain templates
+	// until expandTemplates runs.
+	SessionTags       []awssts.Tag
+	TransitiveTagKeys []string
+	SourceIdentity    string
+
+	// Policy (compacted JSON) and PolicyARNs scope the final credentials down.
+	Policy     string
+	PolicyARNs []string
+
+	// RoleChain lists the intermediate roles assumed, in order, before RoleARN.
+	// HopSections caches the credentials of each of them (same length as RoleChain).
+	RoleChain   []string
+	HopSections []string
+
+	// FederatedUserName is the GetFederationToken name (federation mode only).
+	FederatedUserName string
+
+	// WebIdentityTokenFile holds the OIDC token exchanged for RoleARN
+	// (web-identity mode only). It is read on every refresh, since such
+	// tokens are usually rotated on disk.
+	WebIdentityTokenFile string
+
+	// OIDC configures the interactive login whose ID token is exchanged for
+	// RoleARN (oidc mode only).
+	OIDC OIDCSettings
+
+	// SSO configures the IAM Identity Center login and role (sso mode only).
+	SSO SSOSettings
+
+	// RolesAnywhere configures the certificate exchanged for RoleARN
+	// (roles-anywhere mode only).
+	RolesAnywhere RolesAnywhereSettings
+
+	// SAML configures the assertion exchanged for RoleARN (saml mode only).
+	// RoleARN may be empty, in which case the assertion's roles are offered.
+	SAML SAMLSettings
+
+	Endpoint EndpointSettings
+	HTTP     HTTPSettings
+
+	// SessionSection caches the MFA session roles are assumed from (role mode only).
+	SessionSection  string
+	SessionDuration int32
 
 	CredentialsFile string
 }
@@ -54,46 +188,296 @@ type Resolved struct {
 func Resolve(ctx context.Context, in Inputs, env Env, store *credentials.Store) (Resolved, error) {
 	_ = ctx // reserved for future (e.g. tracing); keep signature stable for tests.
 
-	profile := ""
-	if in.ProfileChanged && strings.TrimSpace(in.Profile) != "" {
-		profile = strings.TrimSpace(in.Profile)
-	} else if v := strings.TrimSpace(env.Get("AWS_PROFILE")); v != "" {
-		profile = v
+	profile := resolveProfile(in, env)
+	names, err := credentials.ComputeSectionNames(profile, in.LongTermSuffix, in.ShortTermSuffix)
+	if err != nil {
+		return Resolved{}, err
+	}
+
+	roleARN := pick(in.AssumeRole, in.AssumeRoleChanged, env.Get("MFA_ASSUME_ROLE"), store, names.LongTerm, "assume_role")
+
+	var roleChain, hopSections []string
+	if v := pick(in.RoleChain, in.RoleChainChanged, env.Get("MFA_ROLE_CHAIN"), store, names.LongTerm, "role_chain"); v != "" {
+		if roleARN != "" {
+			return Resolved{}, errors.New("set either assume_role (--assume-role, MFA_ASSUME_ROLE) or role_chain (--role-chain, MFA_ROLE_CHAIN), not both")
+		}
+		hops := splitList(v)
+		if len(hops) == 0 {
+			return Resolved{}, fmt.Errorf("invalid role chain %q", v)
+		}
+		roleARN = hops[len(hops)-1]
+		roleChain = hops[:len(hops)-1]
+		for i := range roleChain {
+			hopSections = append(hopSections, credentials.HopSectionName(names.ShortTerm, i+1))
+		}
+	}
+
+	// A web_identity_token_file flag or key selects web-identity mode; the
+	// AWS_* variables the SDKs use are only read once the mode is chosen.
+	webIdentityTokenFile := pick(in.WebIdentityTokenFile, in.WebIdentityTokenFileChanged, "", store, names.LongTerm, "web_identity_token_file")
+	oidcSettings := OIDCSettings{
+		Issuer:   pick("", false, env.Get("MFA_OIDC_ISSUER"), store, names.LongTerm, "oidc_issuer"),
+		ClientID: pick("", false, env.Get("MFA_OIDC_CLIENT_ID"), store, names.LongTerm, "oidc_client_id"),
+		Scopes:   oidcScopes(pick("", false, env.Get("MFA_OIDC_SCOPES"), store, names.LongTerm, "oidc_scopes")),
+	}
+	samlSettings := SAMLSettings{
+		AssertionFile: pick(in.SAMLAssertionFile, in.SAMLAssertionFileChanged, env.Get("MFA_SAML_ASSERTION_FILE"), store, names.LongTerm, "saml_assertion_file"),
+		Helper:        pick(in.SAMLHelper, in.SAMLHelperChanged, env.Get("MFA_SAML_HELPER"), store, names.LongTerm, "saml_helper"),
+	}
+	samlSource := samlSettings.AssertionFile != "" || samlSettings.Helper != ""
+	ssoSettings := SSOSettings{
+		StartURL:  pick("", false, env.Get("MFA_SSO_START_URL"), store, names.LongTerm, "sso_start_url"),
+		Region:    pick("", false, env.Get("MFA_SSO_REGION"), store, names.LongTerm, "sso_region"),
+		AccountID: pick("", false, env.Get("MFA_SSO_ACCOUNT_ID"), store, names.LongTerm, "sso_account_id"),
+		RoleName:  pick("", false, env.Get("MFA_SSO_ROLE_NAME"), store, names.LongTerm, "sso_role_name"),
+	}
+	raSettings := RolesAnywhereSettings{
+		Certificate:    pick("", false, env.Get("MFA_CERTIFICATE"), store, names.LongTerm, "certificate"),
+		PrivateKey:     pick("", false, env.Get("MFA_PRIVATE_KEY"), store, names.LongTerm, "private_key"),
+		TrustAnchorARN: pick("", false, env.Get("MFA_TRUST_ANCHOR_ARN"), store, names.LongTerm, "trust_anchor_arn"),
+		ProfileARN:     pick("", false, env.Get("MFA_PROFILE_ARN"), store, names.LongTerm, "profile_arn"),
+	}
+
+	sourceMode := ""
+	switch {
+	case webIdentityTokenFile != "":
+		sourceMode = ModeWebIdentity
+	case oidcSettings.Issuer != "":
+		sourceMode = ModeOIDC
+	case samlSource:
+		sourceMode = ModeSAML
+	case ssoSettings.StartURL != "":
+		sourceMode = ModeSSO
+	case raSettings.TrustAnchorARN != "":
+		sourceMode = ModeRolesAnywhere
+	}
+	mode, err := resolveMode(in, env, store, names.LongTerm, roleARN, sourceMode)
+	if err != nil {
+		return Resolved{}, err
+	}
+	if mode == ModeWebIdentity {
+		webIdentityTokenFile = pick(in.WebIdentityTokenFile, in.WebIdentityTokenFileChanged, env.Get("AWS_WEB_IDENTITY_TOKEN_FILE"), store, names.LongTerm, "web_identity_token_file")
+		if webIdentityTokenFile == "" {
+			return Resolved{}, errors.New("missing web identity token file: set --web-identity-token-file, AWS_WEB_IDENTITY_TOKEN_FILE, or web_identity_token_file in long-term credentials section")
+		}
+	} else {
+		webIdentityTokenFile = ""
+	}
+	if mode == ModeOIDC {
+		if oidcSettings.Issuer == "" || oidcSettings.ClientID == "" {
+			return Resolved{}, errors.New("oidc mode requires oidc_issuer and oidc_client_id (MFA_OIDC_ISSUER, MFA_OIDC_CLIENT_ID) in long-term credentials section")
+		}
+		if u, err := url.Parse(oidcSettings.Issuer); err != nil || (u.Scheme != "https" && !isLoopback(u.Hostname())) {
+			return Resolved{}, fmt.Errorf("invalid oidc_issuer %q: expected an https URL", oidcSettings.Issuer)
+		}
+	} else {
+		oidcSettings = OIDCSettings{}
+	}
+	if mode == ModeSAML {
+		switch {
+		case !samlSource:
+			return Resolved{}, errors.New("saml mode requires an assertion: set --saml-assertion-file (- for stdin), --saml-helper, MFA_SAML_ASSERTION_FILE, MFA_SAML_HELPER, or saml_assertion_file/saml_helper in long-term credentials section")
+		case samlSettings.AssertionFile != "" && samlSettings.Helper != "":
+			return Resolved{}, errors.New("set either saml_assertion_file (--saml-assertion-file, MFA_SAML_ASSERTION_FILE) or saml_helper (--saml-helper, MFA_SAML_HELPER), not both")
+		case len(roleChain) > 0:
+			return Resolved{}, fmt.Errorf("role_chain is not supported in %s mode", mode)
+		}
+		// Without a configured role, reuse the one chosen for this profile last time.
+		if roleARN == "" && storedMode(store, names.ShortTerm) == ModeSAML {
+			roleARN = storedRoleARN(store, names.ShortTerm)
+			samlSettings.RoleRemembered = roleARN != ""
+		}
+	} else {
+		samlSettings = SAMLSettings{}
+	}
+	if mode == ModeSSO {
+		if ssoSettings.StartURL == "" || ssoSettings.Region == "" || ssoSettings.AccountID == "" || ssoSettings.RoleName == "" {
+			return Resolved{}, errors.New("sso mode requires sso_start_url, sso_region, sso_account_id and sso_role_name (MFA_SSO_START_URL, MFA_SSO_REGION, MFA_SSO_ACCOUNT_ID, MFA_SSO_ROLE_NAME) in long-term credentials section")
+		}
+		if u, err := url.Parse(ssoSettings.StartURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			return Resolved{}, fmt.Errorf("invalid sso_start_url %q: expected an https URL", ssoSettings.StartURL)
+		}
+		if !accountIDPattern.MatchString(ssoSettings.AccountID) {
+			return Resolved{}, fmt.Errorf("invalid sso_account_id %q: expected 12 digits", ssoSettings.AccountID)
+		}
+		ssoSettings.OIDCEndpointURL = serviceEndpointURL(env, "AWS_ENDPOINT_URL_SSO_OIDC")
+		ssoSettings.PortalEndpointURL = serviceEndpointURL(env, "AWS_ENDPOINT_URL_SSO")
 	} else {
-		profile = "default"
+		ssoSettings = SSOSettings{}
+	}
+	if mode == ModeRolesAnywhere {
+		if raSettings.Certificate == "" || raSettings.PrivateKey == "" || raSettings.TrustAnchorARN == "" || raSettings.ProfileARN == "" {
+			return Resolved{}, errors.New("roles-anywhere mode requires certificate, private_key, trust_anchor_arn and profile_arn (MFA_CERTIFICATE, MFA_PRIVATE_KEY, MFA_TRUST_ANCHOR_ARN, MFA_PROFILE_ARN) in long-term credentials section")
+		}
+		if raSettings.Region, err = rolesanywhere.RegionFromARN(raSettings.TrustAnchorARN); err != nil {
+			return Resolved{}, err
+		}
+		if len(roleChain) > 0 {
+			return Resolved{}, fmt.Errorf("role_chain is not supported in %s mode", mode)
+		}
+		if roleARN == "" {
+			roleARN = pick("", false, "", store, names.LongTerm, "role_arn")
+		}
+		if roleARN == "" {
+			return Resolved{}, fmt.Errorf("missing role for %s mode: set --assume-role, MFA_ASSUME_ROLE, or role_arn in long-term credentials section", mode)
+		}
+		raSettings.EndpointURL = pick("", false, serviceEndpointURL(env, "AWS_ENDPOINT_URL_ROLESANYWHERE"), store, names.LongTerm, "roles_anywhere_endpoint_url")
+		raSettings.PKCS11Module = pick("", false, env.Get("MFA_PKCS11_MODULE"), store, names.LongTerm, "pkcs11_module")
+		raSettings.PKCS11PIN = strings.TrimSpace(env.Get("MFA_PKCS11_PIN"))
+	} else {
+		raSettings = RolesAnywhereSettings{}
+	}
+	if mode == ModeWebIdentity || mode == ModeOIDC {
+		if len(roleChain) > 0 {
+			return Resolved{}, fmt.Errorf("role_chain is not supported in %s mode", mode)
+		}
+		if roleARN == "" {
+			roleARN = pick("", false, env.Get("AWS_ROLE_ARN"), store, names.LongTerm, "role_arn")
+		}
+		if roleARN == "" {
+			return Resolved{}, fmt.Errorf("missing role for %s mode: set --assume-role, AWS_ROLE_ARN, or role_arn in long-term credentials section", mode)
+		}
 	}
 
-	names, err := credentials.ComputeSectionNames(profile, in.LongTermSuffix, in.ShortTermSuffix)
+	source, err := sourceNames(store, names, in)
 	if err != nil {
 		return Resolved{}, err
 	}
 
+	// Without a configured device, Run discovers it with IAM ListMFADevices.
 	device := ""
-	if in.DeviceChanged && strings.TrimSpace(in.Device) != "" {
-		device = strings.TrimSpace(in.Device)
-	} else if v := strings.TrimSpace(env.Get("MFA_DEVICE")); v != "" {
-		device = v
-	} else if v, ok := store.Get(names.LongTerm, "aws_mfa_device"); ok && v != "" {
-		device = v
-	} else {
-		return Resolved{}, errors.New("missing MFA device: set --device, MFA_DEVICE, or aws_mfa_device in long-term credentials section")
+	if usesMFA(mode) {
+		if in.DeviceChanged && strings.TrimSpace(in.Device) != "" {
+			device = strings.TrimSpace(in.Device)
+		} else if v := strings.TrimSpace(env.Get("MFA_DEVICE")); v != "" {
+			device = v
+		} else if v, ok := store.Get(names.LongTerm, "aws_mfa_device"); ok && v != "" {
+			device = v
+		} else if v, ok := store.Get(source.LongTerm, "aws_mfa_device"); ok && v != "" {
+			device = v
+		}
 	}
 
-	duration := int32(0)
-	if in.DurationSecondsChanged && in.DurationSeconds > 0 {
-		v := int64(in.DurationSeconds)
-		if v > math.MaxInt32 {
-			return Resolved{}, fmt.Errorf("invalid duration %d: too large", in.DurationSeconds)
+	roleSessionName := ""
+	externalID := ""
+	var sessionTags []awssts.Tag
+	var transitiveTagKeys []string
+	sourceIdentity := ""
+	// With SAML, the IdP sets the role session name.
+	if roleARN != "" && mode != ModeSAML {
+		roleSessionName = pick(in.RoleSessionName, in.RoleSessionNameChanged, env.Get("MFA_ROLE_SESSION_NAME"), store, names.LongTerm, "role_session_name")
+		if roleSessionName == "" {
+			roleSessionName = defaultRoleSessionName(env)
 		}
-		duration = int32(v) //nolint:gosec // G115: bounded by MaxInt32 check above
-	} else if v := strings.TrimSpace(env.Get("MFA_STS_DURATION")); v != "" {
-		parsed, err := strconv.ParseInt(v, 10, 32)
-		if err != nil || parsed <= 0 {
-			return Resolved{}, fmt.Errorf("invalid MFA_STS_DURATION %q", v)
+		if !roleSessionNamePattern.MatchString(roleSessionName) {
+			return Resolved{}, fmt.Errorf("invalid role session name %q: must be 2-64 characters of [A-Za-z0-9+=,.@_-]", roleSessionName)
+		}
+	}
+	// Each --tag holds one tag, whose value may contain commas; the env var
+	// and the profile key hold a comma-separated list.
+	tags := in.SessionTags
+	if !in.SessionTagsChanged || len(tags) == 0 {
+		tags = splitList(pick("", false, env.Get("MFA_SESSION_TAGS"), store, names.LongTerm, "session_tags"))
+	}
+	transitive := pick(strings.Join(in.TransitiveTagKeys, ","), in.TransitiveTagKeysChanged, env.Get("MFA_TRANSITIVE_TAG_KEYS"), store, names.LongTerm, "transitive_tag_keys")
+	sourceIdentity = pick(in.SourceIdentity, in.SourceIdentityChanged, env.Get("MFA_SOURCE_IDENTITY"), store, names.LongTerm, "source_identity")
+	if (len(tags) > 0 || transitive != "" || sourceIdentity != "") && mode != ModeRole {
+		return Resolved{}, fmt.Errorf("session tags and source identity (session_tags, transitive_tag_keys, source_identity) are not supported in %s mode", mode)
+	}
+	if mode == ModeRole {
+		externalID = pick(in.ExternalID, in.ExternalIDChanged, env.Get("MFA_EXTERNAL_ID"), store, names.LongTerm, "external_id")
+
+		sessionTags, err = parseTags(tags)
+		if err != nil {
+			return Resolved{}, err
+		}
+		transitiveTagKeys = splitList(transitive)
+		for _, k := range transitiveTagKeys {
+			if !hasTag(sessionTags, k) {
+				return Resolved{}, fmt.Errorf("transitive tag key %q is not one of the session tags", k)
+			}
+		}
+	}
+
+	policy := ""
+	if v := pick(in.PolicyFile, in.PolicyFileChanged, env.Get("MFA_POLICY_FILE"), store, names.LongTerm, "policy_file"); v != "" {
+		policy, err = readPolicyFile(v)
+		if err != nil {
+			return Resolved{}, err
+		}
+	}
+	policyARNs := splitList(pick(strings.Join(in.PolicyARNs, ","), in.PolicyARNsChanged, env.Get("MFA_POLICY_ARNS"), store, names.LongTerm, "policy_arns"))
+	if (policy != "" || len(policyARNs) > 0) && (mode == ModeSession || mode == ModeSSO || mode == ModeRolesAnywhere) {
+		return Resolved{}, fmt.Errorf("session policies (policy_file, policy_arns) are not supported in %s mode", mode)
+	}
+
+	federatedUserName := ""
+	if mode == ModeFederation {
+		federatedUserName = pick(in.FederatedUserName, in.FederatedUserNameChanged, env.Get("MFA_FEDERATED_USER_NAME"), store, names.LongTerm, "federated_user_name")
+		if federatedUserName == "" {
+			federatedUserName = defaultRoleSessionName(env)
+			if len(federatedUserName) > 32 {
+				federatedUserName = federatedUserName[:32]
+			}
+		}
+		if !federatedUserNamePattern.MatchString(federatedUserName) {
+			return Resolved{}, fmt.Errorf("invalid federated user name %q: must be 2-32 characters of [A-Za-z0-9+=,.@_-]", federatedUserName)
+		}
+	}
+
+	defaultDuration := int32(43200) // 12 hours (upstream default without assume-role)
+	if roleARN != "" || mode == ModeSAML {
+		defaultDuration = 3600 // 1 hour (upstream default with assume-role)
+	}
+	duration, err := resolveDuration(in.Duration, in.DurationChanged, "MFA_STS_DURATION", env, nil, "", "", defaultDuration)
+	if err != nil {
+		return Resolved{}, err
+	}
+	clamp, err := parseBool(pick(strconv.FormatBool(in.ClampDuration), in.ClampDurationChanged, env.Get("MFA_CLAMP_DURATION"), store, names.LongTerm, "clamp_duration"), "clamp_duration")
+	if err != nil {
+		return Resolved{}, err
+	}
+	var notes []string
+	if longest, limit := durationLimit(mode, len(roleChain) > 0); longest > 0 {
+		var note string
+		if duration, note, err = limitDuration("duration", duration, longest, limit, clamp); err != nil {
+			return Resolved{}, err
+		}
+		if note != "" {
+			notes = append(notes, note)
+		}
+	}
+
+	// In role mode, the role is assumed from a cached MFA session which can be
+	// reused (without a new token) until it expires. Profiles with a
+	// source_profile share the session of their source.
+	sessionSection := ""
+	sessionDuration := int32(0)
+	if mode == ModeRole {
+		sessionSection = source.Session
+		if names.LongTerm == sessionSection || names.ShortTerm == sessionSection {
+			return Resolved{}, fmt.Errorf("section name %q is reserved for the cached MFA session in role mode", sessionSection)
+		}
+		sessionDuration, err = resolveDuration(in.SessionDuration, in.SessionDurationChanged, "MFA_SESSION_DURATION", env, store, names.LongTerm, "mfa_session_duration", 43200)
+		if err != nil {
+			return Resolved{}, err
+		}
+		var note string
+		if sessionDuration, note, err = limitDuration("MFA session duration", sessionDuration, maxSessionTokenDuration, "the GetSessionToken maximum", clamp); err != nil {
+			return Resolved{}, err
+		}
+		if note != "" {
+			notes = append(notes, note)
 		}
-		duration = int32(parsed)
-	} else {
-		duration = 43200 // 12 hours (upstream default without assume-role)
+	}
+
+	endpoint, err := resolveEndpoint(in, env, store, names.LongTerm)
+	if err != nil {
+		return Resolved{}, err
+	}
+	httpSettings, err := resolveHTTP(env, store, names.LongTerm)
+	if err != nil {
+		return Resolved{}, err
 	}
 
 	token := ""
@@ -102,13 +486,263 @@ func Resolve(ctx context.Context, in Inputs, env Env, store *credentials.Store)
 	}
 
 	return Resolved{
-		Profile:          profile,
-		LongTermSection:  names.LongTerm,
-		ShortTermSection: names.ShortTerm,
-		Device:           device,
-		DurationSeconds:  duration,
-		Token:            token,
-		Force:            in.Force,
-		CredentialsFile:  in.CredentialsFile,
+		Profile:              profile,
+		LongTermSection:      names.LongTerm,
+		KeysSection:          source.LongTerm,
+		ShortTermSection:     names.ShortTerm,
+		Mode:                 mode,
+		Device:               device,
+		DurationSeconds:      duration,
+		ClampDuration:        clamp,
+		DurationNotes:        notes,
+		Token:                token,
+		Force:                in.Force,
+		SkipVerify:           in.SkipVerify,
+		Endpoint:             endpoint,
+		HTTP:                 httpSettings,
+		RoleARN:              roleARN,
+		RoleSessionName:      roleSessionName,
+		ExternalID:           externalID,
+		SessionTags:          sessionTags,
+		TransitiveTagKeys:    transitiveTagKeys,
+		SourceIdentity:       sourceIdentity,
+		Policy:               policy,
+		PolicyARNs:           policyARNs,
+		RoleChain:            roleChain,
+		HopSections:          hopSections,
+		SessionSection:       sessionSection,
+		SessionDuration:      sessionDuration,
+		FederatedUserName:    federatedUserName,
+		WebIdentityTokenFile: webIdentityTokenFile,
+		OIDC:                 oidcSettings,
+		SAML:                 samlSettings,
+		SSO:                  ssoSettings,
+		RolesAnywhere:        raSettings,
+		CredentialsFile:      in.CredentialsFile,
 	}, nil
 }
+
+// EndpointSettings select the STS endpoint, following the AWS CLI/SDK settings
+// of the same names.
+type EndpointSettings struct {
+	URL               string
+	UseFIPS           bool
+	UseDualStack      bool
+	RegionalEndpoints string
+
+	// IAMURL overrides the IAM endpoint (MFA device discovery):
+	// AWS_ENDPOINT_URL_IAM > AWS_ENDPOINT_URL > iam_endpoint_url.
+	IAMURL string
+}
+
+// resolveEndpoint resolves the STS endpoint settings of a profile:
+//
+// - URL: flag > AWS_ENDPOINT_URL_STS > AWS_ENDPOINT_URL > sts_endpoint_url
+// - FIPS: AWS_USE_FIPS_ENDPOINT > use_fips_endpoint
+// - dual-stack: AWS_USE_DUALSTACK_ENDPOINT > use_dualstack_endpoint
+// - regional endpoints: AWS_STS_REGIONAL_ENDPOINTS > sts_regional_endpoints
+func resolveEndpoint(in Inputs, env Env, store *credentials.Store, section string) (EndpointSettings, error) {
+	var ep EndpointSettings
+
+	envURL := env.Get("AWS_ENDPOINT_URL_STS")
+	if strings.TrimSpace(envURL) == "" {
+		envURL = env.Get("AWS_ENDPOINT_URL")
+	}
+	ep.URL = pick(in.STSEndpointURL, in.STSEndpointURLChanged, envURL, store, section, "sts_endpoint_url")
+	if ep.URL != "" {
+		u, err := url.Parse(ep.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return EndpointSettings{}, fmt.Errorf("invalid STS endpoint URL %q: expected http(s)://host[:port]", ep.URL)
+		}
+	}
+
+	var err error
+	if ep.UseFIPS, err = parseBool(pick("", false, env.Get("AWS_USE_FIPS_ENDPOINT"), store, section, "use_fips_endpoint"), "use_fips_endpoint"); err != nil {
+		return EndpointSettings{}, err
+	}
+	if ep.UseDualStack, err = parseBool(pick("", false, env.Get("AWS_USE_DUALSTACK_ENDPOINT"), store, section, "use_dualstack_endpoint"), "use_dualstack_endpoint"); err != nil {
+		return EndpointSettings{}, err
+	}
+
+	ep.IAMURL = pick("", false, serviceEndpointURL(env, "AWS_ENDPOINT_URL_IAM"), store, section, "iam_endpoint_url")
+
+	ep.RegionalEndpoints = strings.ToLower(pick("", false, env.Get("AWS_STS_REGIONAL_ENDPOINTS"), store, section, "sts_regional_endpoints"))
+	switch ep.RegionalEndpoints {
+	case "", "regional", "legacy":
+	default:
+		return EndpointSettings{}, fmt.Errorf("invalid sts_regional_endpoints %q: expected regional or legacy", ep.RegionalEndpoints)
+	}
+	return ep, nil
+}
+
+// serviceEndpointURL returns the endpoint URL override of a service other than
+// STS: its AWS_ENDPOINT_URL_<SERVICE> variable, then AWS_ENDPOINT_URL.
+func serviceEndpointURL(env Env, name string) string {
+	if v := strings.TrimSpace(env.Get(name)); v != "" {
+		return v
+	}
+	return strings.TrimSpace(env.Get("AWS_ENDPOINT_URL"))
+}
+
+// HTTPSettings configure the HTTP client used for STS.
+type HTTPSettings struct {
+	HTTPSProxy string
+	HTTPProxy  string
+	NoProxy    string
+	// CABundle is the content of the CA bundle file, if any.
+	CABundle []byte
+}
+
+// resolveHTTP resolves the proxy and CA bundle settings:
+//
+// - proxy: HTTPS_PROXY > https_proxy (https), HTTP_PROXY > http_proxy (http), with NO_PROXY > no_proxy
+// - CA bundle: AWS_CA_BUNDLE > ca_bundle
+func resolveHTTP(env Env, store *credentials.Store, section string) (HTTPSettings, error) {
+	var hs HTTPSettings
+
+	hs.HTTPSProxy = strings.TrimSpace(env.Get("HTTPS_PROXY"))
+	if hs.HTTPSProxy == "" {
+		hs.HTTPSProxy = strings.TrimSpace(env.Get("https_proxy"))
+	}
+	hs.HTTPProxy = strings.TrimSpace(env.Get("HTTP_PROXY"))
+	if hs.HTTPProxy == "" {
+		hs.HTTPProxy = strings.TrimSpace(env.Get("http_proxy"))
+	}
+	for _, proxy := range []string{hs.HTTPSProxy, hs.HTTPProxy} {
+		if proxy == "" {
+			continue
+		}
+		if _, err := awssts.ParseProxyURL(proxy); err != nil {
+			return HTTPSettings{}, err
+		}
+	}
+	hs.NoProxy = strings.TrimSpace(env.Get("NO_PROXY"))
+	if hs.NoProxy == "" {
+		hs.NoProxy = strings.TrimSpace(env.Get("no_proxy"))
+	}
+
+	if path := pick("", false, env.Get("AWS_CA_BUNDLE"), store, section, "ca_bundle"); path != "" {
+		pem, err := os.ReadFile(ExpandHome(path)) //nolint:gosec // G304: path is user-provided configuration
+		if err != nil {
+			return HTTPSettings{}, fmt.Errorf("read CA bundle: %w", err)
+		}
+		hs.CABundle = pem
+	}
+	return hs, nil
+}
+
+// stsOptions combines the region, endpoint and HTTP settings for the STS client.
+func stsOptions(region string, ep EndpointSettings, hs HTTPSettings, timeout time.Duration) awssts.Options {
+	return awssts.Options{
+		Region:               region,
+		EndpointURL:          ep.URL,
+		UseFIPSEndpoint:      ep.UseFIPS,
+		UseDualStackEndpoint: ep.UseDualStack,
+		RegionalEndpoints:    ep.RegionalEndpoints,
+		Timeout:              timeout,
+		HTTPSProxy:           hs.HTTPSProxy,
+		HTTPProxy:            hs.HTTPProxy,
+		NoProxy:              hs.NoProxy,
+		CABundle:             hs.CABundle,
+	}
+}
+
+// iamOptions are the options of IAM clients: those of STS clients, with the
+// IAM endpoint override.
+func iamOptions(region string, ep EndpointSettings, hs HTTPSettings, timeout time.Duration) awssts.Options {
+	opts := stsOptions(region, ep, hs, timeout)
+	opts.EndpointURL = ep.IAMURL
+	return opts
+}
+
+// parseBool parses an optional true/false setting ("" means false).
+func parseBool(v, name string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "":
+		return false, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid %s %q: expected true or false", name, v)
+	}
+}
+
+// resolveProfile applies the profile precedence: flag > AWS_PROFILE > "default".
+func resolveProfile(in Inputs, env Env) string {
+	if in.ProfileChanged && strings.TrimSpace(in.Profile) != "" {
+		return strings.TrimSpace(in.Profile)
+	}
+	if v := strings.TrimSpace(env.Get("AWS_PROFILE")); v != "" {
+		return v
+	}
+	return "default"
+}
+
+// pick applies the usual precedence for optional settings:
+// explicitly set flag > environment variable > long-term section key.
+// It returns "" when none of them is set.
+func pick(flagValue string, flagChanged bool, envValue string, store *credentials.Store, section, key string) string {
+	if flagChanged && strings.TrimSpace(flagValue) != "" {
+		return strings.TrimSpace(flagValue)
+	}
+	if v := strings.TrimSpace(envValue); v != "" {
+		return v
+	}
+	if v, ok := store.Get(section, key); ok && v != "" {
+		return v
+	}
+	return ""
+}
+
+// readPolicyFile reads an inline session policy document and returns it
+// compacted, which keeps the packed policy size STS enforces as small as possible.
+func readPolicyFile(path string) (string, error) {
+	raw, err := os.ReadFile(ExpandHome(path)) //nolint:gosec // G304: path is user-provided configuration
+	if err != nil {
+		return "", fmt.Errorf("read policy file: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return "", fmt.Errorf("policy file %s is not valid JSON: %w", path, err)
+	}
+	return buf.String(), nil
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+var (
+	roleSessionNamePattern = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+	roleSessionNameInvalid = regexp.MustCompile(`[^\w+=,.@-]`)
+
+	federatedUserNamePattern = regexp.MustCompile(`^[\w+=,.@-]{2,32}$`)
+
+	accountIDPattern = regexp.MustCompile(`^\d{12}$`)
+)
+
+// defaultRoleSessionName mirrors upstream aws-mfa, which uses the local username.
+// Characters STS does not accept are replaced so the default always validates.
+func defaultRoleSessionName(env Env) string {
+	name := strings.TrimSpace(env.Get("USER"))
+	if name == "" {
+		name = strings.TrimSpace(env.Get("USERNAME"))
+	}
+	name = roleSessionNameInvalid.ReplaceAllString(name, "-")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	if len(name) < 2 {
+		return "aws-mfa-go"
+	}
+	return name
+}
@@ -2,7 +2,9 @@ package app
 
 import (
 	"context"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/jlis/aws-mfa-go/internal/credentials"
@@ -103,3 +105,374 @@ func TestResolve_DurationDefaultAndEnv(t *testing.T) {
 		t.Fatalf("expected env duration 1800, got %d", got2.DurationSeconds)
 	}
 }
+
+func TestResolve_AssumeRolePrecedenceAndDefaults(t *testing.T) {
+	dir := t.TempDir()
+	store, err := credentials.Load(filepath.Join(dir, "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("default-long-term", "aws_mfa_device", "device")
+	store.Set("default-long-term", "assume_role", "arn:aws:iam::123456789012:role/from-store")
+
+	in := Inputs{
+		Profile:        "default",
+		ProfileChanged: true,
+		LongTermSuffix: "long-term",
+	}
+
+	got, err := Resolve(context.Background(), in, mapEnv{"USER": "first.last@example"}, store)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got.RoleARN != "arn:aws:iam::123456789012:role/from-store" {
+		t.Fatalf("expected store role, got %q", got.RoleARN)
+	}
+	if got.RoleSessionName != "first.last@example" {
+		t.Fatalf("expected username as session name, got %q", got.RoleSessionName)
+	}
+	if got.DurationSeconds != 3600 {
+		t.Fatalf("expected role default duration 3600, got %d", got.DurationSeconds)
+	}
+
+	got, err = Resolve(context.Background(), in, mapEnv{"MFA_ASSUME_ROLE": "arn:aws:iam::123456789012:role/from-env", "USER": "a b"}, store)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got.RoleARN != "arn:aws:iam::123456789012:role/from-env" {
+		t.Fatalf("expected env role to win over store, got %q", got.RoleARN)
+	}
+	if got.RoleSessionName != "a-b" {
+		t.Fatalf("expected sanitized session name, got %q", got.RoleSessionName)
+	}
+
+	in.AssumeRole = "arn:aws:iam::123456789012:role/from-flag"
+	in.AssumeRoleChanged = true
+	in.RoleSessionName = "x"
+	in.RoleSessionNameChanged = true
+	if _, err := Resolve(context.Background(), in, mapEnv{}, store); err == nil {
+		t.Fatalf("expected error for a too-short role session name")
+	}
+}
+
+func TestResolve_RoleChain(t *testing.T) {
+	dir := t.TempDir()
+	store, err := credentials.Load(filepath.Join(dir, "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("prod-long-term", "aws_mfa_device", "device")
+	store.Set("prod-long-term", "role_chain", "arn:hub, arn:middle ,arn:workload")
+
+	in := Inputs{
+		Profile:        "prod",
+		ProfileChanged: true,
+		LongTermSuffix: "long-term",
+	}
+
+	got, err := Resolve(context.Background(), in, mapEnv{}, store)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got.RoleARN != "arn:workload" {
+		t.Fatalf("expected last hop as target role, got %q", got.RoleARN)
+	}
+	if len(got.RoleChain) != 2 || got.RoleChain[0] != "arn:hub" || got.RoleChain[1] != "arn:middle" {
+		t.Fatalf("unexpected intermediate hops: %v", got.RoleChain)
+	}
+	if len(got.HopSections) != 2 || got.HopSections[0] != "prod-hop-1" || got.HopSections[1] != "prod-hop-2" {
+		t.Fatalf("unexpected hop sections: %v", got.HopSections)
+	}
+
+	if _, err := Resolve(context.Background(), in, mapEnv{"MFA_ASSUME_ROLE": "arn:other"}, store); err == nil {
+		t.Fatalf("expected error when both assume_role and role_chain are set")
+	}
+}
+
+func TestResolve_SessionPolicyValidation(t *testing.T) {
+	dir := t.TempDir()
+	store, err := credentials.Load(filepath.Join(dir, "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("default-long-term", "aws_mfa_device", "device")
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	in := Inputs{
+		Profile:           "default",
+		ProfileChanged:    true,
+		LongTermSuffix:    "long-term",
+		PolicyARNs:        []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+		PolicyARNsChanged: true,
+	}
+	if _, err := Resolve(context.Background(), in, mapEnv{}, store); err == nil {
+		t.Fatalf("expected error for session policies without a role")
+	}
+
+	in.AssumeRole = "arn:aws:iam::123456789012:role/admin"
+	in.AssumeRoleChanged = true
+	in.PolicyFile = bad
+	in.PolicyFileChanged = true
+	if _, err := Resolve(context.Background(), in, mapEnv{}, store); err == nil {
+		t.Fatalf("expected error for an invalid policy document")
+	}
+}
+
+func TestResolve_EndpointSettings(t *testing.T) {
+	dir := t.TempDir()
+	store, err := credentials.Load(filepath.Join(dir, "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("default-long-term", "aws_mfa_device", "device")
+	store.Set("default-long-term", "sts_endpoint_url", "https://from-store.example")
+	store.Set("default-long-term", "use_fips_endpoint", "true")
+	store.Set("default-long-term", "sts_regional_endpoints", "legacy")
+
+	in := Inputs{Profile: "default", ProfileChanged: true, LongTermSuffix: "long-term"}
+
+	got, err := Resolve(context.Background(), in, mapEnv{}, store)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	want := EndpointSettings{URL: "https://from-store.example", UseFIPS: true, RegionalEndpoints: "legacy"}
+	if got.Endpoint != want {
+		t.Fatalf("expected %+v, got %+v", want, got.Endpoint)
+	}
+
+	env := mapEnv{
+		"AWS_ENDPOINT_URL":           "http://generic.example",
+		"AWS_ENDPOINT_URL_STS":       "http://localhost:4566",
+		"AWS_USE_DUALSTACK_ENDPOINT": "TRUE",
+	}
+	got, err = Resolve(context.Background(), in, env, store)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got.Endpoint.URL != "http://localhost:4566" || !got.Endpoint.UseDualStack {
+		t.Fatalf("expected env to win, got %+v", got.Endpoint)
+	}
+
+	in.STSEndpointURL = "https://from-flag.example"
+	in.STSEndpointURLChanged = true
+	got, err = Resolve(context.Background(), in, env, store)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got.Endpoint.URL != "https://from-flag.example" {
+		t.Fatalf("expected flag to win, got %q", got.Endpoint.URL)
+	}
+
+	for _, env := range []mapEnv{
+		{"AWS_ENDPOINT_URL_STS": "localhost:4566"},
+		{"AWS_USE_FIPS_ENDPOINT": "yes"},
+		{"AWS_STS_REGIONAL_ENDPOINTS": "global"},
+	} {
+		in := Inputs{Profile: "default", ProfileChanged: true, LongTermSuffix: "long-term"}
+		if _, err := Resolve(context.Background(), in, env, store); err == nil {
+			t.Fatalf("expected error for %v", env)
+		}
+	}
+}
+
+func TestResolve_HTTPSettings(t *testing.T) {
+	dir := t.TempDir()
+	store, err := credentials.Load(filepath.Join(dir, "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	bundle := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(bundle, []byte("PEM"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	store.Set("default-long-term", "aws_mfa_device", "device")
+	store.Set("default-long-term", "ca_bundle", bundle)
+
+	in := Inputs{Profile: "default", ProfileChanged: true, LongTermSuffix: "long-term"}
+	env := mapEnv{"https_proxy": "proxy.internal:3128", "HTTP_PROXY": "http-proxy.internal:8080", "NO_PROXY": "localhost"}
+
+	got, err := Resolve(context.Background(), in, env, store)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got.HTTP.HTTPSProxy != "proxy.internal:3128" || got.HTTP.HTTPProxy != "http-proxy.internal:8080" || got.HTTP.NoProxy != "localhost" || string(got.HTTP.CABundle) != "PEM" {
+		t.Fatalf("unexpected HTTP settings: %+v", got.HTTP)
+	}
+
+	if _, err := Resolve(context.Background(), in, mapEnv{"AWS_CA_BUNDLE": filepath.Join(dir, "missing.pem")}, store); err == nil {
+		t.Fatalf("expected error for a missing CA bundle")
+	}
+	if _, err := Resolve(context.Background(), in, mapEnv{"HTTPS_PROXY": "ftp://proxy.internal"}, store); err == nil {
+		t.Fatalf("expected error for an invalid proxy URL")
+	}
+}
+
+func TestResolve_Mode(t *testing.T) {
+	store, err := credentials.Load(filepath.Join(t.TempDir(), "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	base := Inputs{Profile: "default", ProfileChanged: true, LongTermSuffix: "long-term"}
+
+	// Federation mode does not need an MFA device and accepts session policies.
+	in := base
+	in.Mode = "federation"
+	in.ModeChanged = true
+	in.PolicyARNs = []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}
+	in.PolicyARNsChanged = true
+	got, err := Resolve(context.Background(), in, mapEnv{"USER": "alice"}, store)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got.Mode != ModeFederation || got.Device != "" || got.FederatedUserName != "alice" || got.DurationSeconds != 43200 {
+		t.Fatalf("unexpected federation settings: %+v", got)
+	}
+
+	store.Set("default-long-term", "aws_mfa_device", "device")
+	got, err = Resolve(context.Background(), base, mapEnv{"MFA_ASSUME_ROLE": "arn:aws:iam::123456789012:role/admin"}, store)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got.Mode != ModeRole {
+		t.Fatalf("expected mode derived from the role, got %q", got.Mode)
+	}
+
+	for _, env := range []mapEnv{
+		{"MFA_MODE": "role"},
+		{"MFA_MODE": "federation", "MFA_ASSUME_ROLE": "arn:aws:iam::123456789012:role/admin"},
+		{"MFA_MODE": "federation", "MFA_FEDERATED_USER_NAME": "a-name-that-is-longer-than-32-chars"},
+		{"MFA_MODE": "bogus"},
+		{"MFA_MODE": "web-identity", "AWS_ROLE_ARN": "arn:aws:iam::123456789012:role/ci"},
+		{"MFA_MODE": "web-identity", "AWS_WEB_IDENTITY_TOKEN_FILE": "/var/run/token"},
+		{"MFA_MODE": "saml"},
+		{"MFA_MODE": "sso", "MFA_SSO_START_URL": "https://corp.awsapps.com/start"},
+		{"MFA_SSO_START_URL": "http://corp.awsapps.com/start", "MFA_SSO_REGION": "eu-west-1", "MFA_SSO_ACCOUNT_ID": "123456789012", "MFA_SSO_ROLE_NAME": "Developer"},
+		{"MFA_SAML_ASSERTION_FILE": "-", "MFA_SAML_HELPER": "idp-login"},
+	} {
+		if _, err := Resolve(context.Background(), base, env, store); err == nil {
+			t.Fatalf("expected error for %v", env)
+		}
+	}
+}
+
+func TestResolve_SourceProfile(t *testing.T) {
+	store, err := credentials.Load(filepath.Join(t.TempDir(), "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("prod-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/me")
+	store.Set("prod-admin-long-term", "source_profile", "prod")
+	store.Set("prod-admin-long-term", "assume_role", "arn:aws:iam::210987654321:role/admin")
+	store.Set("prod-self-long-term", "source_profile", "prod-self")
+	store.Set("prod-nested-long-term", "source_profile", "prod-admin")
+	store.Set("prod-nested-long-term", "assume_role", "arn:aws:iam::210987654321:role/nested")
+
+	in := Inputs{Profile: "prod-admin", ProfileChanged: true, LongTermSuffix: "long-term"}
+	got, err := Resolve(context.Background(), in, mapEnv{}, store)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got.LongTermSection != "prod-admin-long-term" || got.KeysSection != "prod-long-term" {
+		t.Fatalf("expected settings from [prod-admin-long-term] and keys from [prod-long-term], got %q and %q", got.LongTermSection, got.KeysSection)
+	}
+	if got.SessionSection != "prod-mfa-session" || got.ShortTermSection != "prod-admin" {
+		t.Fatalf("expected the MFA session of prod and short-term [prod-admin], got %q and %q", got.SessionSection, got.ShortTermSection)
+	}
+	if got.Device != "arn:aws:iam::123456789012:mfa/me" {
+		t.Fatalf("expected the source's MFA device, got %q", got.Device)
+	}
+
+	// A device of the profile's own wins over the source's.
+	store.Set("prod-admin-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/other")
+	if got, err = Resolve(context.Background(), in, mapEnv{}, store); err != nil || got.Device != "arn:aws:iam::123456789012:mfa/other" {
+		t.Fatalf("expected the profile's own device, got %q, %v", got.Device, err)
+	}
+
+	for profile, want := range map[string]string{
+		"prod-self":   "refers to the profile itself",
+		"prod-nested": "has a source_profile itself",
+	} {
+		in.Profile = profile
+		if _, err := Resolve(context.Background(), in, mapEnv{}, store); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected an error containing %q, got %v", profile, want, err)
+		}
+	}
+}
+
+func TestResolve_MFASessionSectionReservedInRoleModeOnly(t *testing.T) {
+	store, err := credentials.Load(filepath.Join(t.TempDir(), "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("prod-long-term", "aws_mfa_device", "device")
+	in := Inputs{Profile: "prod", ProfileChanged: true, LongTermSuffix: "long-term", ShortTermSuffix: "mfa-session"}
+
+	got, err := Resolve(context.Background(), in, mapEnv{}, store)
+	if err != nil || got.ShortTermSection != "prod-mfa-session" {
+		t.Fatalf("expected [prod-mfa-session] as short-term section in session mode, got %q, %v", got.ShortTermSection, err)
+	}
+
+	in.AssumeRole, in.AssumeRoleChanged = "arn:aws:iam::123456789012:role/admin", true
+	if _, err := Resolve(context.Background(), in, mapEnv{}, store); err == nil || !strings.Contains(err.Error(), "reserved for the cached MFA session") {
+		t.Fatalf("expected a reserved section error in role mode, got %v", err)
+	}
+}
+
+func TestResolve_SessionTagsNeedRoleMode(t *testing.T) {
+	store, err := credentials.Load(filepath.Join(t.TempDir(), "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("prod-long-term", "aws_mfa_device", "device")
+	base := Inputs{Profile: "prod", ProfileChanged: true, LongTermSuffix: "long-term"}
+
+	withTag := base
+	withTag.SessionTags, withTag.SessionTagsChanged = []string{"team=platform"}, true
+	for name, tc := range map[string]struct {
+		in  Inputs
+		env mapEnv
+	}{
+		"tag flag":            {in: withTag},
+		"transitive tag env":  {in: base, env: mapEnv{"MFA_TRANSITIVE_TAG_KEYS": "team"}},
+		"source identity env": {in: base, env: mapEnv{"MFA_SOURCE_IDENTITY": "jane"}},
+	} {
+		if _, err := Resolve(context.Background(), tc.in, tc.env, store); err == nil || !strings.Contains(err.Error(), "not supported in") {
+			t.Fatalf("%s: expected an unsupported mode error, got %v", name, err)
+		}
+	}
+
+	withTag.AssumeRole, withTag.AssumeRoleChanged = "arn:aws:iam::123456789012:role/admin", true
+	got, err := Resolve(context.Background(), withTag, mapEnv{}, store)
+	if err != nil || len(got.SessionTags) != 1 {
+		t.Fatalf("expected the tag in role mode, got %+v, %v", got.SessionTags, err)
+	}
+}
+
+func TestResolve_SessionTagFlagsKeepCommas(t *testing.T) {
+	store, err := credentials.Load(filepath.Join(t.TempDir(), "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("prod-long-term", "aws_mfa_device", "device")
+	store.Set("prod-long-term", "assume_role", "arn:aws:iam::123456789012:role/admin")
+	store.Set("prod-long-term", "session_tags", "team=platform, project=x")
+	in := Inputs{Profile: "prod", ProfileChanged: true, LongTermSuffix: "long-term"}
+
+	got, err := Resolve(context.Background(), in, mapEnv{}, store)
+	if err != nil || len(got.SessionTags) != 2 || got.SessionTags[1].Value != "x" {
+		t.Fatalf("expected the profile key to be split on commas, got %+v, %v", got.SessionTags, err)
+	}
+
+	in.SessionTags, in.SessionTagsChanged = []string{"Team=a,b", "cost-center=42"}, true
+	got, err = Resolve(context.Background(), in, mapEnv{"MFA_SESSION_TAGS": "ignored=1"}, store)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(got.SessionTags) != 2 || got.SessionTags[0].Key != "Team" || got.SessionTags[0].Value != "a,b" {
+		t.Fatalf("expected each --tag to be one tag, got %+v", got.SessionTags)
+	}
+}
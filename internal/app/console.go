@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/console"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+type ConsoleInputs struct {
+	// Only the profile, suffix, credentials file and timeout fields are used.
+	Inputs
+
+	// Destination is a console path (for example /ec2/home) or https URL.
+	Destination string
+	// Print prints the sign-in URL instead of opening a browser.
+	Print bool
+
+	// FederationURL overrides the partition's federation endpoint.
+	FederationURL        string
+	FederationURLChanged bool
+}
+
+// Console exchanges the short-term credentials of a profile for an AWS
+// Management Console sign-in URL and opens it (or prints it with Print).
+func Console(ctx context.Context, in ConsoleInputs, deps Deps) error {
+	if deps.Now == nil || deps.Env == nil {
+		return errors.New("missing required dependencies")
+	}
+	if deps.Stdout == nil {
+		deps.Stdout = io.Discard
+	}
+	if deps.Stderr == nil {
+		deps.Stderr = io.Discard
+	}
+
+	store, err := credentials.Load(ExpandHome(in.CredentialsFile))
+	if err != nil {
+		return configError(err)
+	}
+
+	profile := resolveProfile(in.Inputs, deps.Env)
+	names, err := credentials.ComputeSectionNames(profile, in.LongTermSuffix, in.ShortTermSuffix)
+	if err != nil {
+		return configError(err)
+	}
+
+	creds, err := sectionCredentials(store, names.ShortTerm)
+	if err == nil && creds.SessionToken == "" {
+		err = fmt.Errorf("missing %q in [%s]", "aws_session_token", names.ShortTerm)
+	}
+	if err != nil {
+		return configError(fmt.Errorf("short-term section [%s] has no temporary credentials, run aws-mfa-go first: %w", names.ShortTerm, err))
+	}
+	if storedMode(store, names.ShortTerm) == ModeSession {
+		return configError(fmt.Errorf("short-term section [%s] holds an MFA session token, which the console does not accept: use role or federation mode", names.ShortTerm))
+	}
+	if v, ok := store.Get(names.ShortTerm, "expiration"); ok {
+		if exp, err := ParseExpiration(v); err == nil && !exp.After(deps.Now().UTC()) {
+			return configError(fmt.Errorf("credentials in [%s] expired at %s, run aws-mfa-go first", names.ShortTerm, exp.Format(expirationLayout)))
+		}
+	}
+
+	federationURL, consoleURL := console.DefaultEndpoints(storedPartition(store, names))
+	if v := pick(in.FederationURL, in.FederationURLChanged, deps.Env.Get("MFA_FEDERATION_URL"), store, names.LongTerm, "federation_url"); v != "" {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return configError(fmt.Errorf("invalid federation URL %q: expected http(s)://host[:port]/path", v))
+		}
+		federationURL = v
+	}
+	destination, err := console.Destination(consoleURL, in.Destination)
+	if err != nil {
+		return configError(err)
+	}
+
+	httpSettings, err := resolveHTTP(deps.Env, store, names.LongTerm)
+	if err != nil {
+		return configError(err)
+	}
+	client, err := awssts.NewHTTPClient(awssts.Options{
+		HTTPSProxy: httpSettings.HTTPSProxy,
+		HTTPProxy:  httpSettings.HTTPProxy,
+		NoProxy:    httpSettings.NoProxy,
+		CABundle:   httpSettings.CABundle,
+	})
+	if err != nil {
+		return configError(err)
+	}
+
+	if in.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, in.Timeout)
+		defer cancel()
+	}
+	token, err := console.SigninToken(ctx, client, federationURL, creds)
+	if err != nil {
+		return err
+	}
+	loginURL := console.LoginURL(federationURL, token, destination)
+
+	if in.Print || deps.OpenBrowser == nil {
+		_, _ = fmt.Fprintln(deps.Stdout, loginURL)
+		return nil
+	}
+	_, _ = fmt.Fprintf(deps.Stdout, "🌐 Opening the AWS console for [%s] in your browser.\n", names.ShortTerm)
+	if err := deps.OpenBrowser(loginURL); err != nil {
+		_, _ = fmt.Fprintf(deps.Stderr, "⚠️ Could not open a browser (%v), open this URL instead:\n", err)
+		_, _ = fmt.Fprintln(deps.Stdout, loginURL)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+func TestConsole_PrintsSigninURLFromStub(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"SigninToken":"TOKEN123"}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	store.Set("prod", "aws_access_key_id", "ASIA_ST")
+	store.Set("prod", "aws_secret_access_key", "SECRET_ST")
+	store.Set("prod", "aws_session_token", "TOKEN_ST")
+	store.Set("prod", "expiration", now.Add(time.Hour).Format(expirationLayout))
+	store.Set("prod", "assumed_role", "True")
+	store.Set("prod", "mode", ModeRole)
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"MFA_FEDERATION_URL": srv.URL + "/federation"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = &stdout
+	deps.OpenBrowser = func(string) error {
+		t.Fatalf("expected --print not to open a browser")
+		return nil
+	}
+
+	in := ConsoleInputs{
+		Inputs: Inputs{
+			Profile:         "prod",
+			ProfileChanged:  true,
+			LongTermSuffix:  "long-term",
+			ShortTermSuffix: "none",
+			CredentialsFile: credsPath,
+		},
+		Destination: "/ec2/home",
+		Print:       true,
+	}
+	if err := Console(context.Background(), in, deps); err != nil {
+		t.Fatalf("Console: %v", err)
+	}
+	got := strings.TrimSpace(stdout.String())
+	if !strings.HasPrefix(got, srv.URL+"/federation?") || !strings.Contains(got, "SigninToken=TOKEN123") || !strings.Contains(got, "ec2%2Fhome") {
+		t.Fatalf("unexpected sign-in URL %q", got)
+	}
+
+	// GetSessionToken credentials are not accepted by the federation endpoint.
+	store.Set("prod", "assumed_role", "False")
+	store.Set("prod", "mode", ModeSession)
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+	err = Console(context.Background(), in, deps)
+	if err == nil || ExitCode(err) != ExitConfig {
+		t.Fatalf("expected a config error for an MFA session section, got %v", err)
+	}
+
+	// Static keys have no session token to exchange for a sign-in token.
+	store.DeleteKey("prod", "aws_session_token")
+	store.Set("prod", "mode", ModeRole)
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+	err = Console(context.Background(), in, deps)
+	if err == nil || ExitCode(err) != ExitConfig || !strings.Contains(err.Error(), "aws_session_token") {
+		t.Fatalf("expected a config error for a section without a session token, got %v", err)
+	}
+}
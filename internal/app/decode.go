@@ -0,0 +1,140 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type DecodeInputs struct {
+	// Only the profile, suffix and credentials file fields are used.
+	Inputs
+	Region string
+	// Message is the encoded message; "" or "-" reads it from Stdin.
+	Message string
+	// JSON prints only the decoded document.
+	JSON bool
+}
+
+// encodedMessagePrefix starts the encoded message in AWS error messages, so
+// whole error lines can be pasted.
+const encodedMessagePrefix = "Encoded authorization failure message:"
+
+// authorizationMessage is the part of a decoded authorization message that
+// DecodeAuthMessage summarizes.
+type authorizationMessage struct {
+	Allowed      bool `json:"allowed"`
+	ExplicitDeny bool `json:"explicitDeny"`
+	Context      struct {
+		Principal struct {
+			ARN string `json:"arn"`
+		} `json:"principal"`
+		Action   string `json:"action"`
+		Resource string `json:"resource"`
+	} `json:"context"`
+	MatchedStatements struct {
+		Items []struct {
+			StatementID string    `json:"statementId"`
+			Effect      string    `json:"effect"`
+			Actions     valueList `json:"actions"`
+			Resources   valueList `json:"resources"`
+		} `json:"items"`
+	} `json:"matchedStatements"`
+}
+
+// valueList is the {"items": [{"value": ...}]} shape of lists in decoded messages.
+type valueList struct {
+	Items []struct {
+		Value string `json:"value"`
+	} `json:"items"`
+}
+
+func (l valueList) String() string {
+	values := make([]string, len(l.Items))
+	for i, item := range l.Items {
+		values[i] = item.Value
+	}
+	return strings.Join(values, ", ")
+}
+
+// DecodeAuthMessage decodes an "encoded authorization failure message" with
+// STS DecodeAuthorizationMessage, signed with the short-term credentials of a
+// profile. It prints a summary of the denied action, resource and matched
+// statements, followed by the indented document.
+func DecodeAuthMessage(ctx context.Context, in DecodeInputs, deps Deps) error {
+	if deps.Now == nil || deps.Env == nil || deps.STSFactory == nil {
+		return errors.New("missing required dependencies")
+	}
+	if deps.Stdout == nil {
+		deps.Stdout = io.Discard
+	}
+
+	encoded := in.Message
+	if encoded == "" || encoded == "-" {
+		if deps.Stdin == nil {
+			return configError(errors.New("missing encoded message"))
+		}
+		raw, err := io.ReadAll(deps.Stdin)
+		if err != nil {
+			return fmt.Errorf("read encoded message: %w", err)
+		}
+		encoded = string(raw)
+	}
+	if i := strings.Index(encoded, encodedMessagePrefix); i >= 0 {
+		encoded = encoded[i+len(encodedMessagePrefix):]
+	}
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return configError(errors.New("missing encoded message"))
+	}
+
+	c, err := newShortTermClient(ctx, in.Inputs, in.Region, deps)
+	if err != nil {
+		return err
+	}
+	decoded, err := c.STS.DecodeAuthorizationMessage(ctx, encoded)
+	if err != nil {
+		return err
+	}
+
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, []byte(decoded), "", "  "); err != nil {
+		return fmt.Errorf("decoded message is not JSON: %w", err)
+	}
+	if in.JSON {
+		_, _ = fmt.Fprintln(deps.Stdout, pretty.String())
+		return nil
+	}
+
+	var msg authorizationMessage
+	_ = json.Unmarshal([]byte(decoded), &msg)
+	switch {
+	case msg.Allowed:
+		_, _ = fmt.Fprintf(deps.Stdout, "✅ Allowed:   %s\n", msg.Context.Action)
+	case msg.ExplicitDeny:
+		_, _ = fmt.Fprintf(deps.Stdout, "🚫 Denied:    %s (explicit deny)\n", msg.Context.Action)
+	default:
+		_, _ = fmt.Fprintf(deps.Stdout, "🚫 Denied:    %s (no statement allows it)\n", msg.Context.Action)
+	}
+	_, _ = fmt.Fprintf(deps.Stdout, "📦 Resource:  %s\n", msg.Context.Resource)
+	_, _ = fmt.Fprintf(deps.Stdout, "👤 Principal: %s\n", msg.Context.Principal.ARN)
+	if items := msg.MatchedStatements.Items; len(items) > 0 {
+		_, _ = fmt.Fprintf(deps.Stdout, "📜 Matched statements (%d):\n", len(items))
+		for _, s := range items {
+			id := s.StatementID
+			if id == "" {
+				id = "(no Sid)"
+			}
+			_, _ = fmt.Fprintf(deps.Stdout, "   - %s %s: actions [%s] on [%s]\n", s.Effect, id, s.Actions, s.Resources)
+		}
+	} else {
+		_, _ = fmt.Fprintln(deps.Stdout, "📜 Matched statements: none")
+	}
+	_, _ = fmt.Fprintln(deps.Stdout)
+	_, _ = fmt.Fprintln(deps.Stdout, pretty.String())
+	return nil
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+func TestDecodeAuthMessage_SummarizesDecodedMessage(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	store.Set("prod", "aws_access_key_id", "ASIA_ST")
+	store.Set("prod", "aws_secret_access_key", "SECRET_ST")
+	store.Set("prod", "aws_session_token", "TOKEN_ST")
+	store.Set("prod", "expiration", now.Add(time.Hour).Format(expirationLayout))
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	fake := &fakeSTS{decoded: `{"allowed":false,"explicitDeny":true,` +
+		`"matchedStatements":{"items":[{"statementId":"DenyDelete","effect":"DENY",` +
+		`"actions":{"items":[{"value":"s3:DeleteObject"}]},"resources":{"items":[{"value":"arn:aws:s3:::logs/*"}]}}]},` +
+		`"context":{"principal":{"arn":"arn:aws:sts::123456789012:assumed-role/dev/me"},` +
+		`"action":"s3:DeleteObject","resource":"arn:aws:s3:::logs/app.log"}}`}
+	var gotCreds awssts.Credentials
+	var stdout bytes.Buffer
+	deps := DefaultDeps()
+	deps.Env = mapEnv{}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = &stdout
+	deps.Stdin = strings.NewReader("An error occurred (AccessDenied). Encoded authorization failure message: ENCODED123\n")
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		gotCreds = creds
+		return fake, nil
+	}
+
+	in := DecodeInputs{Inputs: Inputs{
+		Profile:         "prod",
+		ProfileChanged:  true,
+		LongTermSuffix:  "long-term",
+		ShortTermSuffix: "none",
+		CredentialsFile: credsPath,
+	}}
+	if err := DecodeAuthMessage(context.Background(), in, deps); err != nil {
+		t.Fatalf("DecodeAuthMessage: %v", err)
+	}
+	if gotCreds.SessionToken != "TOKEN_ST" {
+		t.Fatalf("expected short-term credentials to be used, got %+v", gotCreds)
+	}
+	if len(fake.gotDecode) != 1 || fake.gotDecode[0] != "ENCODED123" {
+		t.Fatalf("expected the prefix to be stripped, got %v", fake.gotDecode)
+	}
+	for _, want := range []string{
+		"s3:DeleteObject (explicit deny)",
+		"arn:aws:s3:::logs/app.log",
+		"assumed-role/dev/me",
+		"DENY DenyDelete: actions [s3:DeleteObject] on [arn:aws:s3:::logs/*]",
+		`  "explicitDeny": true`,
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	in.Message = "ENCODED456"
+	in.JSON = true
+	if err := DecodeAuthMessage(context.Background(), in, deps); err != nil {
+		t.Fatalf("DecodeAuthMessage (json): %v", err)
+	}
+	if !strings.HasPrefix(stdout.String(), "{\n") || strings.Contains(stdout.String(), "Denied") {
+		t.Fatalf("expected only the JSON document, got:\n%s", stdout.String())
+	}
+}
+
+func TestDecodeAuthMessage_EmptyMessage(t *testing.T) {
+	deps := DefaultDeps()
+	deps.Env = mapEnv{}
+	deps.Stdin = strings.NewReader("  \n")
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		t.Fatalf("STS should not be called")
+		return nil, nil
+	}
+	err := DecodeAuthMessage(context.Background(), DecodeInputs{Inputs: Inputs{
+		Profile:         "prod",
+		ProfileChanged:  true,
+		CredentialsFile: filepath.Join(t.TempDir(), "credentials"),
+	}}, deps)
+	if ExitCode(err) != 2 {
+		t.Fatalf("expected a config error, got %v", err)
+	}
+}
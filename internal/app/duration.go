@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+// STS limits on requested session durations, in seconds.
+const (
+	minDuration = 900
+	// maxSessionTokenDuration applies to GetSessionToken and GetFederationToken.
+	maxSessionTokenDuration = 129600
+	// maxRoleDuration applies to roles allowing the longest MaxSessionDuration.
+	maxRoleDuration = 43200
+)
+
+// parseDuration parses a duration in seconds ("3600") or a Go duration
+// ("8h", "1h30m") into seconds.
+func parseDuration(v string) (int32, error) {
+	v = strings.TrimSpace(v)
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		d, derr := time.ParseDuration(v)
+		if derr != nil {
+			return 0, errors.New("expected seconds or a duration such as 8h")
+		}
+		if d%time.Second != 0 {
+			return 0, errors.New("must be whole seconds")
+		}
+		n = int64(d / time.Second)
+	}
+	if n <= 0 {
+		return 0, errors.New("must be positive")
+	}
+	if n > math.MaxInt32 {
+		return 0, errors.New("too large")
+	}
+	return int32(n), nil //nolint:gosec // G115: bounded by MaxInt32 check above
+}
+
+// resolveDuration resolves a duration in seconds with the precedence
+// flag > environment variable > long-term section key > default.
+// Pass a nil store to skip the long-term section lookup.
+func resolveDuration(flagValue string, flagChanged bool, envName string, env Env, store *credentials.Store, section, key string, def int32) (int32, error) {
+	if flagChanged && strings.TrimSpace(flagValue) != "" {
+		d, err := parseDuration(flagValue)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", flagValue, err)
+		}
+		return d, nil
+	}
+	if v := strings.TrimSpace(env.Get(envName)); v != "" {
+		d, err := parseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %w", envName, v, err)
+		}
+		return d, nil
+	}
+	if store != nil {
+		if v, ok := store.Get(section, key); ok && v != "" {
+			d, err := parseDuration(v)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s %q in [%s]: %w", key, v, section, err)
+			}
+			return d, nil
+		}
+	}
+	return def, nil
+}
+
+// durationLimit returns the longest duration STS grants the credentials a
+// mode requests, and what imposes it. It returns 0 in sso mode, where the
+// permission set decides.
+func durationLimit(mode string, chained bool) (int32, string) {
+	switch mode {
+	case ModeSession:
+		return maxSessionTokenDuration, "the GetSessionToken maximum"
+	case ModeFederation:
+		return maxSessionTokenDuration, "the GetFederationToken maximum"
+	case ModeRole:
+		if chained {
+			return chainedRoleMaxDuration, "the role chaining maximum"
+		}
+		return maxRoleDuration, "the AssumeRole maximum"
+	case ModeWebIdentity, ModeOIDC:
+		return maxRoleDuration, "the AssumeRoleWithWebIdentity maximum"
+	case ModeSAML:
+		return maxRoleDuration, "the AssumeRoleWithSAML maximum"
+	case ModeRolesAnywhere:
+		return maxRoleDuration, "the IAM Roles Anywhere maximum"
+	default:
+		return 0, ""
+	}
+}
+
+// limitDuration checks that a duration lies between minDuration and longest.
+// With clamp set, a duration out of range is adjusted instead and the
+// returned note says so.
+func limitDuration(name string, d, longest int32, limit string, clamp bool) (int32, string, error) {
+	switch {
+	case d < minDuration:
+		if !clamp {
+			return 0, "", fmt.Errorf("%s %ds is below the STS minimum of %ds (set clamp_duration to adjust it)", name, d, minDuration)
+		}
+		return minDuration, fmt.Sprintf("Raised the %s from %ds to the STS minimum of %ds", name, d, minDuration), nil
+	case d > longest:
+		if !clamp {
+			return 0, "", fmt.Errorf("%s %ds exceeds %s of %ds (set clamp_duration to adjust it)", name, d, limit, longest)
+		}
+		return longest, fmt.Sprintf("Lowered the %s from %ds to %s of %ds", name, d, limit, longest), nil
+	default:
+		return d, "", nil
+	}
+}
+
+// limitRoleDuration checks the requested duration against the
+// MaxSessionDuration of the target role, which is read with IAM GetRole when
+// the role belongs to the account of the MFA device. Lookup failures are
+// ignored: the caller may not be permitted to read the role, and AssumeRole
+// enforces the limit anyway.
+func limitRoleDuration(ctx context.Context, deps Deps, opts awssts.Options, longTerm awssts.Credentials, resolved *Resolved) error {
+	if resolved.Mode != ModeRole || len(resolved.RoleChain) > 0 || deps.IAMFactory == nil {
+		return nil
+	}
+	// Every role allows sessions of at least an hour.
+	if resolved.DurationSeconds <= chainedRoleMaxDuration {
+		return nil
+	}
+	account := accountFromARN(resolved.RoleARN)
+	if account == "" || account != accountFromARN(resolved.Device) {
+		return nil
+	}
+	name := resolved.RoleARN[strings.LastIndex(resolved.RoleARN, "/")+1:]
+
+	iamClient, err := deps.IAMFactory(ctx, opts, longTerm)
+	if err != nil {
+		return nil
+	}
+	role, err := iamClient.GetRole(ctx, name)
+	if err != nil || role.MaxSessionDuration <= 0 {
+		return nil
+	}
+	d, note, err := limitDuration("duration", resolved.DurationSeconds, role.MaxSessionDuration,
+		"the MaxSessionDuration of role "+name, resolved.ClampDuration)
+	if err != nil {
+		return configError(err)
+	}
+	if note != "" {
+		_, _ = fmt.Fprintf(deps.Stdout, "⏱️ %s.\n", note)
+	}
+	resolved.DurationSeconds = d
+	return nil
+}
+
+// accountFromARN returns the account ID of an ARN
+// (arn:<partition>:<service>:<region>:<account>:...), or "" when s is not an ARN.
+func accountFromARN(s string) string {
+	parts := strings.SplitN(strings.TrimSpace(s), ":", 6)
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[4]
+}
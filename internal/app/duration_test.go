@@ -0,0 +1,157 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int32
+		wantErr bool
+	}{
+		{in: "3600", want: 3600},
+		{in: " 8h ", want: 28800},
+		{in: "1h30m", want: 5400},
+		{in: "0", wantErr: true},
+		{in: "-5m", wantErr: true},
+		{in: "1.5s", wantErr: true},
+		{in: "eight hours", wantErr: true},
+		{in: "9999999999", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDuration(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestResolve_DurationLimits(t *testing.T) {
+	store, err := credentials.Load(filepath.Join(t.TempDir(), "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("default-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/me")
+	in := Inputs{Profile: "default", ProfileChanged: true, LongTermSuffix: "long-term"}
+
+	in.Duration, in.DurationChanged = "8h", true
+	got, err := Resolve(context.Background(), in, mapEnv{}, store)
+	if err != nil || got.DurationSeconds != 28800 || len(got.DurationNotes) != 0 {
+		t.Fatalf("expected 8h as 28800 seconds, got %d, %v", got.DurationSeconds, err)
+	}
+
+	in.Duration = "48h"
+	if _, err := Resolve(context.Background(), in, mapEnv{}, store); err == nil || !strings.Contains(err.Error(), "GetSessionToken maximum of 129600s") {
+		t.Fatalf("expected the GetSessionToken maximum error, got %v", err)
+	}
+	got, err = Resolve(context.Background(), in, mapEnv{"MFA_CLAMP_DURATION": "true"}, store)
+	if err != nil || got.DurationSeconds != 129600 || len(got.DurationNotes) != 1 {
+		t.Fatalf("expected a clamped 129600 with a note, got %d %q, %v", got.DurationSeconds, got.DurationNotes, err)
+	}
+
+	in.Duration = "600"
+	in.ClampDuration, in.ClampDurationChanged = true, true
+	got, err = Resolve(context.Background(), in, mapEnv{}, store)
+	if err != nil || got.DurationSeconds != 900 {
+		t.Fatalf("expected the minimum of 900, got %d, %v", got.DurationSeconds, err)
+	}
+
+	// Role chaining caps the target role at an hour.
+	in.Duration = "2h"
+	in.ClampDuration, in.ClampDurationChanged = false, false
+	in.RoleChain, in.RoleChainChanged = "arn:aws:iam::123456789012:role/a,arn:aws:iam::123456789012:role/b", true
+	if _, err := Resolve(context.Background(), in, mapEnv{}, store); err == nil || !strings.Contains(err.Error(), "role chaining maximum of 3600s") {
+		t.Fatalf("expected the role chaining maximum error, got %v", err)
+	}
+	store.Set("default-long-term", "clamp_duration", "true")
+	got, err = Resolve(context.Background(), in, mapEnv{}, store)
+	if err != nil || got.DurationSeconds != 3600 {
+		t.Fatalf("expected a clamped 3600, got %d, %v", got.DurationSeconds, err)
+	}
+
+	in.RoleChain, in.RoleChainChanged = "", false
+	in.AssumeRole, in.AssumeRoleChanged = "arn:aws:iam::123456789012:role/b", true
+	in.Duration, in.DurationChanged = "", false
+	in.SessionDuration, in.SessionDurationChanged = "40h", true
+	got, err = Resolve(context.Background(), in, mapEnv{}, store)
+	if err != nil || got.SessionDuration != 129600 || got.DurationSeconds != 3600 {
+		t.Fatalf("expected a clamped MFA session duration, got %d and %d, %v", got.SessionDuration, got.DurationSeconds, err)
+	}
+}
+
+func TestRun_LimitsDurationToRoleMaxSessionDuration(t *testing.T) {
+	for _, clamp := range []bool{false, true} {
+		credsPath := filepath.Join(t.TempDir(), "credentials")
+		store, err := credentials.Load(credsPath)
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		store.Set("prod-long-term", "aws_access_key_id", "AKIA_LT")
+		store.Set("prod-long-term", "aws_secret_access_key", "SECRET_LT")
+		store.Set("prod-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/me")
+		store.Set("prod-long-term", "assume_role", "arn:aws:iam::123456789012:role/ops/admin")
+		if err := store.SaveAtomic(); err != nil {
+			t.Fatalf("SaveAtomic: %v", err)
+		}
+
+		exp := time.Date(2026, 2, 9, 13, 0, 0, 0, time.UTC)
+		fake := &fakeSTS{
+			out:     awssts.GetSessionTokenOutput{AccessKeyID: "ASIA_SESSION", SecretAccessKey: "SECRET_SESSION", SessionToken: "TOKEN_SESSION", Expiration: exp},
+			roleOut: awssts.AssumeRoleOutput{AccessKeyID: "ASIA_ROLE", SecretAccessKey: "SECRET_ROLE", SessionToken: "TOKEN_ROLE", Expiration: exp},
+		}
+		iam := &fakeIAM{role: awsiam.Role{RoleName: "admin", MaxSessionDuration: 7200}}
+		var stdout strings.Builder
+		deps := DefaultDeps()
+		deps.Env = mapEnv{"AWS_REGION": "us-east-1", "USER": "jane"}
+		deps.Now = func() time.Time { return time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC) }
+		deps.Stdout = &stdout
+		deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+			return fake, nil
+		}
+		deps.IAMFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awsiam.Client, error) {
+			return iam, nil
+		}
+
+		err = Run(context.Background(), RunInputs{Inputs: Inputs{
+			Profile:              "prod",
+			ProfileChanged:       true,
+			LongTermSuffix:       "long-term",
+			ShortTermSuffix:      "none",
+			CredentialsFile:      credsPath,
+			Token:                "123456",
+			TokenChanged:         true,
+			Duration:             "8h",
+			DurationChanged:      true,
+			ClampDuration:        clamp,
+			ClampDurationChanged: true,
+		}}, deps)
+
+		if len(iam.gotRole) != 1 || iam.gotRole[0] != "admin" {
+			t.Fatalf("expected GetRole for admin, got %q", iam.gotRole)
+		}
+		if !clamp {
+			if ExitCode(err) != ExitConfig || !strings.Contains(err.Error(), "MaxSessionDuration of role admin of 7200s") || fake.calls != 0 {
+				t.Fatalf("expected a config error before any STS call, got %v after %d calls", err, fake.calls)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if len(fake.gotRole) != 1 || fake.gotRole[0].DurationSeconds != 7200 {
+			t.Fatalf("expected AssumeRole for 7200 seconds, got %+v", fake.gotRole)
+		}
+		if !strings.Contains(stdout.String(), "Lowered the duration from 28800s") {
+			t.Fatalf("expected a note about the lowered duration, got %q", stdout.String())
+		}
+	}
+}
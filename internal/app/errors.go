@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+)
+
+// Exit codes of the CLI. They are part of the interface wrapper scripts rely
+// on (see the README), so never renumber them.
+const (
+	ExitOK                 = 0
+	ExitError              = 1
+	ExitConfig             = 2
+	ExitInvalidMFA         = 3
+	ExitInvalidCredentials = 4
+	ExitAccessDenied       = 5
+	ExitThrottled          = 6
+	ExitNetwork            = 7
+	ExitCanceled           = 130
+)
+
+// ConfigError marks a problem with the local configuration: flags,
+// environment variables or the credentials file.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string { return e.Err.Error() }
+
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+func configError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ConfigError{Err: err}
+}
+
+// errInvalidToken is returned for MFA codes rejected before calling STS.
+var errInvalidToken = errors.New("token must be six digits")
+
+// ExitCode maps an error returned by this package to the process exit code.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if errors.Is(err, context.Canceled) {
+		return ExitCanceled
+	}
+	if errors.Is(err, errInvalidToken) {
+		return ExitInvalidMFA
+	}
+	var cfgErr *ConfigError
+	if errors.As(err, &cfgErr) {
+		return ExitConfig
+	}
+	var stsErr *awssts.Error
+	if errors.As(err, &stsErr) {
+		switch stsErr.Kind {
+		case awssts.KindInvalidMFA:
+			return ExitInvalidMFA
+		case awssts.KindInvalidCredentials:
+			return ExitInvalidCredentials
+		case awssts.KindAccessDenied:
+			return ExitAccessDenied
+		case awssts.KindThrottled:
+			return ExitThrottled
+		case awssts.KindNetwork:
+			return ExitNetwork
+		}
+	}
+	return ExitError
+}
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, ExitOK},
+		{"generic", errors.New("boom"), ExitError},
+		{"config", configError(errors.New("missing MFA device")), ExitConfig},
+		{"bad token", fmt.Errorf("prompt: %w", errInvalidToken), ExitInvalidMFA},
+		{"invalid mfa", &awssts.Error{Op: "get-session-token", Kind: awssts.KindInvalidMFA, Err: errors.New("x")}, ExitInvalidMFA},
+		{"invalid credentials", &awssts.Error{Op: "get-session-token", Kind: awssts.KindInvalidCredentials, Err: errors.New("x")}, ExitInvalidCredentials},
+		{"access denied", fmt.Errorf("verify: %w", &awssts.Error{Op: "assume-role", Kind: awssts.KindAccessDenied, Err: errors.New("x")}), ExitAccessDenied},
+		{"throttled", &awssts.Error{Op: "assume-role", Kind: awssts.KindThrottled, Err: errors.New("x")}, ExitThrottled},
+		{"network", &awssts.Error{Op: "assume-role", Kind: awssts.KindNetwork, Err: errors.New("x")}, ExitNetwork},
+		{"canceled", &awssts.Error{Op: "assume-role", Err: context.Canceled}, ExitCanceled},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+type KeysAuditInputs struct {
+	// Only the suffix and credentials file fields are used, and the profile
+	// if ProfileChanged: without --profile, every long-term section is
+	// audited (AWS_PROFILE is ignored).
+	Inputs
+	// Region is optional; if empty, we will fall back to env, the region key
+	// in the long-term section, then the default region of the partition.
+	Region string
+
+	// MaxAgeDays is the age above which keys are reported:
+	// flag > MFA_KEY_MAX_AGE_DAYS > defaultKeyMaxAgeDays.
+	MaxAgeDays        int
+	MaxAgeDaysChanged bool
+	JSON              bool
+}
+
+const defaultKeyMaxAgeDays = 90
+
+// quarantinePolicyPrefix matches the AWSCompromisedKeyQuarantine policies
+// (and their V2, V3 versions) AWS attaches to users whose key was exposed.
+const quarantinePolicyPrefix = "AWSCompromisedKeyQuarantine"
+
+// KeyAuditResult is the audit of one long-term section, printed by KeysAudit
+// (as JSON with --json).
+type KeyAuditResult struct {
+	Section         string `json:"section"`
+	UserName        string `json:"user_name,omitempty"`
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	CreateDate      string `json:"create_date,omitempty"`
+	AgeDays         int    `json:"age_days"`
+	LastUsed        string `json:"last_used,omitempty"`
+	LastUsedService string `json:"last_used_service,omitempty"`
+	// Warnings lists the findings; it is empty for a healthy key.
+	Warnings []string `json:"warnings"`
+	// Error is set when the section could not be audited.
+	Error string `json:"error,omitempty"`
+}
+
+// KeysAudit reports, for each long-term section, the age and last use of its
+// access key, and warns about keys older than the maximum age, a second
+// active key of the same user, and attached quarantine policies.
+func KeysAudit(ctx context.Context, in KeysAuditInputs, deps Deps) error {
+	if deps.Now == nil || deps.Env == nil || deps.IAMFactory == nil {
+		return errors.New("missing required dependencies")
+	}
+	if deps.Stdout == nil {
+		deps.Stdout = io.Discard
+	}
+
+	maxAge := defaultKeyMaxAgeDays
+	if in.MaxAgeDaysChanged {
+		maxAge = in.MaxAgeDays
+	} else if v := strings.TrimSpace(deps.Env.Get("MFA_KEY_MAX_AGE_DAYS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return configError(fmt.Errorf("invalid MFA_KEY_MAX_AGE_DAYS %q: %w", v, err))
+		}
+		maxAge = n
+	}
+	if maxAge <= 0 {
+		return configError(fmt.Errorf("invalid maximum key age %d: must be positive", maxAge))
+	}
+
+	profiles, err := auditedProfiles(in.Inputs)
+	if err != nil {
+		return configError(err)
+	}
+	if len(profiles) == 0 {
+		return configError(fmt.Errorf("no [*-%s] sections in %s", in.LongTermSuffix, in.CredentialsFile))
+	}
+
+	now := deps.Now().UTC()
+	results := make([]KeyAuditResult, 0, len(profiles))
+	failed := 0
+	for _, profile := range profiles {
+		sectionIn := in.Inputs
+		sectionIn.Profile = profile
+		sectionIn.ProfileChanged = true
+		res := auditKey(ctx, sectionIn, in.Region, maxAge, now, deps)
+		if res.Error != "" {
+			failed++
+		}
+		results = append(results, res)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	if in.JSON {
+		enc := json.NewEncoder(deps.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else {
+		printKeyAudit(deps.Stdout, results)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d sections could not be audited", failed, len(results))
+	}
+	return nil
+}
+
+// auditedProfiles returns the profile given with --profile, or those of all
+// long-term sections in the credentials file.
+func auditedProfiles(in Inputs) ([]string, error) {
+	if in.ProfileChanged && strings.TrimSpace(in.Profile) != "" {
+		return []string{strings.TrimSpace(in.Profile)}, nil
+	}
+	suffix := strings.TrimSpace(in.LongTermSuffix)
+	if suffix == "" || strings.EqualFold(suffix, "none") {
+		return nil, errors.New("long-term sections cannot be told apart without a long-term suffix: set --profile")
+	}
+	store, err := credentials.Load(ExpandHome(in.CredentialsFile))
+	if err != nil {
+		return nil, err
+	}
+	var profiles []string
+	for _, name := range store.Sections() {
+		// Profiles with a source_profile have no keys of their own.
+		if v, _ := store.Get(name, "source_profile"); strings.TrimSpace(v) != "" {
+			continue
+		}
+		if p := strings.TrimSuffix(name, "-"+suffix); p != name && p != "" {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles, nil
+}
+
+// auditKey audits the long-term section of one profile. Failures are
+// reported in the result, so the other sections are still audited.
+func auditKey(ctx context.Context, in Inputs, region string, maxAge int, now time.Time, deps Deps) KeyAuditResult {
+	res := KeyAuditResult{Warnings: []string{}}
+	fail := func(err error) KeyAuditResult {
+		res.Error = err.Error()
+		return res
+	}
+
+	c, err := newLongTermClient(ctx, in, region, deps)
+	if err != nil {
+		if names, nameErr := credentials.ComputeSectionNames(in.Profile, in.LongTermSuffix, in.ShortTermSuffix); nameErr == nil {
+			res.Section = names.LongTerm
+		}
+		return fail(err)
+	}
+	res.Section = c.Names.LongTerm
+	res.AccessKeyID = c.Credentials.AccessKeyID
+	if c.Credentials.SessionToken != "" {
+		return fail(errors.New("section holds temporary credentials, not long-term keys"))
+	}
+
+	user, err := c.IAM.GetUser(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	res.UserName = user.UserName
+
+	keys, err := c.IAM.ListAccessKeys(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	for _, k := range keys {
+		if k.AccessKeyID == res.AccessKeyID {
+			res.CreateDate = k.CreateDate.Format(time.RFC3339)
+			res.AgeDays = int(now.Sub(k.CreateDate).Hours() / 24)
+			if res.AgeDays > maxAge {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("key is %d days old (max %d)", res.AgeDays, maxAge))
+			}
+			continue
+		}
+		if k.Status != awsiam.StatusActive {
+			continue
+		}
+		used, err := c.IAM.GetAccessKeyLastUsed(ctx, k.AccessKeyID)
+		if err != nil {
+			return fail(err)
+		}
+		res.Warnings = append(res.Warnings, fmt.Sprintf("second active key %s, last used %s", k.AccessKeyID, formatLastUsed(used.LastUsed)))
+	}
+
+	used, err := c.IAM.GetAccessKeyLastUsed(ctx, res.AccessKeyID)
+	if err != nil {
+		return fail(err)
+	}
+	if !used.LastUsed.IsZero() {
+		res.LastUsed = used.LastUsed.Format(time.RFC3339)
+		res.LastUsedService = used.ServiceName
+	}
+
+	policies, err := c.IAM.ListAttachedUserPolicies(ctx, user.UserName)
+	if err != nil {
+		return fail(err)
+	}
+	for _, p := range policies {
+		if strings.HasPrefix(p.PolicyName, quarantinePolicyPrefix) {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("%s is attached: AWS considers a key of this user exposed", p.PolicyName))
+		}
+	}
+	return res
+}
+
+func formatLastUsed(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format("2006-01-02")
+}
+
+// printKeyAudit prints the results as a table, followed by a summary.
+func printKeyAudit(w io.Writer, results []KeyAuditResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SECTION\tUSER\tACCESS KEY\tAGE\tLAST USED\tFINDINGS")
+	warned := 0
+	for _, r := range results {
+		if r.Error != "" {
+			warned++
+			_, _ = fmt.Fprintf(tw, "%s\t-\t%s\t-\t-\t❌ %s\n", r.Section, dash(r.AccessKeyID), r.Error)
+			continue
+		}
+		lastUsed := "never"
+		if r.LastUsed != "" {
+			lastUsed = r.LastUsed[:len("2006-01-02")]
+			if r.LastUsedService != "" {
+				lastUsed += " (" + r.LastUsedService + ")"
+			}
+		}
+		findings := "✅ ok"
+		if len(r.Warnings) > 0 {
+			warned++
+			findings = "⚠️ " + strings.Join(r.Warnings, "; ")
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%dd\t%s\t%s\n", r.Section, r.UserName, r.AccessKeyID, r.AgeDays, lastUsed, findings)
+	}
+	_ = tw.Flush()
+
+	if warned == 0 {
+		_, _ = fmt.Fprintf(w, "\n✅ No findings in %d sections.\n", len(results))
+		return
+	}
+	_, _ = fmt.Fprintf(w, "\n⚠️ %d of %d sections need attention.\n", warned, len(results))
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+func TestKeysAudit_ReportsEveryLongTermSection(t *testing.T) {
+	credsPath := filepath.Join(t.TempDir(), "credentials")
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("prod-long-term", "aws_access_key_id", "AKIA_PROD")
+	store.Set("prod-long-term", "aws_secret_access_key", "SECRET_PROD")
+	store.Set("prod", "aws_access_key_id", "ASIA_PROD")
+	store.Set("dev-long-term", "aws_access_key_id", "AKIA_DEV")
+	store.Set("dev-long-term", "aws_secret_access_key", "SECRET_DEV")
+	// Profiles with a source_profile have no key to audit.
+	store.Set("dev-admin-long-term", "source_profile", "dev")
+	store.Set("dev-admin-long-term", "assume_role", "arn:aws:iam::123456789012:role/admin")
+	store.Set("broken-long-term", "aws_access_key_id", "AKIA_BROKEN")
+	store.Set("broken-long-term", "aws_secret_access_key", "SECRET_BROKEN")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	prod := &fakeIAM{
+		user: awsiam.User{UserName: "alice"},
+		keys: []awsiam.AccessKey{
+			{AccessKeyID: "AKIA_PROD", Status: awsiam.StatusActive, CreateDate: now.AddDate(0, 0, -120)},
+			{AccessKeyID: "AKIA_FORGOTTEN", Status: awsiam.StatusActive, CreateDate: now.AddDate(-1, 0, 0)},
+		},
+		lastUsed: map[string]time.Time{"AKIA_PROD": now.AddDate(0, 0, -1)},
+		policies: []awsiam.AttachedPolicy{{PolicyName: "AWSCompromisedKeyQuarantineV2"}},
+	}
+	dev := &fakeIAM{
+		user: awsiam.User{UserName: "bob"},
+		keys: []awsiam.AccessKey{{AccessKeyID: "AKIA_DEV", Status: awsiam.StatusActive, CreateDate: now.AddDate(0, 0, -10)}},
+	}
+	broken := &fakeIAM{err: &awssts.Error{Service: "iam", Op: "get-user", Kind: awssts.KindInvalidCredentials, Err: errors.New("InvalidClientTokenId")}}
+
+	var stdout bytes.Buffer
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_PROFILE": "ignored"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = &stdout
+	deps.IAMFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awsiam.Client, error) {
+		return map[string]*fakeIAM{"AKIA_PROD": prod, "AKIA_DEV": dev, "AKIA_BROKEN": broken}[creds.AccessKeyID], nil
+	}
+	in := KeysAuditInputs{Inputs: Inputs{
+		LongTermSuffix:  "long-term",
+		ShortTermSuffix: "none",
+		CredentialsFile: credsPath,
+	}, JSON: true}
+
+	err = KeysAudit(context.Background(), in, deps)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 sections") {
+		t.Fatalf("expected the broken section to be reported, got %v", err)
+	}
+	var res []KeyAuditResult
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		t.Fatalf("Unmarshal: %v\n%s", err, stdout.String())
+	}
+	if len(res) != 3 || res[0].Section != "prod-long-term" || res[1].Section != "dev-long-term" || res[2].Section != "broken-long-term" {
+		t.Fatalf("unexpected sections: %+v", res)
+	}
+	if res[0].AgeDays != 120 || res[0].LastUsed == "" || len(res[0].Warnings) != 3 {
+		t.Fatalf("expected age, second key and quarantine warnings for prod, got %+v", res[0])
+	}
+	for i, want := range []string{"120 days old (max 90)", "second active key AKIA_FORGOTTEN, last used never", "AWSCompromisedKeyQuarantineV2"} {
+		if !strings.Contains(res[0].Warnings[i], want) {
+			t.Fatalf("expected warning %d to contain %q, got %q", i, want, res[0].Warnings[i])
+		}
+	}
+	if len(res[1].Warnings) != 0 || res[1].Error != "" {
+		t.Fatalf("expected dev to be healthy, got %+v", res[1])
+	}
+	if res[2].Error == "" {
+		t.Fatalf("expected an error for broken, got %+v", res[2])
+	}
+
+	stdout.Reset()
+	in.JSON = false
+	in.Profile = "dev"
+	in.ProfileChanged = true
+	in.MaxAgeDays = 5
+	in.MaxAgeDaysChanged = true
+	if err := KeysAudit(context.Background(), in, deps); err != nil {
+		t.Fatalf("KeysAudit: %v", err)
+	}
+	for _, want := range []string{"SECTION", "dev-long-term", "AKIA_DEV", "10d", "never", "key is 10 days old (max 5)", "1 of 1 sections need attention"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Fatalf("expected table to contain %q, got:\n%s", want, stdout.String())
+		}
+	}
+}
+
+func TestKeysAudit_NeedsLongTermSuffix(t *testing.T) {
+	deps := DefaultDeps()
+	deps.Env = mapEnv{}
+	err := KeysAudit(context.Background(), KeysAuditInputs{Inputs: Inputs{
+		LongTermSuffix:  "none",
+		CredentialsFile: filepath.Join(t.TempDir(), "credentials"),
+	}}, deps)
+	if ExitCode(err) != ExitConfig {
+		t.Fatalf("expected a config error, got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+)
+
+// MFAInputs are the inputs of the mfa subcommands. The device comes from
+// Inputs.Device, MFA_DEVICE or aws_mfa_device; without one, the IAM user's
+// only device is used, or chosen from a list.
+type MFAInputs struct {
+	// Only the profile, suffix, credentials file and device fields are used.
+	Inputs
+	// Region is optional; if empty, we will fall back to env, the region key
+	// in the long-term section, then the default region of the partition.
+	Region string
+	// JSON prints the device list as JSON (mfa list).
+	JSON bool
+	// Yes skips the confirmation of mfa deactivate.
+	Yes bool
+
+	// DeviceName names the virtual device of mfa enroll (default: the IAM
+	// user name). QRCodeFile optionally saves its QR code as a PNG, and
+	// SeedCommand receives its seed on stdin.
+	DeviceName  string
+	QRCodeFile  string
+	SeedCommand string
+}
+
+// MFADeviceResult is a device printed by MFAList (as JSON with --json).
+type MFADeviceResult struct {
+	SerialNumber string `json:"serial_number"`
+	UserName     string `json:"user_name"`
+	EnableDate   string `json:"enable_date"`
+	// Configured is true for the device in aws_mfa_device.
+	Configured bool `json:"configured"`
+}
+
+// MFAList prints the MFA devices of the IAM user a profile's long-term keys
+// belong to, with their enable dates.
+func MFAList(ctx context.Context, in MFAInputs, deps Deps) error {
+	c, err := newMFAClient(ctx, in, &deps)
+	if err != nil {
+		return err
+	}
+	devices, err := c.IAM.ListMFADevices(ctx)
+	if err != nil {
+		return err
+	}
+
+	configured, _ := c.Store.Get(c.Names.LongTerm, "aws_mfa_device")
+	res := make([]MFADeviceResult, 0, len(devices))
+	for _, d := range devices {
+		res = append(res, MFADeviceResult{
+			SerialNumber: d.SerialNumber,
+			UserName:     d.UserName,
+			EnableDate:   d.EnableDate.Format(time.RFC3339),
+			Configured:   d.SerialNumber == configured,
+		})
+	}
+
+	if in.JSON {
+		enc := json.NewEncoder(deps.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+
+	if len(res) == 0 {
+		_, _ = fmt.Fprintf(deps.Stdout, "No MFA device is assigned to the IAM user of [%s].\n", c.Names.LongTerm)
+		return nil
+	}
+	_, _ = fmt.Fprintf(deps.Stdout, "🔐 MFA devices of %s:\n", res[0].UserName)
+	for _, d := range res {
+		note := ""
+		if d.Configured {
+			note = " (aws_mfa_device)"
+		}
+		_, _ = fmt.Fprintf(deps.Stdout, "  %s  enabled %s%s\n", d.SerialNumber, d.EnableDate, note)
+	}
+	return nil
+}
+
+// MFAResync resynchronizes a drifted MFA device with IAM ResyncMFADevice,
+// prompting for two consecutive codes.
+func MFAResync(ctx context.Context, in MFAInputs, deps Deps) error {
+	c, err := newMFAClient(ctx, in, &deps)
+	if err != nil {
+		return err
+	}
+	device, err := selectMFADevice(ctx, deps, c, in)
+	if err != nil {
+		return err
+	}
+
+	codes, err := readConsecutiveCodes(ctx, deps, device.SerialNumber)
+	if err != nil {
+		return err
+	}
+
+	if err := c.IAM.ResyncMFADevice(ctx, awsiam.ResyncMFADeviceInput{
+		UserName:            device.UserName,
+		SerialNumber:        device.SerialNumber,
+		AuthenticationCode1: codes[0],
+		AuthenticationCode2: codes[1],
+	}); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(deps.Stdout, "✅ MFA device %s is resynchronized.\n", device.SerialNumber)
+	return nil
+}
+
+// MFADeactivate removes an MFA device from the IAM user after confirmation.
+// If it is the device in aws_mfa_device, the key is removed too.
+func MFADeactivate(ctx context.Context, in MFAInputs, deps Deps) error {
+	c, err := newMFAClient(ctx, in, &deps)
+	if err != nil {
+		return err
+	}
+	device, err := selectMFADevice(ctx, deps, c, in)
+	if err != nil {
+		return err
+	}
+
+	if !in.Yes {
+		_, _ = fmt.Fprintf(deps.Stdout, "⚠️ Deactivate MFA device %s of %s? Type yes to confirm: ", device.SerialNumber, device.UserName)
+		answer, err := readLine(ctx, deps.Stdout, deps.Stdin)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			return fmt.Errorf("read answer: %w", err)
+		}
+		if !strings.EqualFold(answer, "yes") {
+			_, _ = fmt.Fprintln(deps.Stdout, "❎ Nothing changed.")
+			return nil
+		}
+	}
+
+	if err := c.IAM.DeactivateMFADevice(ctx, device.UserName, device.SerialNumber); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(deps.Stdout, "✅ MFA device %s is deactivated.\n", device.SerialNumber)
+
+	if v, ok := c.Store.Get(c.Names.LongTerm, "aws_mfa_device"); ok && v == device.SerialNumber {
+		c.Store.DeleteKey(c.Names.LongTerm, "aws_mfa_device")
+		if err := c.Store.SaveAtomic(); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(deps.Stdout, "🧹 Removed aws_mfa_device from [%s].\n", c.Names.LongTerm)
+	}
+	return nil
+}
+
+// newMFAClient checks deps, defaults its I/O like Run does, and creates the
+// IAM client of the profile.
+func newMFAClient(ctx context.Context, in MFAInputs, deps *Deps) (longTermClient, error) {
+	if deps.Env == nil || deps.IAMFactory == nil {
+		return longTermClient{}, errors.New("missing required dependencies")
+	}
+	if deps.Stdout == nil {
+		deps.Stdout = io.Discard
+	}
+	if deps.Stderr == nil {
+		deps.Stderr = io.Discard
+	}
+	if deps.Stdin == nil {
+		deps.Stdin = strings.NewReader("")
+	}
+	return newLongTermClient(ctx, in.Inputs, in.Region, *deps)
+}
+
+// readConsecutiveCodes prompts for two consecutive codes of a device, as
+// IAM needs to resync or enable it.
+func readConsecutiveCodes(ctx context.Context, deps Deps, serialNumber string) ([2]string, error) {
+	var codes [2]string
+	for i, prompt := range []string{
+		fmt.Sprintf("🔐 Enter a code from MFA device [%s]: ", serialNumber),
+		"🔐 Wait for the next code and enter it: ",
+	} {
+		_, _ = fmt.Fprint(deps.Stdout, prompt)
+		code, err := readLine(ctx, deps.Stdout, deps.Stdin)
+		if err != nil {
+			if ctx.Err() != nil {
+				return codes, err
+			}
+			return codes, fmt.Errorf("read code: %w", err)
+		}
+		if !token6Digits.MatchString(code) {
+			return codes, configError(errors.New("invalid MFA code format: expected 6 digits"))
+		}
+		codes[i] = code
+	}
+	if codes[0] == codes[1] {
+		return codes, configError(errors.New("the two MFA codes must be consecutive, not the same"))
+	}
+	return codes, nil
+}
+
+// selectMFADevice returns the configured device, or chooses one of the IAM
+// user's devices when none is configured. IAM needs the device's user name,
+// so the configured device is looked up in the list too.
+func selectMFADevice(ctx context.Context, deps Deps, c longTermClient, in MFAInputs) (awsiam.MFADevice, error) {
+	configured := ""
+	if in.DeviceChanged && strings.TrimSpace(in.Device) != "" {
+		configured = strings.TrimSpace(in.Device)
+	} else if v := strings.TrimSpace(deps.Env.Get("MFA_DEVICE")); v != "" {
+		configured = v
+	} else if v, ok := c.Store.Get(c.Names.LongTerm, "aws_mfa_device"); ok {
+		configured = v
+	}
+
+	devices, err := c.IAM.ListMFADevices(ctx)
+	if err != nil {
+		return awsiam.MFADevice{}, err
+	}
+	if configured != "" {
+		for _, d := range devices {
+			if d.SerialNumber == configured {
+				return d, nil
+			}
+		}
+		return awsiam.MFADevice{}, configError(fmt.Errorf("MFA device %s is not assigned to the IAM user of [%s]", configured, c.Names.LongTerm))
+	}
+	if len(devices) == 0 {
+		return awsiam.MFADevice{}, configError(fmt.Errorf("no MFA device is assigned to the IAM user of [%s]", c.Names.LongTerm))
+	}
+	return chooseMFADevice(ctx, deps, devices)
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+// mfaTestSetup writes a long-term section with the given device and returns
+// inputs and deps that use iam and capture stdout.
+func mfaTestSetup(t *testing.T, iam *fakeIAM, device, stdin string) (MFAInputs, Deps, *bytes.Buffer, string) {
+	t.Helper()
+	credsPath := filepath.Join(t.TempDir(), "credentials")
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("prod-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("prod-long-term", "aws_secret_access_key", "SECRET_LT")
+	if device != "" {
+		store.Set("prod-long-term", "aws_mfa_device", device)
+	}
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	deps := DefaultDeps()
+	deps.Env = mapEnv{}
+	deps.Stdout = &stdout
+	deps.Stdin = strings.NewReader(stdin)
+	deps.IAMFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awsiam.Client, error) {
+		if creds.AccessKeyID != "AKIA_LT" {
+			t.Errorf("expected long-term keys, got %+v", creds)
+		}
+		return iam, nil
+	}
+	in := MFAInputs{Inputs: Inputs{
+		Profile:         "prod",
+		ProfileChanged:  true,
+		LongTermSuffix:  "long-term",
+		ShortTermSuffix: "none",
+		CredentialsFile: credsPath,
+	}}
+	return in, deps, &stdout, credsPath
+}
+
+var testDevices = []awsiam.MFADevice{
+	{SerialNumber: "arn:aws:iam::123456789012:mfa/phone", UserName: "alice", EnableDate: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)},
+	{SerialNumber: "GAHT12345678", UserName: "alice", EnableDate: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+func TestMFAList_MarksConfiguredDevice(t *testing.T) {
+	iam := &fakeIAM{devices: testDevices}
+	in, deps, stdout, _ := mfaTestSetup(t, iam, "GAHT12345678", "")
+
+	if err := MFAList(context.Background(), in, deps); err != nil {
+		t.Fatalf("MFAList: %v", err)
+	}
+	for _, want := range []string{"arn:aws:iam::123456789012:mfa/phone  enabled 2025-01-02T03:04:05Z\n", "GAHT12345678  enabled 2025-06-01T00:00:00Z (aws_mfa_device)"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	in.JSON = true
+	if err := MFAList(context.Background(), in, deps); err != nil {
+		t.Fatalf("MFAList (json): %v", err)
+	}
+	var res []MFADeviceResult
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		t.Fatalf("Unmarshal: %v\n%s", err, stdout.String())
+	}
+	if len(res) != 2 || res[0].Configured || !res[1].Configured {
+		t.Fatalf("unexpected JSON result: %+v", res)
+	}
+}
+
+func TestMFAResync_SendsTwoCodesForConfiguredDevice(t *testing.T) {
+	iam := &fakeIAM{devices: testDevices}
+	in, deps, _, _ := mfaTestSetup(t, iam, "arn:aws:iam::123456789012:mfa/phone", "111111\n222222\n")
+
+	if err := MFAResync(context.Background(), in, deps); err != nil {
+		t.Fatalf("MFAResync: %v", err)
+	}
+	want := awsiam.ResyncMFADeviceInput{
+		UserName:            "alice",
+		SerialNumber:        "arn:aws:iam::123456789012:mfa/phone",
+		AuthenticationCode1: "111111",
+		AuthenticationCode2: "222222",
+	}
+	if len(iam.gotResync) != 1 || iam.gotResync[0] != want {
+		t.Fatalf("unexpected ResyncMFADevice calls: %+v", iam.gotResync)
+	}
+}
+
+func TestMFAResync_RejectsSameCodeTwice(t *testing.T) {
+	iam := &fakeIAM{devices: testDevices}
+	in, deps, _, _ := mfaTestSetup(t, iam, "GAHT12345678", "111111\n111111\n")
+
+	err := MFAResync(context.Background(), in, deps)
+	if ExitCode(err) != ExitConfig || len(iam.gotResync) != 0 {
+		t.Fatalf("expected a config error without a call, got %v (%d calls)", err, len(iam.gotResync))
+	}
+}
+
+func TestMFADeactivate_ConfirmsAndRemovesConfiguredDevice(t *testing.T) {
+	iam := &fakeIAM{devices: testDevices}
+	in, deps, stdout, credsPath := mfaTestSetup(t, iam, "GAHT12345678", "no\n")
+
+	if err := MFADeactivate(context.Background(), in, deps); err != nil {
+		t.Fatalf("MFADeactivate: %v", err)
+	}
+	if len(iam.gotDeactivate) != 0 || !strings.Contains(stdout.String(), "Nothing changed") {
+		t.Fatalf("expected no deactivation without confirmation, got %v\n%s", iam.gotDeactivate, stdout.String())
+	}
+
+	deps.Stdin = strings.NewReader("yes\n")
+	if err := MFADeactivate(context.Background(), in, deps); err != nil {
+		t.Fatalf("MFADeactivate: %v", err)
+	}
+	if len(iam.gotDeactivate) != 1 || iam.gotDeactivate[0] != "alice GAHT12345678" {
+		t.Fatalf("unexpected DeactivateMFADevice calls: %v", iam.gotDeactivate)
+	}
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, ok := store.Get("prod-long-term", "aws_mfa_device"); ok {
+		t.Fatalf("expected aws_mfa_device to be removed")
+	}
+}
+
+func TestMFADeactivate_UnknownDevice(t *testing.T) {
+	iam := &fakeIAM{devices: testDevices}
+	in, deps, _, _ := mfaTestSetup(t, iam, "", "")
+	in.Device = "arn:aws:iam::123456789012:mfa/other"
+	in.DeviceChanged = true
+	in.Yes = true
+
+	err := MFADeactivate(context.Background(), in, deps)
+	if ExitCode(err) != ExitConfig || len(iam.gotDeactivate) != 0 {
+		t.Fatalf("expected a config error without a call, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+// discoverMFADevice finds the MFA device of the IAM user the long-term keys
+// belong to, when none is configured: it is used as is if the user has only
+// one, else chosen from a numbered list. The user is then offered to save it
+// as aws_mfa_device in the long-term section, so it is not looked up again.
+func discoverMFADevice(ctx context.Context, deps Deps, store *credentials.Store, opts awssts.Options, longTerm awssts.Credentials, section string) (string, error) {
+	if deps.IAMFactory == nil {
+		return "", configError(errors.New("missing MFA device: set --device, MFA_DEVICE, or aws_mfa_device in long-term credentials section"))
+	}
+	client, err := deps.IAMFactory(ctx, opts, longTerm)
+	if err != nil {
+		return "", err
+	}
+	devices, err := client.ListMFADevices(ctx)
+	if err != nil {
+		return "", fmt.Errorf("discover MFA device (or set --device, MFA_DEVICE, or aws_mfa_device): %w", err)
+	}
+
+	if len(devices) == 0 {
+		return "", configError(fmt.Errorf("no MFA device is assigned to the IAM user of [%s]", section))
+	}
+	device, err := chooseMFADevice(ctx, deps, devices)
+	if err != nil {
+		return "", err
+	}
+
+	// Saving needs an explicit yes, so runs without a terminal (stdin closed
+	// or piped) never change the file unasked.
+	_, _ = fmt.Fprintf(deps.Stdout, "💾 Save it as aws_mfa_device in [%s]? [y/N]: ", section)
+	answer, err := readLine(ctx, deps.Stdout, deps.Stdin)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("read answer: %w", err)
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		// Saved right away, so a mistyped MFA code does not repeat the lookup.
+		store.Set(section, "aws_mfa_device", device.SerialNumber)
+		if err := store.SaveAtomic(); err != nil {
+			return "", err
+		}
+	}
+	return device.SerialNumber, nil
+}
+
+// chooseMFADevice returns the only device, or asks the user to choose one
+// from a numbered list. devices must not be empty.
+func chooseMFADevice(ctx context.Context, deps Deps, devices []awsiam.MFADevice) (awsiam.MFADevice, error) {
+	if len(devices) == 1 {
+		_, _ = fmt.Fprintf(deps.Stdout, "🔎 Found MFA device: %s\n", devices[0].SerialNumber)
+		return devices[0], nil
+	}
+
+	_, _ = fmt.Fprintf(deps.Stdout, "🔎 %s has several MFA devices:\n", devices[0].UserName)
+	for i, d := range devices {
+		_, _ = fmt.Fprintf(deps.Stdout, "  %d) %s (enabled %s)\n", i+1, d.SerialNumber, d.EnableDate.Format("2006-01-02"))
+	}
+	_, _ = fmt.Fprintf(deps.Stdout, "Choose a device [1-%d]: ", len(devices))
+	line, err := readLine(ctx, deps.Stdout, deps.Stdin)
+	if err != nil {
+		if ctx.Err() != nil {
+			return awsiam.MFADevice{}, err
+		}
+		return awsiam.MFADevice{}, fmt.Errorf("read device choice: %w", err)
+	}
+	n, err := strconv.Atoi(line)
+	if err != nil || n < 1 || n > len(devices) {
+		return awsiam.MFADevice{}, configError(fmt.Errorf("invalid device choice %q: choose 1-%d, or set --device", line, len(devices)))
+	}
+	return devices[n-1], nil
+}
@@ -0,0 +1,389 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+type fakeIAM struct {
+	devices []awsiam.MFADevice
+	err     error
+	calls   int
+
+	gotResync     []awsiam.ResyncMFADeviceInput
+	gotDeactivate []string
+
+	user      awsiam.User
+	virtual   awsiam.VirtualMFADevice
+	enableErr error
+	gotCreate []string
+	gotEnable []awsiam.EnableMFADeviceInput
+	gotDelete []string
+
+	keys         []awsiam.AccessKey
+	newKey       awsiam.NewAccessKey
+	updateErr    error
+	gotUpdate    []string
+	gotDeleteKey []string
+	// deleteKeyErrs are returned by DeleteAccessKey before f.err, one per call.
+	deleteKeyErrs []error
+
+	lastUsed map[string]time.Time
+	policies []awsiam.AttachedPolicy
+
+	role    awsiam.Role
+	roleErr error
+	gotRole []string
+
+	// inline maps user and group names to their inline policy documents by
+	// name, attached the attached policies of groups, and documents the
+	// managed policy documents by ARN.
+	groups    []string
+	inline    map[string]map[string]string
+	attached  map[string][]awsiam.AttachedPolicy
+	documents map[string]string
+}
+
+func (f *fakeIAM) ListUserPolicies(ctx context.Context, userName string) ([]string, error) {
+	return f.inlineNames(userName), f.err
+}
+
+func (f *fakeIAM) GetUserPolicy(ctx context.Context, userName, policyName string) (string, error) {
+	return f.inline[userName][policyName], f.err
+}
+
+func (f *fakeIAM) ListGroupsForUser(ctx context.Context, userName string) ([]string, error) {
+	return f.groups, f.err
+}
+
+func (f *fakeIAM) ListAttachedGroupPolicies(ctx context.Context, groupName string) ([]awsiam.AttachedPolicy, error) {
+	return f.attached[groupName], f.err
+}
+
+func (f *fakeIAM) ListGroupPolicies(ctx context.Context, groupName string) ([]string, error) {
+	return f.inlineNames(groupName), f.err
+}
+
+func (f *fakeIAM) GetGroupPolicy(ctx context.Context, groupName, policyName string) (string, error) {
+	return f.inline[groupName][policyName], f.err
+}
+
+func (f *fakeIAM) GetPolicyDocument(ctx context.Context, policyARN string) (string, error) {
+	return f.documents[policyARN], f.err
+}
+
+func (f *fakeIAM) inlineNames(name string) []string {
+	var names []string
+	for n := range f.inline[name] {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f *fakeIAM) GetRole(ctx context.Context, name string) (awsiam.Role, error) {
+	f.gotRole = append(f.gotRole, name)
+	return f.role, f.roleErr
+}
+
+func (f *fakeIAM) GetAccessKeyLastUsed(ctx context.Context, accessKeyID string) (awsiam.AccessKeyLastUsed, error) {
+	if t, ok := f.lastUsed[accessKeyID]; ok {
+		return awsiam.AccessKeyLastUsed{LastUsed: t, ServiceName: "sts", Region: "us-east-1"}, f.err
+	}
+	return awsiam.AccessKeyLastUsed{}, f.err
+}
+
+func (f *fakeIAM) ListAttachedUserPolicies(ctx context.Context, userName string) ([]awsiam.AttachedPolicy, error) {
+	return f.policies, f.err
+}
+
+func (f *fakeIAM) ListAccessKeys(ctx context.Context) ([]awsiam.AccessKey, error) {
+	return f.keys, f.err
+}
+
+func (f *fakeIAM) CreateAccessKey(ctx context.Context) (awsiam.NewAccessKey, error) {
+	f.calls++
+	return f.newKey, f.err
+}
+
+func (f *fakeIAM) UpdateAccessKey(ctx context.Context, accessKeyID, status string) error {
+	f.calls++
+	f.gotUpdate = append(f.gotUpdate, accessKeyID+" "+status)
+	return f.updateErr
+}
+
+func (f *fakeIAM) DeleteAccessKey(ctx context.Context, accessKeyID string) error {
+	f.calls++
+	f.gotDeleteKey = append(f.gotDeleteKey, accessKeyID)
+	if len(f.deleteKeyErrs) > 0 {
+		err := f.deleteKeyErrs[0]
+		f.deleteKeyErrs = f.deleteKeyErrs[1:]
+		return err
+	}
+	return f.err
+}
+
+func (f *fakeIAM) ListMFADevices(ctx context.Context) ([]awsiam.MFADevice, error) {
+	f.calls++
+	return f.devices, f.err
+}
+
+func (f *fakeIAM) ResyncMFADevice(ctx context.Context, in awsiam.ResyncMFADeviceInput) error {
+	f.calls++
+	f.gotResync = append(f.gotResync, in)
+	return f.err
+}
+
+func (f *fakeIAM) DeactivateMFADevice(ctx context.Context, userName, serialNumber string) error {
+	f.calls++
+	f.gotDeactivate = append(f.gotDeactivate, userName+" "+serialNumber)
+	return f.err
+}
+
+func (f *fakeIAM) GetUser(ctx context.Context) (awsiam.User, error) {
+	return f.user, f.err
+}
+
+func (f *fakeIAM) CreateVirtualMFADevice(ctx context.Context, name string) (awsiam.VirtualMFADevice, error) {
+	f.calls++
+	f.gotCreate = append(f.gotCreate, name)
+	return f.virtual, f.err
+}
+
+func (f *fakeIAM) EnableMFADevice(ctx context.Context, in awsiam.EnableMFADeviceInput) error {
+	f.calls++
+	f.gotEnable = append(f.gotEnable, in)
+	return f.enableErr
+}
+
+func (f *fakeIAM) DeleteVirtualMFADevice(ctx context.Context, serialNumber string) error {
+	f.calls++
+	f.gotDelete = append(f.gotDelete, serialNumber)
+	return f.err
+}
+
+func runWithDiscovery(t *testing.T, iam *fakeIAM, stdin string) (*fakeSTS, *credentials.Store, string, error) {
+	t.Helper()
+	credsPath := filepath.Join(t.TempDir(), "credentials")
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("default-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("default-long-term", "aws_secret_access_key", "SECRET_LT")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	fake := &fakeSTS{out: awssts.GetSessionTokenOutput{
+		AccessKeyID:     "ASIA_ST",
+		SecretAccessKey: "SECRET_ST",
+		SessionToken:    "TOKEN_ST",
+		Expiration:      time.Date(2026, 2, 9, 12, 0, 0, 0, time.UTC),
+	}}
+	var stdout bytes.Buffer
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1"}
+	deps.Now = func() time.Time { return time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC) }
+	deps.Stdout = &stdout
+	deps.Stdin = strings.NewReader(stdin)
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+	deps.IAMFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awsiam.Client, error) {
+		if creds.AccessKeyID != "AKIA_LT" {
+			t.Errorf("expected long-term keys for IAM, got %+v", creds)
+		}
+		return iam, nil
+	}
+
+	err = Run(context.Background(), RunInputs{Inputs: Inputs{
+		Profile:         "default",
+		ProfileChanged:  true,
+		LongTermSuffix:  "long-term",
+		ShortTermSuffix: "none",
+		CredentialsFile: credsPath,
+		SkipVerify:      true,
+	}}, deps)
+
+	after, loadErr := credentials.Load(credsPath)
+	if loadErr != nil {
+		t.Fatalf("Load: %v", loadErr)
+	}
+	return fake, after, stdout.String(), err
+}
+
+func TestRun_DiscoversSingleMFADeviceAndSavesIt(t *testing.T) {
+	iam := &fakeIAM{devices: []awsiam.MFADevice{{SerialNumber: "arn:aws:iam::123456789012:mfa/phone", UserName: "alice"}}}
+	fake, store, out, err := runWithDiscovery(t, iam, "y\n123456\n")
+	if err != nil {
+		t.Fatalf("Run: %v\n%s", err, out)
+	}
+	if len(fake.gotSession) != 1 || fake.gotSession[0].SerialNumber != "arn:aws:iam::123456789012:mfa/phone" || fake.gotSession[0].TokenCode != "123456" {
+		t.Fatalf("unexpected GetSessionToken calls: %+v", fake.gotSession)
+	}
+	if got, _ := store.Get("default-long-term", "aws_mfa_device"); got != "arn:aws:iam::123456789012:mfa/phone" {
+		t.Fatalf("expected the device to be saved, got %q", got)
+	}
+}
+
+func TestRun_DiscoveryOffersPickerAndCanSkipSaving(t *testing.T) {
+	iam := &fakeIAM{devices: []awsiam.MFADevice{
+		{SerialNumber: "arn:aws:iam::123456789012:mfa/phone", UserName: "alice"},
+		{SerialNumber: "GAHT12345678", UserName: "alice"},
+	}}
+	fake, store, out, err := runWithDiscovery(t, iam, "2\nn\n123456\n")
+	if err != nil {
+		t.Fatalf("Run: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "2) GAHT12345678") {
+		t.Fatalf("expected a numbered device list, got:\n%s", out)
+	}
+	if len(fake.gotSession) != 1 || fake.gotSession[0].SerialNumber != "GAHT12345678" {
+		t.Fatalf("unexpected GetSessionToken calls: %+v", fake.gotSession)
+	}
+	if _, ok := store.Get("default-long-term", "aws_mfa_device"); ok {
+		t.Fatalf("expected aws_mfa_device not to be saved")
+	}
+}
+
+func TestRun_DiscoveryWithoutDevicesIsConfigError(t *testing.T) {
+	fake, _, _, err := runWithDiscovery(t, &fakeIAM{}, "")
+	if ExitCode(err) != ExitConfig {
+		t.Fatalf("expected a config error, got %v", err)
+	}
+	if fake.calls != 0 {
+		t.Fatalf("expected no STS calls, got %d", fake.calls)
+	}
+}
+
+func TestRun_DiscoveryInvalidChoice(t *testing.T) {
+	iam := &fakeIAM{devices: []awsiam.MFADevice{{SerialNumber: "a"}, {SerialNumber: "b"}}}
+	_, _, _, err := runWithDiscovery(t, iam, "3\n")
+	if ExitCode(err) != ExitConfig {
+		t.Fatalf("expected a config error, got %v", err)
+	}
+}
+
+func TestRun_DiscoveredDeviceIsNotSavedWithoutAYes(t *testing.T) {
+	iam := &fakeIAM{devices: []awsiam.MFADevice{{SerialNumber: "arn:aws:iam::123456789012:mfa/phone", UserName: "alice"}}}
+	fake, store, out, err := runWithDiscovery(t, iam, "\n123456\n")
+	if err != nil {
+		t.Fatalf("Run: %v\n%s", err, out)
+	}
+	if len(fake.gotSession) != 1 || fake.gotSession[0].SerialNumber != "arn:aws:iam::123456789012:mfa/phone" {
+		t.Fatalf("unexpected GetSessionToken calls: %+v", fake.gotSession)
+	}
+	if _, ok := store.Get("default-long-term", "aws_mfa_device"); ok {
+		t.Fatalf("expected an empty answer not to save aws_mfa_device")
+	}
+}
+
+func TestRun_DiscoveredDevicePartitionSetsTheRegion(t *testing.T) {
+	credsPath := filepath.Join(t.TempDir(), "credentials")
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("default-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("default-long-term", "aws_secret_access_key", "SECRET_LT")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	fake := &fakeSTS{out: awssts.GetSessionTokenOutput{
+		AccessKeyID: "ASIA_ST", SecretAccessKey: "SECRET_ST", SessionToken: "TOKEN_ST",
+		Expiration: time.Date(2026, 2, 9, 12, 0, 0, 0, time.UTC),
+	}}
+	iam := &fakeIAM{devices: []awsiam.MFADevice{{SerialNumber: "arn:aws-us-gov:iam::123456789012:mfa/phone", UserName: "alice"}}}
+	var stsRegions []string
+	deps := DefaultDeps()
+	deps.Env = mapEnv{}
+	deps.Now = func() time.Time { return time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC) }
+	deps.Stdout = ioDiscard{}
+	deps.Stdin = strings.NewReader("n\n123456\n")
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		stsRegions = append(stsRegions, opts.Region)
+		return fake, nil
+	}
+	deps.IAMFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awsiam.Client, error) {
+		return iam, nil
+	}
+
+	err = Run(context.Background(), RunInputs{Inputs: Inputs{
+		Profile:         "default",
+		ProfileChanged:  true,
+		LongTermSuffix:  "long-term",
+		ShortTermSuffix: "none",
+		CredentialsFile: credsPath,
+		SkipVerify:      true,
+	}}, deps)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(stsRegions) != 1 || stsRegions[0] != "us-gov-west-1" {
+		t.Fatalf("expected STS to be called in the device's partition, got regions %v", stsRegions)
+	}
+}
+
+func TestRun_ReusedMFASessionSkipsDeviceDiscovery(t *testing.T) {
+	credsPath := filepath.Join(t.TempDir(), "credentials")
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	now := time.Date(2026, 2, 9, 12, 0, 0, 0, time.UTC)
+	store.Set("prod-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("prod-long-term", "aws_secret_access_key", "SECRET_LT")
+	store.Set("prod-long-term", "assume_role", "arn:aws:iam::210987654321:role/admin")
+	store.Set("prod-mfa-session", "aws_access_key_id", "ASIA_SESSION")
+	store.Set("prod-mfa-session", "aws_secret_access_key", "SECRET_SESSION")
+	store.Set("prod-mfa-session", "aws_session_token", "TOKEN_SESSION")
+	store.Set("prod-mfa-session", "aws_security_token", "TOKEN_SESSION")
+	store.Set("prod-mfa-session", "expiration", now.Add(10*time.Hour).Format(expirationLayout))
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	fake := &fakeSTS{roleOut: awssts.AssumeRoleOutput{
+		AccessKeyID: "ASIA_ROLE", SecretAccessKey: "SECRET_ROLE", SessionToken: "TOKEN_ROLE",
+		Expiration: now.Add(time.Hour),
+	}}
+	iamCalls := 0
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = ioDiscard{}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+	deps.IAMFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awsiam.Client, error) {
+		iamCalls++
+		return nil, errors.New("IAM is not reachable with MFA-gated keys")
+	}
+
+	err = Run(context.Background(), RunInputs{Inputs: Inputs{
+		Profile:         "prod",
+		ProfileChanged:  true,
+		LongTermSuffix:  "long-term",
+		ShortTermSuffix: "none",
+		CredentialsFile: credsPath,
+		SkipVerify:      true,
+	}}, deps)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if iamCalls != 0 || len(fake.gotRole) != 1 {
+		t.Fatalf("expected the role to be assumed from the cached MFA session without IAM calls, got %d IAM clients, %d AssumeRole calls", iamCalls, len(fake.gotRole))
+	}
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+)
+
+// otpauthIssuer is the issuer authenticator apps show, as in the console.
+const otpauthIssuer = "Amazon Web Services"
+
+// qrCodePNGSize is the width and height of the saved QR code in pixels.
+const qrCodePNGSize = 256
+
+// MFAEnroll creates a virtual MFA device for the IAM user, shows its QR code
+// in the terminal, enables it with two consecutive codes and saves it as
+// aws_mfa_device in the long-term section. If enabling fails, the device is
+// deleted again, so enrolling can be retried with the same name.
+func MFAEnroll(ctx context.Context, in MFAInputs, deps Deps) error {
+	c, err := newMFAClient(ctx, in, &deps)
+	if err != nil {
+		return err
+	}
+	if in.SeedCommand != "" && deps.StoreSeed == nil {
+		return fmt.Errorf("missing required dependencies")
+	}
+
+	user, err := c.IAM.GetUser(ctx)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSpace(in.DeviceName)
+	if name == "" {
+		name = user.UserName
+	}
+
+	device, err := c.IAM.CreateVirtualMFADevice(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := enrollDevice(ctx, deps, c, in, user, device); err != nil {
+		// Not ctx, so Ctrl-C does not leave the device behind; the client's
+		// timeout still applies.
+		if delErr := c.IAM.DeleteVirtualMFADevice(context.Background(), device.SerialNumber); delErr != nil {
+			_, _ = fmt.Fprintf(deps.Stderr, "⚠️ Could not delete the unused MFA device %s: %v\n", device.SerialNumber, delErr)
+		}
+		return err
+	}
+
+	c.Store.Set(c.Names.LongTerm, "aws_mfa_device", device.SerialNumber)
+	if err := c.Store.SaveAtomic(); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(deps.Stdout, "✅ MFA device %s is enabled and saved as aws_mfa_device in [%s].\n", device.SerialNumber, c.Names.LongTerm)
+
+	if in.SeedCommand != "" {
+		if err := deps.StoreSeed(ctx, in.SeedCommand, device.Base32StringSeed); err != nil {
+			return fmt.Errorf("the MFA device is enabled, but storing its seed failed: %w", err)
+		}
+		_, _ = fmt.Fprintln(deps.Stdout, "🔑 Seed stored with the seed command.")
+	}
+	return nil
+}
+
+// enrollDevice shows the QR code of a new device and enables it.
+func enrollDevice(ctx context.Context, deps Deps, c longTermClient, in MFAInputs, user awsiam.User, device awsiam.VirtualMFADevice) error {
+	uri := otpauthURI(user, device.Base32StringSeed)
+	qr, err := qrcode.New(uri, qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("encode QR code: %w", err)
+	}
+	if in.QRCodeFile != "" {
+		png, err := qr.PNG(qrCodePNGSize)
+		if err != nil {
+			return fmt.Errorf("encode QR code: %w", err)
+		}
+		// The QR code holds the seed, so it is only readable by the user.
+		if err := os.WriteFile(ExpandHome(in.QRCodeFile), png, 0o600); err != nil {
+			return configError(fmt.Errorf("write QR code: %w", err))
+		}
+	}
+
+	_, _ = fmt.Fprintf(deps.Stdout, "📱 Scan this QR code with your authenticator app (device %s):\n\n", device.SerialNumber)
+	_, _ = fmt.Fprintln(deps.Stdout, qr.ToSmallString(false))
+	_, _ = fmt.Fprintf(deps.Stdout, "Or enter this key manually: %s\n", device.Base32StringSeed)
+	if in.QRCodeFile != "" {
+		_, _ = fmt.Fprintf(deps.Stdout, "🖼️ QR code saved to %s\n", in.QRCodeFile)
+	}
+
+	codes, err := readConsecutiveCodes(ctx, deps, device.SerialNumber)
+	if err != nil {
+		return err
+	}
+	return c.IAM.EnableMFADevice(ctx, awsiam.EnableMFADeviceInput{
+		UserName:            user.UserName,
+		SerialNumber:        device.SerialNumber,
+		AuthenticationCode1: codes[0],
+		AuthenticationCode2: codes[1],
+	})
+}
+
+// otpauthURI returns the key URI authenticator apps import, labeled like
+// the console's: "Amazon Web Services:<user>@<account>".
+func otpauthURI(user awsiam.User, seed string) string {
+	label := user.UserName
+	if parts := strings.SplitN(user.ARN, ":", 6); len(parts) == 6 && parts[4] != "" {
+		label += "@" + parts[4]
+	}
+	q := url.Values{}
+	q.Set("secret", seed)
+	q.Set("issuer", otpauthIssuer)
+	return "otpauth://totp/" + url.PathEscape(otpauthIssuer+":"+label) + "?" + q.Encode()
+}
+
+// storeSeed runs command through the shell with seed on its stdin, for
+// example "pass insert --multiline aws/mfa".
+func storeSeed(ctx context.Context, command, seed string) error {
+	cmd := shellCommand(ctx, command)
+	cmd.Stdin = strings.NewReader(seed + "\n")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("seed command %q: %w", command, err)
+	}
+	return nil
+}
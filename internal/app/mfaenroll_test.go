@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+func TestMFAEnroll_EnablesDeviceAndSavesIt(t *testing.T) {
+	iam := &fakeIAM{
+		user:    awsiam.User{UserName: "alice", ARN: "arn:aws:iam::123456789012:user/alice"},
+		virtual: awsiam.VirtualMFADevice{SerialNumber: "arn:aws:iam::123456789012:mfa/alice", Base32StringSeed: "JBSWY3DPEHPK3PXP"},
+	}
+	in, deps, stdout, credsPath := mfaTestSetup(t, iam, "", "111111\n222222\n")
+	in.QRCodeFile = filepath.Join(t.TempDir(), "qr.png")
+	in.SeedCommand = "store-it"
+	var gotSeed string
+	deps.StoreSeed = func(ctx context.Context, command, seed string) error {
+		if command != "store-it" {
+			t.Errorf("unexpected seed command %q", command)
+		}
+		gotSeed = seed
+		return nil
+	}
+
+	if err := MFAEnroll(context.Background(), in, deps); err != nil {
+		t.Fatalf("MFAEnroll: %v", err)
+	}
+	if len(iam.gotCreate) != 1 || iam.gotCreate[0] != "alice" {
+		t.Fatalf("expected the device to be named after the user, got %v", iam.gotCreate)
+	}
+	want := awsiam.EnableMFADeviceInput{
+		UserName:            "alice",
+		SerialNumber:        "arn:aws:iam::123456789012:mfa/alice",
+		AuthenticationCode1: "111111",
+		AuthenticationCode2: "222222",
+	}
+	if len(iam.gotEnable) != 1 || iam.gotEnable[0] != want {
+		t.Fatalf("unexpected EnableMFADevice calls: %+v", iam.gotEnable)
+	}
+	if gotSeed != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("expected the seed to be stored, got %q", gotSeed)
+	}
+	if !strings.Contains(stdout.String(), "JBSWY3DPEHPK3PXP") {
+		t.Fatalf("expected the key for manual entry, got:\n%s", stdout.String())
+	}
+
+	info, err := os.Stat(in.QRCodeFile)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected the QR code to be private, got %v", info.Mode().Perm())
+	}
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got, _ := store.Get("prod-long-term", "aws_mfa_device"); got != "arn:aws:iam::123456789012:mfa/alice" {
+		t.Fatalf("expected the device to be saved, got %q", got)
+	}
+}
+
+func TestMFAEnroll_DeletesDeviceWhenEnablingFails(t *testing.T) {
+	iam := &fakeIAM{
+		user:      awsiam.User{UserName: "alice", ARN: "arn:aws:iam::123456789012:user/alice"},
+		virtual:   awsiam.VirtualMFADevice{SerialNumber: "arn:aws:iam::123456789012:mfa/phone", Base32StringSeed: "JBSWY3DPEHPK3PXP"},
+		enableErr: &awssts.Error{Service: "iam", Op: "enable-mfa-device", Kind: awssts.KindInvalidMFA, Err: errors.New("InvalidAuthenticationCode")},
+	}
+	in, deps, _, credsPath := mfaTestSetup(t, iam, "", "111111\n222222\n")
+	in.DeviceName = "phone"
+
+	err := MFAEnroll(context.Background(), in, deps)
+	if ExitCode(err) != ExitInvalidMFA {
+		t.Fatalf("expected an invalid MFA error, got %v", err)
+	}
+	if len(iam.gotCreate) != 1 || iam.gotCreate[0] != "phone" {
+		t.Fatalf("expected the device name to be used, got %v", iam.gotCreate)
+	}
+	if len(iam.gotDelete) != 1 || iam.gotDelete[0] != "arn:aws:iam::123456789012:mfa/phone" {
+		t.Fatalf("expected the unused device to be deleted, got %v", iam.gotDelete)
+	}
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, ok := store.Get("prod-long-term", "aws_mfa_device"); ok {
+		t.Fatalf("expected aws_mfa_device not to be saved")
+	}
+}
+
+func TestOTPAuthURI(t *testing.T) {
+	got := otpauthURI(awsiam.User{UserName: "alice", ARN: "arn:aws:iam::123456789012:user/alice"}, "JBSWY3DPEHPK3PXP")
+	want := "otpauth://totp/Amazon%20Web%20Services:alice@123456789012?issuer=Amazon+Web+Services&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Fatalf("otpauthURI = %q, want %q", got, want)
+	}
+}
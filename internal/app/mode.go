@@ -0,0 +1,107 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+// Modes select the STS call that produces the short-term credentials.
+const (
+	// ModeSession calls GetSessionToken with MFA (the upstream aws-mfa default).
+	ModeSession = "session"
+	// ModeRole calls AssumeRole (or a role chain) from a cached MFA session.
+	ModeRole = "role"
+	// ModeFederation calls GetFederationToken with the long-term keys.
+	ModeFederation = "federation"
+	// ModeWebIdentity calls AssumeRoleWithWebIdentity with an OIDC token file.
+	ModeWebIdentity = "web-identity"
+	// ModeOIDC logs in at an OpenID provider (device authorization grant) and
+	// calls AssumeRoleWithWebIdentity with the ID token.
+	ModeOIDC = "oidc"
+	// ModeSAML calls AssumeRoleWithSAML with an assertion from the IdP.
+	ModeSAML = "saml"
+	// ModeSSO gets role credentials from IAM Identity Center.
+	ModeSSO = "sso"
+	// ModeRolesAnywhere gets role credentials from IAM Roles Anywhere with an
+	// X.509 certificate.
+	ModeRolesAnywhere = "roles-anywhere"
+)
+
+// resolveMode resolves the mode: flag > MFA_MODE > mode key > derived.
+// sourceMode is the mode implied by a configured credential source (a web
+// identity token file, an OIDC issuer, ...), if any; otherwise the mode is
+// derived from whether a role is configured.
+// An explicit mode must agree with the role settings.
+func resolveMode(in Inputs, env Env, store *credentials.Store, section, roleARN, sourceMode string) (string, error) {
+	mode := strings.ToLower(pick(in.Mode, in.ModeChanged, env.Get("MFA_MODE"), store, section, "mode"))
+	switch mode {
+	case "":
+		if sourceMode != "" {
+			return sourceMode, nil
+		}
+		if roleARN != "" {
+			return ModeRole, nil
+		}
+		return ModeSession, nil
+	case ModeWebIdentity, ModeOIDC, ModeSAML, ModeRolesAnywhere:
+		return mode, nil
+	case ModeSession, ModeFederation, ModeSSO:
+		if roleARN != "" {
+			return "", fmt.Errorf("mode %s does not assume roles: unset assume_role/role_chain or use mode role", mode)
+		}
+		return mode, nil
+	case ModeRole:
+		if roleARN == "" {
+			return "", fmt.Errorf("mode role requires assume_role (--assume-role, MFA_ASSUME_ROLE) or role_chain (--role-chain, MFA_ROLE_CHAIN)")
+		}
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid mode %q: expected one of %s", mode, strings.Join(modes, ", "))
+	}
+}
+
+// modes lists the valid modes, for error messages.
+var modes = []string{ModeSession, ModeRole, ModeFederation, ModeWebIdentity, ModeOIDC, ModeSAML, ModeSSO, ModeRolesAnywhere}
+
+// usesMFA reports whether a mode needs an MFA device and token.
+func usesMFA(mode string) bool {
+	return mode == ModeSession || mode == ModeRole
+}
+
+// needsMFASession reports whether a refresh as decided by dec asks for an MFA
+// code: always in session mode, and in role mode when neither the cached MFA
+// session nor a hop of the role chain can be reused.
+func needsMFASession(mode string, dec RefreshDecision) bool {
+	switch mode {
+	case ModeSession:
+		return true
+	case ModeRole:
+		d := &dec
+		for d.ShouldRefresh && d.Parent != nil {
+			d = d.Parent
+		}
+		return d.ShouldRefresh
+	default:
+		return false
+	}
+}
+
+// usesLongTermKeys reports whether a mode signs its STS calls with the
+// long-term IAM user keys.
+func usesLongTermKeys(mode string) bool {
+	return mode == ModeSession || mode == ModeRole || mode == ModeFederation
+}
+
+// storedMode returns the mode recorded in a short-term section. Sections
+// written before modes were recorded are told apart by assumed_role.
+func storedMode(store *credentials.Store, section string) string {
+	if v, _ := store.Get(section, "mode"); v != "" {
+		return v
+	}
+	if v, _ := store.Get(section, "assumed_role"); strings.EqualFold(v, "true") {
+		return ModeRole
+	}
+	return ModeSession
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+	"github.com/jlis/aws-mfa-go/internal/oidc"
+)
+
+// OIDCSettings configure the OIDC login of oidc mode.
+type OIDCSettings struct {
+	Issuer   string
+	ClientID string
+	Scopes   []string
+}
+
+// oidcScopes splits a space- or comma-separated scope list and makes sure
+// it requests an ID token.
+func oidcScopes(v string) []string {
+	scopes := strings.Fields(strings.ReplaceAll(v, ",", " "))
+	for _, s := range scopes {
+		if s == "openid" {
+			return scopes
+		}
+	}
+	return append([]string{"openid"}, scopes...)
+}
+
+// isLoopback reports whether host is a loopback address or localhost, which
+// may be served over plain http (for example a local mock IdP).
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// newOIDCSession obtains an ID token from the OpenID provider and exchanges it
+// for role credentials with AssumeRoleWithWebIdentity.
+//
+// The refresh token cached in the short-term section is tried first, so the
+// browser step only repeats when the provider no longer accepts it.
+func newOIDCSession(ctx context.Context, deps Deps, store *credentials.Store, opts awssts.Options, resolved Resolved) (issuedCredentials, error) {
+	httpClient, err := awssts.NewHTTPClient(opts)
+	if err != nil {
+		return issuedCredentials{}, configError(err)
+	}
+	if opts.Timeout > 0 {
+		httpClient = httpClient.WithTimeout(opts.Timeout)
+	}
+	client := oidc.Client{HTTP: httpClient, Sleep: deps.Sleep}
+	settings := resolved.OIDC
+
+	provider, err := client.Discover(ctx, settings.Issuer)
+	if err != nil {
+		return issuedCredentials{}, err
+	}
+
+	var tok oidc.Token
+	if refreshToken := cachedRefreshToken(store, resolved); refreshToken != "" {
+		tok, err = client.Refresh(ctx, provider, settings.ClientID, refreshToken, settings.Scopes)
+		if err == nil && tok.IDToken != "" {
+			if tok.RefreshToken == "" {
+				tok.RefreshToken = refreshToken
+			}
+		} else {
+			if ctx.Err() != nil {
+				return issuedCredentials{}, ctx.Err()
+			}
+			_, _ = fmt.Fprintln(deps.Stdout, "🔁 Cached OIDC login could not be refreshed, logging in again.")
+			tok = oidc.Token{}
+		}
+	}
+
+	if tok.IDToken == "" {
+		da, err := client.StartDeviceAuthorization(ctx, provider, settings.ClientID, settings.Scopes)
+		if err != nil {
+			return issuedCredentials{}, err
+		}
+		link := da.VerificationURIComplete
+		if link == "" {
+			link = da.VerificationURI
+		}
+		_, _ = fmt.Fprintf(deps.Stdout, "🌐 To sign in, open %s and confirm the code: %s\n", link, da.UserCode)
+		if deps.OpenBrowser != nil {
+			_ = deps.OpenBrowser(link)
+		}
+
+		tok, err = client.PollToken(ctx, provider, settings.ClientID, da)
+		if err != nil {
+			return issuedCredentials{}, err
+		}
+		if tok.IDToken == "" {
+			return issuedCredentials{}, errors.New("oidc token: no id_token in response (is the openid scope allowed?)")
+		}
+	}
+
+	stsClient, err := deps.STSFactory(ctx, opts, awssts.Credentials{})
+	if err != nil {
+		return issuedCredentials{}, err
+	}
+	out, err := stsClient.AssumeRoleWithWebIdentity(ctx, awssts.AssumeRoleWithWebIdentityInput{
+		RoleARN:          resolved.RoleARN,
+		RoleSessionName:  resolved.RoleSessionName,
+		WebIdentityToken: tok.IDToken,
+		DurationSeconds:  resolved.DurationSeconds,
+		Policy:           resolved.Policy,
+		PolicyARNs:       resolved.PolicyARNs,
+	})
+	if err != nil {
+		return issuedCredentials{}, err
+	}
+	return issuedCredentials{
+		AccessKeyID:      out.AccessKeyID,
+		SecretAccessKey:  out.SecretAccessKey,
+		SessionToken:     out.SessionToken,
+		Expiration:       out.Expiration,
+		OIDCRefreshToken: tok.RefreshToken,
+	}, nil
+}
+
+// cachedRefreshToken returns the refresh token cached in the short-term
+// section, if it was issued for the configured provider and client.
+func cachedRefreshToken(store *credentials.Store, resolved Resolved) string {
+	sec := resolved.ShortTermSection
+	if v, _ := store.Get(sec, "oidc_issuer"); v != resolved.OIDC.Issuer {
+		return ""
+	}
+	if v, _ := store.Get(sec, "oidc_client_id"); v != resolved.OIDC.ClientID {
+		return ""
+	}
+	v, _ := store.Get(sec, "oidc_refresh_token")
+	return v
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+func TestRun_OIDCLoginCachesRefreshToken(t *testing.T) {
+	deviceCalls := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var body any
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			body = map[string]string{"issuer": srv.URL, "device_authorization_endpoint": srv.URL + "/device", "token_endpoint": srv.URL + "/token"}
+		case "/device":
+			deviceCalls++
+			body = map[string]any{"device_code": "DEV", "user_code": "ABCD", "verification_uri": srv.URL + "/activate", "interval": 1}
+		case "/token":
+			if r.FormValue("grant_type") == "refresh_token" {
+				body = map[string]string{"id_token": "ID_REFRESHED", "refresh_token": "R2"}
+			} else {
+				body = map[string]string{"id_token": "ID_DEVICE", "refresh_token": "R1"}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("dev-long-term", "oidc_issuer", srv.URL)
+	store.Set("dev-long-term", "oidc_client_id", "aws-cli")
+	store.Set("dev-long-term", "role_arn", "arn:aws:iam::123456789012:role/developer")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+	fake := &fakeSTS{roleOut: awssts.AssumeRoleOutput{
+		AccessKeyID: "ASIA_OIDC", SecretAccessKey: "SECRET", SessionToken: "TOKEN",
+		Expiration: now.Add(time.Hour),
+	}}
+	var opened []string
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1", "USER": "alice"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = ioDiscard{}
+	deps.Sleep = func(context.Context, time.Duration) error { return nil }
+	deps.OpenBrowser = func(u string) error {
+		opened = append(opened, u)
+		return nil
+	}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+
+	in := RunInputs{Inputs: Inputs{
+		Profile:         "dev",
+		ProfileChanged:  true,
+		LongTermSuffix:  "long-term",
+		ShortTermSuffix: "none",
+		CredentialsFile: credsPath,
+	}}
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if deviceCalls != 1 || len(opened) != 1 {
+		t.Fatalf("expected one device login with a browser, got device=%d opened=%v", deviceCalls, opened)
+	}
+	if len(fake.gotWeb) != 1 || fake.gotWeb[0].WebIdentityToken != "ID_DEVICE" || fake.gotWeb[0].RoleSessionName != "alice" {
+		t.Fatalf("unexpected AssumeRoleWithWebIdentity calls: %+v", fake.gotWeb)
+	}
+
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	for k, want := range map[string]string{
+		"aws_access_key_id":  "ASIA_OIDC",
+		"mode":               ModeOIDC,
+		"oidc_issuer":        srv.URL,
+		"oidc_client_id":     "aws-cli",
+		"oidc_refresh_token": "R1",
+	} {
+		if v, _ := updated.Get("dev", k); v != want {
+			t.Fatalf("expected %s=%q, got %q", k, want, v)
+		}
+	}
+
+	// Once expired, the cached refresh token renews the session without a browser.
+	now = now.Add(2 * time.Hour)
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run (refresh): %v", err)
+	}
+	if deviceCalls != 1 {
+		t.Fatalf("expected no new device login, got %d", deviceCalls)
+	}
+	if len(fake.gotWeb) != 2 || fake.gotWeb[1].WebIdentityToken != "ID_REFRESHED" {
+		t.Fatalf("expected the refreshed ID token to be used, got %+v", fake.gotWeb)
+	}
+	updated, err = credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	if v, _ := updated.Get("dev", "oidc_refresh_token"); v != "R2" {
+		t.Fatalf("expected the rotated refresh token, got %q", v)
+	}
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+// partitionDefaultRegions is the region used for STS calls when none is
+// configured, per partition.
+var partitionDefaultRegions = map[string]string{
+	"aws":        "us-east-1",
+	"aws-cn":     "cn-north-1",
+	"aws-us-gov": "us-gov-west-1",
+	"aws-iso":    "us-iso-east-1",
+	"aws-iso-b":  "us-isob-east-1",
+}
+
+// partitionFromARN returns the partition of an ARN (arn:<partition>:...), or
+// "" when s is not an ARN, for example the serial number of a hardware device.
+func partitionFromARN(s string) string {
+	parts := strings.SplitN(strings.TrimSpace(s), ":", 3)
+	if len(parts) < 3 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[1]
+}
+
+// regionPartition returns the partition a region belongs to.
+func regionPartition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	default:
+		return "aws"
+	}
+}
+
+// resolveRegion returns the region for STS calls: flag > AWS_REGION >
+// AWS_DEFAULT_REGION > region key in the long-term section > the default
+// region of partition (the partition of the MFA device or role ARN, "" if
+// unknown). A configured region outside partition is an error, since STS
+// would reject the credentials with a confusing message.
+func resolveRegion(flagValue string, env Env, store *credentials.Store, section, partition string) (string, error) {
+	region := strings.TrimSpace(flagValue)
+	if region == "" {
+		region = strings.TrimSpace(env.Get("AWS_REGION"))
+	}
+	if region == "" {
+		region = strings.TrimSpace(env.Get("AWS_DEFAULT_REGION"))
+	}
+	if region == "" && store != nil {
+		if v, ok := store.Get(section, "region"); ok {
+			region = strings.TrimSpace(v)
+		}
+	}
+	if region == "" {
+		if def, ok := partitionDefaultRegions[partition]; ok {
+			return def, nil
+		}
+		return "us-east-1", nil
+	}
+
+	if _, known := partitionDefaultRegions[partition]; known && regionPartition(region) != partition {
+		return "", fmt.Errorf("region %s is not in partition %s", region, partition)
+	}
+	return region, nil
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+func TestPartitionFromARN(t *testing.T) {
+	tests := map[string]string{
+		"arn:aws:iam::123456789012:mfa/alice":        "aws",
+		"arn:aws-us-gov:iam::123456789012:mfa/alice": "aws-us-gov",
+		"arn:aws-cn:iam::123456789012:mfa/alice":     "aws-cn",
+		"GAHT12345678":                               "",
+		"":                                           "",
+	}
+	for in, want := range tests {
+		if got := partitionFromARN(in); got != want {
+			t.Errorf("partitionFromARN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestResolveRegion(t *testing.T) {
+	store, err := credentials.Load(filepath.Join(t.TempDir(), "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		flag      string
+		env       mapEnv
+		stored    string
+		partition string
+		want      string
+		wantErr   bool
+	}{
+		{name: "default", want: "us-east-1"},
+		{name: "govcloud default", partition: "aws-us-gov", want: "us-gov-west-1"},
+		{name: "china default", partition: "aws-cn", want: "cn-north-1"},
+		{name: "stored region", stored: "cn-northwest-1", partition: "aws-cn", want: "cn-northwest-1"},
+		{name: "env over stored", env: mapEnv{"AWS_DEFAULT_REGION": "eu-west-1"}, stored: "eu-central-1", want: "eu-west-1"},
+		{name: "flag over env", flag: "us-gov-east-1", env: mapEnv{"AWS_REGION": "us-gov-west-1"}, partition: "aws-us-gov", want: "us-gov-east-1"},
+		{name: "unknown partition", env: mapEnv{"AWS_REGION": "cn-north-1"}, want: "cn-north-1"},
+		{name: "partition mismatch", env: mapEnv{"AWS_REGION": "us-east-1"}, partition: "aws-cn", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.DeleteKey("p-long-term", "region")
+			if tt.stored != "" {
+				store.Set("p-long-term", "region", tt.stored)
+			}
+			env := tt.env
+			if env == nil {
+				env = mapEnv{}
+			}
+			got, err := resolveRegion(tt.flag, env, store, "p-long-term", tt.partition)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveRegion: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+// profileConfig is the credentials file of a profile with its region,
+// endpoint and HTTP settings, for the subcommands that call AWS outside Run.
+type profileConfig struct {
+	Profile  string
+	Names    credentials.SectionNames
+	Store    *credentials.Store
+	Region   string
+	Endpoint EndpointSettings
+	HTTP     HTTPSettings
+}
+
+// loadProfileConfig loads the credentials file and resolves the settings of
+// the profile. All errors are config errors.
+func loadProfileConfig(in Inputs, region string, env Env) (profileConfig, error) {
+	store, err := credentials.Load(ExpandHome(in.CredentialsFile))
+	if err != nil {
+		return profileConfig{}, configError(err)
+	}
+
+	profile := resolveProfile(in, env)
+	names, err := credentials.ComputeSectionNames(profile, in.LongTermSuffix, in.ShortTermSuffix)
+	if err != nil {
+		return profileConfig{}, configError(err)
+	}
+
+	endpoint, err := resolveEndpoint(in, env, store, names.LongTerm)
+	if err != nil {
+		return profileConfig{}, configError(err)
+	}
+
+	httpSettings, err := resolveHTTP(env, store, names.LongTerm)
+	if err != nil {
+		return profileConfig{}, configError(err)
+	}
+
+	region, err = resolveRegion(region, env, store, names.LongTerm, storedPartition(store, names))
+	if err != nil {
+		return profileConfig{}, configError(err)
+	}
+
+	return profileConfig{
+		Profile:  profile,
+		Names:    names,
+		Store:    store,
+		Region:   region,
+		Endpoint: endpoint,
+		HTTP:     httpSettings,
+	}, nil
+}
+
+// sourceNames returns the section names of the profile holding the access
+// keys and MFA device of a profile: the source_profile named in its long-term
+// section, or the profile itself. Role profiles generated by roles discover
+// use it to share the keys (and the cached MFA session) of their source.
+func sourceNames(store *credentials.Store, names credentials.SectionNames, in Inputs) (credentials.SectionNames, error) {
+	src, _ := store.Get(names.LongTerm, "source_profile")
+	if src = strings.TrimSpace(src); src == "" {
+		return names, nil
+	}
+	srcNames, err := credentials.ComputeSectionNames(src, in.LongTermSuffix, in.ShortTermSuffix)
+	if err != nil {
+		return credentials.SectionNames{}, err
+	}
+	if srcNames.LongTerm == names.LongTerm {
+		return credentials.SectionNames{}, fmt.Errorf("source_profile in [%s] refers to the profile itself", names.LongTerm)
+	}
+	if v, _ := store.Get(srcNames.LongTerm, "source_profile"); strings.TrimSpace(v) != "" {
+		return credentials.SectionNames{}, fmt.Errorf("source_profile in [%s] names a profile that has a source_profile itself", names.LongTerm)
+	}
+	return srcNames, nil
+}
+
+// shortTermClient is an STS client signed with the credentials of a
+// profile's short-term section, for the subcommands that inspect them.
+type shortTermClient struct {
+	profileConfig
+	STS awssts.Client
+}
+
+// newShortTermClient creates an STS client for the short-term section of the
+// profile, with the profile's endpoint, HTTP and region settings.
+func newShortTermClient(ctx context.Context, in Inputs, region string, deps Deps) (shortTermClient, error) {
+	pc, err := loadProfileConfig(in, region, deps.Env)
+	if err != nil {
+		return shortTermClient{}, err
+	}
+
+	creds, err := sectionCredentials(pc.Store, pc.Names.ShortTerm)
+	if err != nil {
+		return shortTermClient{}, configError(err)
+	}
+
+	stsClient, err := deps.STSFactory(ctx, stsOptions(pc.Region, pc.Endpoint, pc.HTTP, in.Timeout), creds)
+	if err != nil {
+		return shortTermClient{}, err
+	}
+	return shortTermClient{profileConfig: pc, STS: stsClient}, nil
+}
+
+// longTermClient is an IAM client signed with the long-term keys of a
+// profile, for the subcommands that manage the IAM user.
+type longTermClient struct {
+	profileConfig
+	Credentials awssts.Credentials
+	IAM         awsiam.Client
+}
+
+// newLongTermClient creates an IAM client for the long-term section of the
+// profile, with the profile's endpoint, HTTP and region settings. For a
+// profile with a source_profile, Names.LongTerm is the section of the source.
+func newLongTermClient(ctx context.Context, in Inputs, region string, deps Deps) (longTermClient, error) {
+	pc, err := loadProfileConfig(in, region, deps.Env)
+	if err != nil {
+		return longTermClient{}, err
+	}
+	src, err := sourceNames(pc.Store, pc.Names, in)
+	if err != nil {
+		return longTermClient{}, configError(err)
+	}
+	pc.Names.LongTerm = src.LongTerm
+
+	creds, err := sectionCredentials(pc.Store, pc.Names.LongTerm)
+	if err != nil {
+		return longTermClient{}, configError(err)
+	}
+
+	iamClient, err := deps.IAMFactory(ctx, iamOptions(pc.Region, pc.Endpoint, pc.HTTP, in.Timeout), creds)
+	if err != nil {
+		return longTermClient{}, err
+	}
+	return longTermClient{profileConfig: pc, Credentials: creds, IAM: iamClient}, nil
+}
+
+// storedPartition guesses the partition of a profile from the MFA device in
+// its long-term section or the caller ARN recorded in its short-term section.
+func storedPartition(store *credentials.Store, names credentials.SectionNames) string {
+	if v, ok := store.Get(names.LongTerm, "aws_mfa_device"); ok {
+		if p := partitionFromARN(v); p != "" {
+			return p
+		}
+	}
+	v, _ := store.Get(names.ShortTerm, "aws_caller_arn")
+	return partitionFromARN(v)
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jlis/aws-mfa-go/internal/credentials"
@@ -28,6 +29,36 @@ func ParseExpiration(exp string) (time.Time, error) {
 	return t.UTC(), nil
 }
 
+// RefreshTarget describes the short-term section a run wants to end up with.
+type RefreshTarget struct {
+	Section string
+	// Mode is the mode the section must have been produced by. Empty means
+	// ModeRole when RoleARN is set, ModeSession otherwise.
+	Mode string
+	// RoleARN is the role the section must have been assumed into.
+	// Empty means a plain MFA session (GetSessionToken).
+	RoleARN string
+	// Metadata lists additional keys the section must contain with exactly
+	// these values (an empty value means the key must be absent), for example
+	// the session tags a role was assumed with.
+	Metadata map[string]string
+	// Parent is the section the target's credentials are derived from, if any
+	// (for example the cached MFA session a role is assumed from).
+	Parent *RefreshTarget
+}
+
+// mode returns the effective mode of the target.
+func (t RefreshTarget) mode() string {
+	switch {
+	case t.Mode != "":
+		return t.Mode
+	case t.RoleARN != "":
+		return ModeRole
+	default:
+		return ModeSession
+	}
+}
+
 type RefreshDecision struct {
 	ShouldRefresh bool
 	// ExpiresAt is only set when a valid expiration was present.
@@ -35,6 +66,10 @@ type RefreshDecision struct {
 	// Remaining is only set when a valid expiration was present.
 	Remaining *time.Duration
 	Reason    string
+	// Parent is only set when a refresh is needed and the target has a parent.
+	// A parent that does not need a refresh can be used to re-derive the target
+	// without prompting for a new MFA token.
+	Parent *RefreshDecision
 }
 
 // DecideRefresh determines whether we need to fetch new short-term credentials.
@@ -43,12 +78,29 @@ type RefreshDecision struct {
 // - If `--force`, always refresh
 // - If short-term section missing, refresh
 // - If required keys missing/empty/invalid, refresh
+// - If the section was obtained for a different role (or no role), refresh
+// - If the section was produced by a different mode, refresh
+// - If the section was obtained with different settings (target.Metadata), refresh
+// - If the section's parent_section differs from target.Parent, refresh
 // - Otherwise, refresh only when expired
-func DecideRefresh(now time.Time, store *credentials.Store, shortTermSection string, force bool) RefreshDecision {
+//
+// When a refresh is needed and the target has a parent, the parent is evaluated
+// with the same rules and reported in RefreshDecision.Parent.
+func DecideRefresh(now time.Time, store *credentials.Store, target RefreshTarget, force bool) RefreshDecision {
+	dec := decideSection(now, store, target, force)
+	if dec.ShouldRefresh && target.Parent != nil {
+		parent := DecideRefresh(now, store, *target.Parent, force)
+		dec.Parent = &parent
+	}
+	return dec
+}
+
+func decideSection(now time.Time, store *credentials.Store, target RefreshTarget, force bool) RefreshDecision {
 	if force {
 		return RefreshDecision{ShouldRefresh: true, Reason: "forced refresh"}
 	}
 
+	shortTermSection := target.Section
 	if !store.HasSection(shortTermSection) {
 		return RefreshDecision{ShouldRefresh: true, Reason: "short-term section missing"}
 	}
@@ -60,6 +112,28 @@ func DecideRefresh(now time.Time, store *credentials.Store, shortTermSection str
 		}
 	}
 
+	if storedRoleARN(store, shortTermSection) != target.RoleARN {
+		return RefreshDecision{ShouldRefresh: true, Reason: "role changed"}
+	}
+
+	if storedMode(store, shortTermSection) != target.mode() {
+		return RefreshDecision{ShouldRefresh: true, Reason: "mode changed"}
+	}
+
+	for k, want := range target.Metadata {
+		if got, _ := store.Get(shortTermSection, k); got != want {
+			return RefreshDecision{ShouldRefresh: true, Reason: "settings changed"}
+		}
+	}
+
+	wantParent := ""
+	if target.Parent != nil {
+		wantParent = target.Parent.Section
+	}
+	if got, _ := store.Parent(shortTermSection); got != wantParent {
+		return RefreshDecision{ShouldRefresh: true, Reason: "parent changed"}
+	}
+
 	expStr, _ := store.Get(shortTermSection, "expiration")
 	exp, err := ParseExpiration(expStr)
 	if err != nil {
@@ -73,3 +147,13 @@ func DecideRefresh(now time.Time, store *credentials.Store, shortTermSection str
 
 	return RefreshDecision{ShouldRefresh: false, ExpiresAt: &exp, Remaining: &remaining, Reason: "still valid"}
 }
+
+// storedRoleARN returns the role recorded in a short-term section, or "" when
+// the section holds a plain MFA session.
+func storedRoleARN(store *credentials.Store, section string) string {
+	if v, _ := store.Get(section, "assumed_role"); !strings.EqualFold(v, "true") {
+		return ""
+	}
+	v, _ := store.Get(section, "assumed_role_arn")
+	return v
+}
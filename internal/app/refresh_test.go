@@ -2,6 +2,7 @@ package app
 
 import (
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,7 +29,7 @@ func TestDecideRefresh_MissingSection(t *testing.T) {
 		t.Fatalf("Load: %v", err)
 	}
 
-	dec := DecideRefresh(time.Now().UTC(), store, "default", false)
+	dec := DecideRefresh(time.Now().UTC(), store, RefreshTarget{Section: "default"}, false)
 	if !dec.ShouldRefresh {
 		t.Fatalf("expected refresh when section missing")
 	}
@@ -51,7 +52,7 @@ func TestDecideRefresh_StillValid(t *testing.T) {
 	store.Set(sec, "aws_security_token", "TOKEN")
 	store.Set(sec, "expiration", exp.Format(expirationLayout))
 
-	dec := DecideRefresh(now, store, sec, false)
+	dec := DecideRefresh(now, store, RefreshTarget{Section: sec}, false)
 	if dec.ShouldRefresh {
 		t.Fatalf("expected no refresh when still valid, got reason=%q", dec.Reason)
 	}
@@ -80,7 +81,7 @@ func TestDecideRefresh_Expired(t *testing.T) {
 	store.Set(sec, "aws_security_token", "TOKEN")
 	store.Set(sec, "expiration", exp.Format(expirationLayout))
 
-	dec := DecideRefresh(now, store, sec, false)
+	dec := DecideRefresh(now, store, RefreshTarget{Section: sec}, false)
 	if !dec.ShouldRefresh {
 		t.Fatalf("expected refresh when expired")
 	}
@@ -93,8 +94,198 @@ func TestDecideRefresh_Force(t *testing.T) {
 		t.Fatalf("Load: %v", err)
 	}
 
-	dec := DecideRefresh(time.Now().UTC(), store, "default", true)
+	dec := DecideRefresh(time.Now().UTC(), store, RefreshTarget{Section: "default"}, true)
 	if !dec.ShouldRefresh {
 		t.Fatalf("expected refresh when forced")
 	}
 }
+
+func TestDecideRefresh_RoleChanged(t *testing.T) {
+	dir := t.TempDir()
+	store, err := credentials.Load(filepath.Join(dir, "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	exp := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+
+	sec := "default"
+	store.Set(sec, "aws_access_key_id", "ASIA_TEST")
+	store.Set(sec, "aws_secret_access_key", "SECRET")
+	store.Set(sec, "aws_session_token", "TOKEN")
+	store.Set(sec, "aws_security_token", "TOKEN")
+	store.Set(sec, "expiration", exp.Format(expirationLayout))
+	store.Set(sec, "assumed_role", "True")
+	store.Set(sec, "assumed_role_arn", "arn:aws:iam::123456789012:role/old")
+
+	dec := DecideRefresh(now, store, RefreshTarget{Section: sec, RoleARN: "arn:aws:iam::123456789012:role/new"}, false)
+	if !dec.ShouldRefresh || dec.Reason != "role changed" {
+		t.Fatalf("expected refresh for a different role, got %+v", dec)
+	}
+
+	dec = DecideRefresh(now, store, RefreshTarget{Section: sec}, false)
+	if !dec.ShouldRefresh || dec.Reason != "role changed" {
+		t.Fatalf("expected refresh when switching back to a plain session, got %+v", dec)
+	}
+
+	dec = DecideRefresh(now, store, RefreshTarget{Section: sec, RoleARN: "arn:aws:iam::123456789012:role/old"}, false)
+	if dec.ShouldRefresh {
+		t.Fatalf("expected no refresh for the same role, got reason=%q", dec.Reason)
+	}
+}
+
+func TestDecideRefresh_EvaluatesParentWhenChildExpired(t *testing.T) {
+	dir := t.TempDir()
+	store, err := credentials.Load(filepath.Join(dir, "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 12, 0, 0, 0, time.UTC)
+	for sec, exp := range map[string]time.Time{
+		"prod":             now.Add(-time.Minute),
+		"prod-mfa-session": now.Add(time.Hour),
+	} {
+		store.Set(sec, "aws_access_key_id", "ASIA_TEST")
+		store.Set(sec, "aws_secret_access_key", "SECRET")
+		store.Set(sec, "aws_session_token", "TOKEN")
+		store.Set(sec, "aws_security_token", "TOKEN")
+		store.Set(sec, "expiration", exp.Format(expirationLayout))
+	}
+	store.Set("prod", "assumed_role", "True")
+	store.Set("prod", "assumed_role_arn", "arn:aws:iam::123456789012:role/admin")
+
+	target := RefreshTarget{
+		Section: "prod",
+		RoleARN: "arn:aws:iam::123456789012:role/admin",
+		Parent:  &RefreshTarget{Section: "prod-mfa-session"},
+	}
+
+	dec := DecideRefresh(now, store, target, false)
+	if !dec.ShouldRefresh {
+		t.Fatalf("expected child refresh when expired")
+	}
+	if dec.Parent == nil || dec.Parent.ShouldRefresh {
+		t.Fatalf("expected valid parent, got %+v", dec.Parent)
+	}
+
+	dec = DecideRefresh(now.Add(2*time.Hour), store, target, false)
+	if dec.Parent == nil || !dec.Parent.ShouldRefresh {
+		t.Fatalf("expected parent refresh when expired, got %+v", dec.Parent)
+	}
+
+	dec = DecideRefresh(now, store, target, true)
+	if dec.Parent == nil || !dec.Parent.ShouldRefresh {
+		t.Fatalf("expected forced refresh to include the parent, got %+v", dec.Parent)
+	}
+}
+
+func TestDecideRefresh_ModeChanged(t *testing.T) {
+	store, err := credentials.Load(filepath.Join(t.TempDir(), "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	sec := "default"
+	store.Set(sec, "aws_access_key_id", "ASIA_TEST")
+	store.Set(sec, "aws_secret_access_key", "SECRET")
+	store.Set(sec, "aws_session_token", "TOKEN")
+	store.Set(sec, "aws_security_token", "TOKEN")
+	store.Set(sec, "expiration", now.Add(time.Hour).Format(expirationLayout))
+	store.Set(sec, "assumed_role", "False")
+
+	// Sections written without a mode key hold plain MFA sessions.
+	if dec := DecideRefresh(now, store, RefreshTarget{Section: sec}, false); dec.ShouldRefresh {
+		t.Fatalf("expected no refresh for a legacy session section, got reason=%q", dec.Reason)
+	}
+
+	dec := DecideRefresh(now, store, RefreshTarget{Section: sec, Mode: ModeFederation}, false)
+	if !dec.ShouldRefresh || dec.Reason != "mode changed" {
+		t.Fatalf("expected refresh when switching to federation, got %+v", dec)
+	}
+
+	store.Set(sec, "mode", ModeFederation)
+	if dec := DecideRefresh(now, store, RefreshTarget{Section: sec, Mode: ModeFederation}, false); dec.ShouldRefresh {
+		t.Fatalf("expected no refresh for the same mode, got reason=%q", dec.Reason)
+	}
+}
+
+func TestDecideRefresh_ParentChanged(t *testing.T) {
+	store, err := credentials.Load(filepath.Join(t.TempDir(), "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 12, 0, 0, 0, time.UTC)
+	store.Set("prod", "aws_access_key_id", "ASIA_TEST")
+	store.Set("prod", "aws_secret_access_key", "SECRET")
+	store.Set("prod", "aws_session_token", "TOKEN")
+	store.Set("prod", "aws_security_token", "TOKEN")
+	store.Set("prod", "expiration", now.Add(time.Hour).Format(expirationLayout))
+	store.Set("prod", "assumed_role", "True")
+	store.Set("prod", "assumed_role_arn", "arn:aws:iam::123456789012:role/admin")
+	// Assumed through a hop of a role chain that is no longer configured.
+	store.SetParent("prod", "prod-hop-1")
+
+	target := RefreshTarget{
+		Section: "prod",
+		RoleARN: "arn:aws:iam::123456789012:role/admin",
+		Parent:  &RefreshTarget{Section: "prod-mfa-session"},
+	}
+	if dec := DecideRefresh(now, store, target, false); !dec.ShouldRefresh || dec.Reason != "parent changed" {
+		t.Fatalf("expected refresh because the parent changed, got %+v", dec)
+	}
+
+	store.SetParent("prod", "prod-mfa-session")
+	if dec := DecideRefresh(now, store, target, false); dec.ShouldRefresh {
+		t.Fatalf("expected valid credentials with the recorded parent, got %+v", dec)
+	}
+}
+
+func TestDecideRefresh_ExternalIDChanged(t *testing.T) {
+	store, err := credentials.Load(filepath.Join(t.TempDir(), "credentials"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 12, 0, 0, 0, time.UTC)
+	resolved := Resolved{
+		Mode:             ModeRole,
+		RoleARN:          "arn:aws:iam::123456789012:role/partner",
+		ExternalID:       "first-id",
+		ShortTermSection: "prod",
+		SessionSection:   "prod-mfa-session",
+	}
+	store.Set("prod", "aws_access_key_id", "ASIA_TEST")
+	store.Set("prod", "aws_secret_access_key", "SECRET")
+	store.Set("prod", "aws_session_token", "TOKEN")
+	store.Set("prod", "aws_security_token", "TOKEN")
+	store.Set("prod", "expiration", now.Add(time.Hour).Format(expirationLayout))
+	store.Set("prod", "assumed_role", "True")
+	store.Set("prod", "assumed_role_arn", resolved.RoleARN)
+	store.SetParent("prod", "prod-mfa-session")
+	for k, v := range refreshTarget(resolved).Metadata {
+		if v != "" {
+			store.Set("prod", k, v)
+		}
+	}
+	if v, _ := store.Get("prod", "external_id_hash"); v == "" || strings.Contains(v, "first-id") {
+		t.Fatalf("expected a fingerprint of the external ID, got %q", v)
+	}
+
+	if dec := DecideRefresh(now, store, refreshTarget(resolved), false); dec.ShouldRefresh {
+		t.Fatalf("expected no refresh with the same external ID, got %+v", dec)
+	}
+
+	resolved.ExternalID = "second-id"
+	if dec := DecideRefresh(now, store, refreshTarget(resolved), false); !dec.ShouldRefresh || dec.Reason != "settings changed" {
+		t.Fatalf("expected refresh after changing the external ID, got %+v", dec)
+	}
+
+	resolved.ExternalID = ""
+	if dec := DecideRefresh(now, store, refreshTarget(resolved), false); !dec.ShouldRefresh || dec.Reason != "settings changed" {
+		t.Fatalf("expected refresh after dropping the external ID, got %+v", dec)
+	}
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+// chainedRoleMaxDuration is the STS limit for role sessions assumed with
+// credentials of another role session (role chaining).
+const chainedRoleMaxDuration = 3600
+
+// refreshTarget describes the short-term section a run produces, including
+// (in role mode) the chain of sections it is derived from: the cached MFA
+// session, then one section per intermediate role, then the short-term section.
+func refreshTarget(resolved Resolved) RefreshTarget {
+	md := sessionMetadata(resolved)
+	for k, v := range modeMetadata(resolved) {
+		md[k] = v
+	}
+	if resolved.Mode != ModeRole {
+		for k, v := range scopeMetadata(resolved) {
+			md[k] = v
+		}
+		md["external_id_hash"] = ""
+		return RefreshTarget{Section: resolved.ShortTermSection, Mode: resolved.Mode, RoleARN: resolved.RoleARN, Metadata: md}
+	}
+
+	target := &RefreshTarget{Section: resolved.SessionSection}
+	for i, arn := range resolved.RoleChain {
+		target = &RefreshTarget{Section: resolved.HopSections[i], RoleARN: arn, Metadata: md, Parent: target}
+	}
+	final := scopeMetadata(resolved)
+	for k, v := range md {
+		final[k] = v
+	}
+	final["external_id_hash"] = externalIDHash(resolved.ExternalID)
+	return RefreshTarget{Section: resolved.ShortTermSection, RoleARN: resolved.RoleARN, Metadata: final, Parent: target}
+}
+
+// sessionMetadata returns the settings recorded in (and compared against)
+// role sections. Outside role mode all values are empty, which removes stale keys.
+func sessionMetadata(resolved Resolved) map[string]string {
+	return map[string]string{
+		"session_tags":        formatTags(resolved.SessionTags),
+		"transitive_tag_keys": formatKeys(resolved.TransitiveTagKeys),
+		"source_identity":     resolved.SourceIdentity,
+	}
+}
+
+// modeMetadata returns the settings specific to the federation, oidc, sso and
+// roles-anywhere modes.
+// In other modes all values are empty, which removes stale keys.
+func modeMetadata(resolved Resolved) map[string]string {
+	return map[string]string{
+		"federated_user_name": resolved.FederatedUserName,
+		"oidc_issuer":         resolved.OIDC.Issuer,
+		"oidc_client_id":      resolved.OIDC.ClientID,
+		"sso_start_url":       resolved.SSO.StartURL,
+		"sso_account_id":      resolved.SSO.AccountID,
+		"sso_role_name":       resolved.SSO.RoleName,
+		"trust_anchor_arn":    resolved.RolesAnywhere.TrustAnchorARN,
+		"profile_arn":         resolved.RolesAnywhere.ProfileARN,
+	}
+}
+
+// externalIDHash returns the fingerprint recorded for the external ID sent
+// when assuming the target role, or "" when there is none. Like session
+// policies, only the hash is written to the credentials file.
+func externalIDHash(externalID string) string {
+	if externalID == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(externalID))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// scopeMetadata returns the markers written to sections whose credentials were
+// scoped down with session policies: `scoped = True`, a fingerprint of the
+// inline policy, and the managed policy ARNs.
+func scopeMetadata(resolved Resolved) map[string]string {
+	md := map[string]string{
+		"scoped":              "",
+		"session_policy_hash": "",
+		"session_policy_arns": formatKeys(resolved.PolicyARNs),
+	}
+	if resolved.Policy != "" {
+		sum := sha256.Sum256([]byte(resolved.Policy))
+		md["session_policy_hash"] = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	if resolved.Policy != "" || len(resolved.PolicyARNs) > 0 {
+		md["scoped"] = "True"
+	}
+	return md
+}
+
+// assumeRoleChain obtains role credentials for the short-term section.
+//
+// It starts from the closest ancestor of target that is still valid according
+// to dec (a cached hop or the cached MFA session) so that no MFA token is
+// needed, and only falls back to a new MFA session when nothing can be reused.
+// Every section it renews is written to store along with its parent.
+func assumeRoleChain(ctx context.Context, deps Deps, store *credentials.Store, opts awssts.Options, longTerm awssts.Credentials, resolved Resolved, target RefreshTarget, dec RefreshDecision) (issuedCredentials, error) {
+	// levels[0] is the MFA session, levels[1:] are the roles in order.
+	var levels []RefreshTarget
+	for t := &target; t != nil; t = t.Parent {
+		levels = append([]RefreshTarget{*t}, levels...)
+	}
+
+	// Find the deepest level that does not need a refresh (-1 if none).
+	level := len(levels) - 1
+	for d := &dec; d != nil && d.ShouldRefresh; d = d.Parent {
+		level--
+	}
+
+	var source awssts.Credentials
+	if level < 0 {
+		session, err := newMFASession(ctx, deps, opts, longTerm, resolved, resolved.SessionDuration)
+		if err != nil {
+			return issuedCredentials{}, err
+		}
+		writeShortTerm(store, levels[0], session)
+		source = session.credentials()
+		level = 0
+	} else {
+		_, _ = fmt.Fprintf(deps.Stdout, "🔗 Reusing valid credentials in [%s], no MFA code needed.\n", levels[level].Section)
+		var err error
+		source, err = sectionCredentials(store, levels[level].Section)
+		if err != nil {
+			return issuedCredentials{}, err
+		}
+	}
+
+	var issued issuedCredentials
+	for i := level + 1; i < len(levels); i++ {
+		hop := levels[i]
+		in := awssts.AssumeRoleInput{
+			RoleARN:         hop.RoleARN,
+			RoleSessionName: resolved.RoleSessionName,
+			DurationSeconds: chainedRoleMaxDuration,
+		}
+		if i == 1 {
+			// Tags and source identity are set on the first role; transitive
+			// tags and the source identity carry over to the rest of the chain.
+			in.Tags = resolved.SessionTags
+			in.TransitiveTagKeys = resolved.TransitiveTagKeys
+			in.SourceIdentity = resolved.SourceIdentity
+		}
+		if i == len(levels)-1 {
+			// The external ID, requested duration and session policies apply
+			// to the target role.
+			in.ExternalID = resolved.ExternalID
+			in.DurationSeconds = resolved.DurationSeconds
+			in.Policy = resolved.Policy
+			in.PolicyARNs = resolved.PolicyARNs
+		}
+
+		stsClient, err := deps.STSFactory(ctx, opts, source)
+		if err != nil {
+			return issuedCredentials{}, err
+		}
+		out, err := stsClient.AssumeRole(ctx, in)
+		if err != nil {
+			return issuedCredentials{}, err
+		}
+
+		issued = issuedCredentials{
+			AccessKeyID:     out.AccessKeyID,
+			SecretAccessKey: out.SecretAccessKey,
+			SessionToken:    out.SessionToken,
+			Expiration:      out.Expiration,
+		}
+		writeShortTerm(store, hop, issued)
+		source = issued.credentials()
+	}
+	return issued, nil
+}
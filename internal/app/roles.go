@@ -0,0 +1,503 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+type RolesDiscoverInputs struct {
+	// Only the profile, suffix and credentials file fields are used.
+	Inputs
+	// Region is optional; if empty, we will fall back to env, the region key
+	// in the long-term section, then the default region of the partition.
+	Region string
+
+	// Target is where role profiles are generated: RoleTargetConfig,
+	// RoleTargetTool, RoleTargetBoth, or "" to ask (not asked with JSON).
+	Target string
+	// ConfigFile is the AWS config file for RoleTargetConfig and RoleTargetBoth:
+	// flag > AWS_CONFIG_FILE > ~/.aws/config.
+	ConfigFile string
+	JSON       bool
+}
+
+// Role profile targets of roles discover.
+const (
+	// RoleTargetConfig adds profiles with role_arn and source_profile to the
+	// AWS config file, so the SDKs assume the roles themselves.
+	RoleTargetConfig = "config"
+	// RoleTargetTool adds long-term sections with assume_role and
+	// source_profile to the credentials file, so aws-mfa-go assumes the roles.
+	RoleTargetTool = "tool"
+	// RoleTargetBoth does both, so the SDKs and aws-mfa-go know the roles.
+	RoleTargetBoth = "both"
+)
+
+// DiscoveredRole is a role the IAM user may assume, printed by RolesDiscover
+// (as JSON with --json).
+type DiscoveredRole struct {
+	RoleARN string `json:"role_arn"`
+	// Wildcard is set when the resource is a pattern, which has to be
+	// completed by hand; no profile is generated for it.
+	Wildcard bool `json:"wildcard"`
+	// Profile is the name suggested for the role's profile.
+	Profile string `json:"profile,omitempty"`
+	// GrantedBy lists the policies allowing sts:AssumeRole on the role.
+	GrantedBy []string `json:"granted_by"`
+}
+
+// RolesDiscover lists the roles the IAM user of a profile may assume, read
+// from the sts:AssumeRole statements of its attached, inline and group
+// policies, and offers to generate a profile for each of them.
+func RolesDiscover(ctx context.Context, in RolesDiscoverInputs, deps Deps) error {
+	if deps.Env == nil || deps.IAMFactory == nil {
+		return errors.New("missing required dependencies")
+	}
+	if deps.Stdout == nil {
+		deps.Stdout = io.Discard
+	}
+	if deps.Stdin == nil {
+		deps.Stdin = strings.NewReader("")
+	}
+	switch in.Target {
+	case "", RoleTargetConfig, RoleTargetTool, RoleTargetBoth:
+	default:
+		return configError(fmt.Errorf("invalid target %q: expected %s, %s or %s", in.Target, RoleTargetConfig, RoleTargetTool, RoleTargetBoth))
+	}
+
+	c, err := newLongTermClient(ctx, in.Inputs, in.Region, deps)
+	if err != nil {
+		return err
+	}
+	own, err := credentials.ComputeSectionNames(c.Profile, in.LongTermSuffix, in.ShortTermSuffix)
+	if err != nil {
+		return configError(err)
+	}
+	if src, _ := c.Store.Get(own.LongTerm, "source_profile"); strings.TrimSpace(src) != "" {
+		return configError(fmt.Errorf("profile %s uses the keys of source_profile %s: discover roles with --profile %s", c.Profile, strings.TrimSpace(src), strings.TrimSpace(src)))
+	}
+
+	user, err := c.IAM.GetUser(ctx)
+	if err != nil {
+		return err
+	}
+	policies, err := readUserPolicies(ctx, c, user.UserName)
+	if err != nil {
+		return err
+	}
+
+	roles, err := assumableRoles(policies)
+	if err != nil {
+		return err
+	}
+	nameRoleProfiles(c.Profile, roles)
+
+	if in.JSON {
+		enc := json.NewEncoder(deps.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(roles); err != nil {
+			return err
+		}
+	} else {
+		printDiscoveredRoles(deps.Stdout, user.UserName, roles)
+	}
+
+	var concrete []DiscoveredRole
+	for _, r := range roles {
+		if !r.Wildcard {
+			concrete = append(concrete, r)
+		}
+	}
+	if len(concrete) == 0 || (in.JSON && in.Target == "") {
+		return nil
+	}
+
+	configFile := strings.TrimSpace(in.ConfigFile)
+	if configFile == "" {
+		configFile = strings.TrimSpace(deps.Env.Get("AWS_CONFIG_FILE"))
+	}
+	if configFile == "" {
+		configFile = "~/.aws/config"
+	}
+
+	target := in.Target
+	if target == "" {
+		_, _ = fmt.Fprintf(deps.Stdout, "\n📝 Generate profiles for %d roles in %s (c), as aws-mfa-go profiles in %s (t), both (b), or not at all (n)? [n]: ", len(concrete), configFile, c.Store.Path())
+		answer, err := readLine(ctx, deps.Stdout, deps.Stdin)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			return fmt.Errorf("read answer: %w", err)
+		}
+		switch strings.ToLower(answer) {
+		case "c", RoleTargetConfig:
+			target = RoleTargetConfig
+		case "t", RoleTargetTool:
+			target = RoleTargetTool
+		case "b", RoleTargetBoth:
+			target = RoleTargetBoth
+		default:
+			_, _ = fmt.Fprintln(deps.Stdout, "❎ No profiles generated.")
+			return nil
+		}
+	}
+
+	if target == RoleTargetConfig || target == RoleTargetBoth {
+		if err := writeConfigProfiles(deps.Stdout, configFile, roleSourceSection(c), concrete); err != nil {
+			return err
+		}
+	}
+	if target == RoleTargetTool || target == RoleTargetBoth {
+		return writeToolProfiles(deps.Stdout, c, in.Inputs, concrete)
+	}
+	return nil
+}
+
+// userPolicy is a policy document that applies to the IAM user, with a
+// description of where it comes from.
+type userPolicy struct {
+	Source   string
+	Document string
+}
+
+// readUserPolicies reads the documents of the managed and inline policies of
+// a user and of its groups. Managed policies attached more than once are
+// read once.
+func readUserPolicies(ctx context.Context, c longTermClient, userName string) ([]userPolicy, error) {
+	var policies []userPolicy
+	managed := map[string]string{}
+	addManaged := func(prefix, name, arn string) error {
+		doc, ok := managed[arn]
+		if !ok {
+			var err error
+			if doc, err = c.IAM.GetPolicyDocument(ctx, arn); err != nil {
+				return err
+			}
+			managed[arn] = doc
+		}
+		policies = append(policies, userPolicy{Source: prefix + "policy " + name, Document: doc})
+		return nil
+	}
+
+	attached, err := c.IAM.ListAttachedUserPolicies(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range attached {
+		if err := addManaged("", p.PolicyName, p.PolicyARN); err != nil {
+			return nil, err
+		}
+	}
+	inline, err := c.IAM.ListUserPolicies(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range inline {
+		doc, err := c.IAM.GetUserPolicy(ctx, userName, name)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, userPolicy{Source: "inline policy " + name, Document: doc})
+	}
+
+	groups, err := c.IAM.ListGroupsForUser(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		prefix := "group " + group + ": "
+		attached, err := c.IAM.ListAttachedGroupPolicies(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range attached {
+			if err := addManaged(prefix, p.PolicyName, p.PolicyARN); err != nil {
+				return nil, err
+			}
+		}
+		inline, err := c.IAM.ListGroupPolicies(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range inline {
+			doc, err := c.IAM.GetGroupPolicy(ctx, group, name)
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, userPolicy{Source: prefix + "inline policy " + name, Document: doc})
+		}
+	}
+	return policies, nil
+}
+
+// policyDocument is the part of an IAM policy document roles discover reads.
+type policyDocument struct {
+	Statement statementList `json:"Statement"`
+}
+
+type policyStatement struct {
+	Effect   string     `json:"Effect"`
+	Action   stringList `json:"Action"`
+	Resource stringList `json:"Resource"`
+}
+
+// statementList accepts a single statement where IAM allows one instead of a list.
+type statementList []policyStatement
+
+func (l *statementList) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '{' {
+		var s policyStatement
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*l = statementList{s}
+		return nil
+	}
+	var s []policyStatement
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*l = s
+	return nil
+}
+
+// stringList accepts a single string where IAM allows one instead of a list.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*l = stringList{s}
+		return nil
+	}
+	var s []string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*l = s
+	return nil
+}
+
+// assumableRoles returns the resources of the Allow statements whose actions
+// match sts:AssumeRole, with the policies granting them: role ARNs first,
+// then wildcard patterns, each sorted. Deny statements and conditions are
+// not evaluated, so the list may include roles that cannot be assumed.
+func assumableRoles(policies []userPolicy) ([]DiscoveredRole, error) {
+	byARN := map[string]*DiscoveredRole{}
+	var arns []string
+	for _, p := range policies {
+		var doc policyDocument
+		if err := json.Unmarshal([]byte(p.Document), &doc); err != nil {
+			return nil, fmt.Errorf("%s is not a valid policy document: %w", p.Source, err)
+		}
+		for _, s := range doc.Statement {
+			if !strings.EqualFold(s.Effect, "Allow") || !allowsAssumeRole(s.Action) {
+				continue
+			}
+			for _, res := range s.Resource {
+				res = strings.TrimSpace(res)
+				wildcard := strings.ContainsAny(res, "*?")
+				if !wildcard && !strings.Contains(res, ":role/") {
+					continue
+				}
+				r, ok := byARN[res]
+				if !ok {
+					r = &DiscoveredRole{RoleARN: res, Wildcard: wildcard, GrantedBy: []string{}}
+					byARN[res] = r
+					arns = append(arns, res)
+				}
+				if n := len(r.GrantedBy); n == 0 || r.GrantedBy[n-1] != p.Source {
+					r.GrantedBy = append(r.GrantedBy, p.Source)
+				}
+			}
+		}
+	}
+
+	sort.Slice(arns, func(i, j int) bool {
+		a, b := byARN[arns[i]], byARN[arns[j]]
+		if a.Wildcard != b.Wildcard {
+			return !a.Wildcard
+		}
+		return a.RoleARN < b.RoleARN
+	})
+	roles := make([]DiscoveredRole, 0, len(arns))
+	for _, arn := range arns {
+		roles = append(roles, *byARN[arn])
+	}
+	return roles, nil
+}
+
+// allowsAssumeRole reports whether one of the actions (which may be
+// patterns such as sts:* or *) matches sts:AssumeRole.
+func allowsAssumeRole(actions []string) bool {
+	for _, a := range actions {
+		if ok, _ := path.Match(strings.ToLower(strings.TrimSpace(a)), "sts:assumerole"); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// nameRoleProfiles suggests a profile name for each role that is not a
+// wildcard: <profile>-<role name>, or <profile>-<account>-<role name> when
+// roles of several accounts share a name.
+func nameRoleProfiles(profile string, roles []DiscoveredRole) {
+	count := map[string]int{}
+	for _, r := range roles {
+		if !r.Wildcard {
+			count[roleName(r.RoleARN)]++
+		}
+	}
+	for i, r := range roles {
+		if r.Wildcard {
+			continue
+		}
+		name := roleName(r.RoleARN)
+		if count[name] > 1 {
+			name = accountFromARN(r.RoleARN) + "-" + name
+		}
+		roles[i].Profile = profile + "-" + name
+	}
+}
+
+// roleName returns the name of a role ARN, without its path.
+func roleName(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
+
+// printDiscoveredRoles prints the roles as a table.
+func printDiscoveredRoles(w io.Writer, userName string, roles []DiscoveredRole) {
+	if len(roles) == 0 {
+		_, _ = fmt.Fprintf(w, "🔎 No sts:AssumeRole permissions found in the policies of %s.\n", userName)
+		return
+	}
+	_, _ = fmt.Fprintf(w, "🔎 %s may assume %d roles:\n\n", userName, len(roles))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ROLE\tPROFILE\tGRANTED BY")
+	wildcards := 0
+	for _, r := range roles {
+		profile := r.Profile
+		if r.Wildcard {
+			wildcards++
+			profile = "⚠️ wildcard"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", r.RoleARN, profile, strings.Join(r.GrantedBy, "; "))
+	}
+	_ = tw.Flush()
+	if wildcards > 0 {
+		_, _ = fmt.Fprintf(w, "\n⚠️ %d wildcard resources match several roles: complete them by hand, for example with --assume-role.\n", wildcards)
+	}
+}
+
+// roleSourceSection returns the credentials section the SDKs assume roles
+// from: the short-term section, or the cached MFA session when the profile
+// assumes a role itself.
+func roleSourceSection(c longTermClient) string {
+	for _, key := range []string{"assume_role", "role_chain"} {
+		if v, _ := c.Store.Get(c.Names.LongTerm, key); strings.TrimSpace(v) != "" {
+			return c.Names.Session
+		}
+	}
+	return c.Names.ShortTerm
+}
+
+// writeConfigProfiles adds a [profile <name>] section with role_arn and
+// source_profile to the AWS config file for each role. Existing profiles are
+// left alone.
+//
+// The sections are appended as text: saving the file through the ini store
+// would flatten nested settings such as "s3 =" followed by indented keys.
+func writeConfigProfiles(w io.Writer, configFile, sourceSection string, roles []DiscoveredRole) error {
+	file := ExpandHome(configFile)
+	config, err := credentials.Load(file)
+	if err != nil {
+		return configError(err)
+	}
+	raw, err := os.ReadFile(file) //nolint:gosec // G304: path is user-provided configuration
+	if err != nil && !os.IsNotExist(err) {
+		return configError(fmt.Errorf("read %s: %w", configFile, err))
+	}
+
+	var text strings.Builder
+	if len(raw) > 0 && raw[len(raw)-1] != '\n' {
+		text.WriteString("\n")
+	}
+	added := 0
+	for _, r := range roles {
+		section := "profile " + r.Profile
+		if config.HasSection(section) {
+			_, _ = fmt.Fprintf(w, "⏭️ [%s] already exists in %s, skipped.\n", section, configFile)
+			continue
+		}
+		if len(raw) > 0 || added > 0 {
+			text.WriteString("\n")
+		}
+		_, _ = fmt.Fprintf(&text, "[%s]\nrole_arn = %s\nsource_profile = %s\n", section, r.RoleARN, sourceSection)
+		_, _ = fmt.Fprintf(w, "➕ Added [%s].\n", section)
+		added++
+	}
+	if added == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600) //nolint:gosec // G304: path is user-provided configuration
+	if err != nil {
+		return fmt.Errorf("open %s: %w", configFile, err)
+	}
+	if _, err := io.WriteString(f, text.String()); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write %s: %w", configFile, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write %s: %w", configFile, err)
+	}
+	_, _ = fmt.Fprintf(w, "✅ Added %d profiles to %s; they use the credentials in [%s], keep them fresh with aws-mfa-go.\n", added, configFile, sourceSection)
+	return nil
+}
+
+// writeToolProfiles adds a long-term section with assume_role and a
+// source_profile to the credentials file for each role, so
+// aws-mfa-go --profile <name> assumes it with the keys and MFA session of the
+// source profile. Existing sections are left alone.
+func writeToolProfiles(w io.Writer, c longTermClient, in Inputs, roles []DiscoveredRole) error {
+	added := 0
+	for _, r := range roles {
+		names, err := credentials.ComputeSectionNames(r.Profile, in.LongTermSuffix, in.ShortTermSuffix)
+		if err != nil {
+			return configError(err)
+		}
+		if c.Store.HasSection(names.LongTerm) {
+			_, _ = fmt.Fprintf(w, "⏭️ [%s] already exists, skipped.\n", names.LongTerm)
+			continue
+		}
+		c.Store.Set(names.LongTerm, "source_profile", c.Profile)
+		c.Store.Set(names.LongTerm, "assume_role", r.RoleARN)
+		_, _ = fmt.Fprintf(w, "➕ Added [%s], refresh it with: aws-mfa-go --profile %s\n", names.LongTerm, r.Profile)
+		added++
+	}
+	if added == 0 {
+		return nil
+	}
+	if err := c.Store.SaveAtomic(); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "✅ Added %d profiles to %s.\n", added, c.Store.Path())
+	return nil
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+func TestAssumableRoles(t *testing.T) {
+	policies := []userPolicy{
+		{Source: "policy assume-admin", Document: `{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRole", "Resource": "arn:aws:iam::210987654321:role/admin"}}`},
+		{Source: "inline policy dev", Document: `{"Version": "2012-10-17", "Statement": [
+			{"Effect": "Allow", "Action": ["sts:*"], "Resource": ["arn:aws:iam::210987654321:role/admin", "arn:aws:iam::111111111111:role/ops/*"]},
+			{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:iam::210987654321:role/not-assumable"},
+			{"Effect": "Deny", "Action": "sts:AssumeRole", "Resource": "arn:aws:iam::210987654321:role/denied"},
+			{"Effect": "Allow", "Action": "sts:AssumeRole", "Resource": ["arn:aws:s3:::bucket", "arn:aws:iam::210987654321:role/Audit"]}
+		]}`},
+		{Source: "group admins: policy AdministratorAccess", Document: `{"Statement": [{"Effect": "Allow", "Action": "*", "Resource": "*"}]}`},
+	}
+
+	got, err := assumableRoles(policies)
+	if err != nil {
+		t.Fatalf("assumableRoles: %v", err)
+	}
+	want := []DiscoveredRole{
+		{RoleARN: "arn:aws:iam::210987654321:role/Audit", GrantedBy: []string{"inline policy dev"}},
+		{RoleARN: "arn:aws:iam::210987654321:role/admin", GrantedBy: []string{"policy assume-admin", "inline policy dev"}},
+		{RoleARN: "*", Wildcard: true, GrantedBy: []string{"group admins: policy AdministratorAccess"}},
+		{RoleARN: "arn:aws:iam::111111111111:role/ops/*", Wildcard: true, GrantedBy: []string{"inline policy dev"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected roles:\n got %+v\nwant %+v", got, want)
+	}
+
+	if _, err := assumableRoles([]userPolicy{{Source: "inline policy broken", Document: "{"}}); err == nil || !strings.Contains(err.Error(), "inline policy broken") {
+		t.Fatalf("expected an invalid document error, got %v", err)
+	}
+}
+
+func TestNameRoleProfiles_AddsAccountForDuplicateNames(t *testing.T) {
+	roles := []DiscoveredRole{
+		{RoleARN: "arn:aws:iam::111111111111:role/path/admin"},
+		{RoleARN: "arn:aws:iam::222222222222:role/admin"},
+		{RoleARN: "arn:aws:iam::222222222222:role/readonly"},
+		{RoleARN: "*", Wildcard: true},
+	}
+	nameRoleProfiles("prod", roles)
+	var got []string
+	for _, r := range roles {
+		got = append(got, r.Profile)
+	}
+	want := []string{"prod-111111111111-admin", "prod-222222222222-admin", "prod-readonly", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected profiles %q, got %q", want, got)
+	}
+}
+
+// rolesTestIAM grants two roles through a user and a group policy, and a
+// wildcard through a group inline policy.
+func rolesTestIAM() *fakeIAM {
+	return &fakeIAM{
+		user:     awsiam.User{UserName: "alice", ARN: "arn:aws:iam::123456789012:user/alice"},
+		policies: []awsiam.AttachedPolicy{{PolicyName: "assume-admin", PolicyARN: "arn:aws:iam::123456789012:policy/assume-admin"}},
+		groups:   []string{"developers"},
+		attached: map[string][]awsiam.AttachedPolicy{
+			"developers": {{PolicyName: "assume-admin", PolicyARN: "arn:aws:iam::123456789012:policy/assume-admin"}},
+		},
+		inline: map[string]map[string]string{
+			"developers": {"readonly": `{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRole", "Resource": ["arn:aws:iam::210987654321:role/readonly", "arn:aws:iam::*:role/audit"]}}`},
+		},
+		documents: map[string]string{
+			"arn:aws:iam::123456789012:policy/assume-admin": `{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRole", "Resource": "arn:aws:iam::210987654321:role/admin"}}`,
+		},
+	}
+}
+
+func TestRolesDiscover_GeneratesConfigProfiles(t *testing.T) {
+	iam := rolesTestIAM()
+	mfaIn, deps, stdout, _ := mfaTestSetup(t, iam, "", "c\n")
+	configPath := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(configPath, []byte("[profile prod-readonly]\nregion = eu-west-1\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	deps.Env = mapEnv{"AWS_CONFIG_FILE": configPath}
+
+	if err := RolesDiscover(context.Background(), RolesDiscoverInputs{Inputs: mfaIn.Inputs}, deps); err != nil {
+		t.Fatalf("RolesDiscover: %v", err)
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		"alice may assume 3 roles",
+		"arn:aws:iam::210987654321:role/admin     prod-admin     policy assume-admin; group developers: policy assume-admin",
+		"arn:aws:iam::*:role/audit                ⚠️ wildcard",
+		"complete them by hand",
+		"[profile prod-readonly] already exists",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	config, err := credentials.Load(configPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if v, _ := config.Get("profile prod-admin", "role_arn"); v != "arn:aws:iam::210987654321:role/admin" {
+		t.Fatalf("expected role_arn of prod-admin, got %q", v)
+	}
+	if v, _ := config.Get("profile prod-admin", "source_profile"); v != "prod" {
+		t.Fatalf("expected the short-term section as source_profile, got %q", v)
+	}
+	if _, ok := config.Get("profile prod-readonly", "role_arn"); ok {
+		t.Fatal("expected the existing profile to be left alone")
+	}
+}
+
+func TestRolesDiscover_GeneratesToolProfilesUsingSourceKeys(t *testing.T) {
+	iam := rolesTestIAM()
+	mfaIn, deps, stdout, credsPath := mfaTestSetup(t, iam, "arn:aws:iam::123456789012:mfa/phone", "")
+
+	if err := RolesDiscover(context.Background(), RolesDiscoverInputs{Inputs: mfaIn.Inputs, Target: RoleTargetTool, JSON: true}, deps); err != nil {
+		t.Fatalf("RolesDiscover: %v", err)
+	}
+	if !strings.Contains(stdout.String(), `"profile": "prod-readonly"`) || !strings.Contains(stdout.String(), "aws-mfa-go --profile prod-admin") {
+		t.Fatalf("expected JSON roles and added profiles, got:\n%s", stdout.String())
+	}
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if v, _ := store.Get("prod-admin-long-term", "source_profile"); v != "prod" {
+		t.Fatalf("expected source_profile prod, got %q", v)
+	}
+
+	// The generated profile assumes its role with the keys, device and MFA
+	// session of the source profile.
+	in := mfaIn.Inputs
+	in.Profile = "prod-admin"
+	got, err := Resolve(context.Background(), in, mapEnv{}, store)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got.RoleARN != "arn:aws:iam::210987654321:role/admin" || got.KeysSection != "prod-long-term" ||
+		got.SessionSection != "prod-mfa-session" || got.Device != "arn:aws:iam::123456789012:mfa/phone" {
+		t.Fatalf("expected the source's keys, device and session, got %+v", got)
+	}
+
+	// Profiles with a source_profile are left out of other commands that
+	// need keys of their own.
+	if err := RolesDiscover(context.Background(), RolesDiscoverInputs{Inputs: in}, deps); ExitCode(err) != ExitConfig {
+		t.Fatalf("expected a config error for a role profile, got %v", err)
+	}
+	profiles, err := auditedProfiles(Inputs{LongTermSuffix: "long-term", CredentialsFile: credsPath})
+	if err != nil || !reflect.DeepEqual(profiles, []string{"prod"}) {
+		t.Fatalf("expected only prod to be audited, got %q, %v", profiles, err)
+	}
+}
+
+func TestRolesDiscover_GeneratesBothProfiles(t *testing.T) {
+	iam := rolesTestIAM()
+	mfaIn, deps, _, credsPath := mfaTestSetup(t, iam, "", "b\n")
+	configPath := filepath.Join(t.TempDir(), "config")
+	deps.Env = mapEnv{"AWS_CONFIG_FILE": configPath}
+
+	if err := RolesDiscover(context.Background(), RolesDiscoverInputs{Inputs: mfaIn.Inputs}, deps); err != nil {
+		t.Fatalf("RolesDiscover: %v", err)
+	}
+	config, err := credentials.Load(configPath)
+	if err != nil {
+		t.Fatalf("Load config: %v", err)
+	}
+	if v, _ := config.Get("profile prod-admin", "role_arn"); v != "arn:aws:iam::210987654321:role/admin" {
+		t.Fatalf("expected role_arn of prod-admin in the config file, got %q", v)
+	}
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load credentials: %v", err)
+	}
+	if v, _ := store.Get("prod-admin-long-term", "assume_role"); v != "arn:aws:iam::210987654321:role/admin" {
+		t.Fatalf("expected assume_role of prod-admin in the credentials file, got %q", v)
+	}
+}
+
+func TestRolesDiscover_AppendsConfigProfilesWithoutRewritingTheFile(t *testing.T) {
+	iam := rolesTestIAM()
+	mfaIn, deps, _, _ := mfaTestSetup(t, iam, "", "")
+	configPath := filepath.Join(t.TempDir(), "config")
+	// Nested settings do not survive a round-trip through the ini store.
+	original := "[default]\nregion = eu-west-1\ns3 =\n    max_concurrent_requests = 20\n    multipart_threshold = 64MB\n\n[profile prod-readonly]\nregion = eu-west-1"
+	if err := os.WriteFile(configPath, []byte(original), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	deps.Env = mapEnv{"AWS_CONFIG_FILE": configPath}
+
+	if err := RolesDiscover(context.Background(), RolesDiscoverInputs{Inputs: mfaIn.Inputs, Target: RoleTargetConfig}, deps); err != nil {
+		t.Fatalf("RolesDiscover: %v", err)
+	}
+	got, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	want := original + "\n\n[profile prod-admin]\nrole_arn = arn:aws:iam::210987654321:role/admin\nsource_profile = prod\n"
+	if string(got) != want {
+		t.Fatalf("expected the profiles to be appended to the unchanged file, got:\n%s", got)
+	}
+}
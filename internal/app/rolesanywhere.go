@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/rolesanywhere"
+)
+
+// RolesAnywhereSettings configure roles-anywhere mode.
+type RolesAnywhereSettings struct {
+	// Certificate is a PEM file, optionally followed by its chain.
+	Certificate string
+	// PrivateKey is a PEM file or a PKCS#11 URI.
+	PrivateKey     string
+	TrustAnchorARN string
+	ProfileARN     string
+
+	// Region is the region of the trust anchor.
+	Region string
+	// EndpointURL overrides the Roles Anywhere endpoint.
+	EndpointURL string
+
+	PKCS11Module string
+	PKCS11PIN    string
+}
+
+// newRolesAnywhereSession exchanges the certificate for role credentials
+// with a Roles Anywhere CreateSession request signed by its private key.
+func newRolesAnywhereSession(ctx context.Context, deps Deps, opts awssts.Options, resolved Resolved) (issuedCredentials, error) {
+	s := resolved.RolesAnywhere
+	cert, chain, err := rolesanywhere.LoadCertificate(ExpandHome(s.Certificate))
+	if err != nil {
+		return issuedCredentials{}, configError(err)
+	}
+	key := s.PrivateKey
+	if !strings.HasPrefix(key, "pkcs11:") {
+		key = ExpandHome(key)
+	}
+	signer, err := rolesanywhere.LoadSigner(key, cert, rolesanywhere.KeyOptions{PKCS11Module: s.PKCS11Module, PIN: s.PKCS11PIN})
+	if err != nil {
+		return issuedCredentials{}, configError(err)
+	}
+	defer func() { _ = signer.Close() }()
+
+	httpClient, err := awssts.NewHTTPClient(opts)
+	if err != nil {
+		return issuedCredentials{}, configError(err)
+	}
+	if opts.Timeout > 0 {
+		httpClient = httpClient.WithTimeout(opts.Timeout)
+	}
+	client := rolesanywhere.Client{HTTP: httpClient, Endpoint: s.EndpointURL, Region: s.Region, Now: deps.Now}
+	out, err := client.CreateSession(ctx, rolesanywhere.CreateSessionInput{
+		TrustAnchorARN:  s.TrustAnchorARN,
+		ProfileARN:      s.ProfileARN,
+		RoleARN:         resolved.RoleARN,
+		DurationSeconds: resolved.DurationSeconds,
+	}, cert, chain, signer)
+	if err != nil {
+		return issuedCredentials{}, err
+	}
+	return issuedCredentials{
+		AccessKeyID:     out.AccessKeyID,
+		SecretAccessKey: out.SecretAccessKey,
+		SessionToken:    out.SessionToken,
+		Expiration:      out.Expiration,
+	}, nil
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+func TestRun_RolesAnywhereMode(t *testing.T) {
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(7), Subject: pkix.Name{CommonName: "lab-01"}, NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+	certPath := filepath.Join(dir, "lab.pem")
+	keyPath := filepath.Join(dir, "lab.key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	var got map[string]any
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"credentialSet":[{"credentials":{"accessKeyId":"ASIA_RA","secretAccessKey":"S","sessionToken":"T","expiration":"2026-02-09T12:00:00Z"}}]}`))
+	}))
+	defer srv.Close()
+
+	credsPath := filepath.Join(dir, "credentials")
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("lab-long-term", "certificate", certPath)
+	store.Set("lab-long-term", "private_key", keyPath)
+	store.Set("lab-long-term", "trust_anchor_arn", "arn:aws:rolesanywhere:eu-west-1:123456789012:trust-anchor/ta")
+	store.Set("lab-long-term", "profile_arn", "arn:aws:rolesanywhere:eu-west-1:123456789012:profile/p")
+	store.Set("lab-long-term", "role_arn", "arn:aws:iam::123456789012:role/lab")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "eu-west-1", "AWS_ENDPOINT_URL_ROLESANYWHERE": srv.URL}
+	deps.Now = func() time.Time { return time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC) }
+	deps.Stdout = ioDiscard{}
+	fake := &fakeSTS{}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+
+	err = Run(context.Background(), RunInputs{Inputs: Inputs{
+		Profile:         "lab",
+		ProfileChanged:  true,
+		LongTermSuffix:  "long-term",
+		ShortTermSuffix: "none",
+		CredentialsFile: credsPath,
+	}}, deps)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.HasPrefix(auth, "AWS4-X509-ECDSA-SHA256 Credential=7/20260209/eu-west-1/rolesanywhere/aws4_request") {
+		t.Fatalf("unexpected Authorization %q", auth)
+	}
+	if got["roleArn"] != "arn:aws:iam::123456789012:role/lab" || got["durationSeconds"] != float64(3600) {
+		t.Fatalf("unexpected CreateSession body: %v", got)
+	}
+	if fake.calls != 0 {
+		t.Fatalf("expected no STS credential calls, got %d", fake.calls)
+	}
+
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	for k, want := range map[string]string{
+		"aws_access_key_id": "ASIA_RA",
+		"mode":              ModeRolesAnywhere,
+		"assumed_role_arn":  "arn:aws:iam::123456789012:role/lab",
+		"trust_anchor_arn":  "arn:aws:rolesanywhere:eu-west-1:123456789012:trust-anchor/ta",
+	} {
+		if v, _ := updated.Get("lab", k); v != want {
+			t.Fatalf("expected %s=%q, got %q", k, want, v)
+		}
+	}
+}
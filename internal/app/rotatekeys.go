@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+)
+
+type RotateKeysInputs struct {
+	// Only the profile, suffix and credentials file fields are used.
+	Inputs
+	// Region is optional; if empty, we will fall back to env, the region key
+	// in the long-term section, then the default region of the partition.
+	Region string
+}
+
+// New access keys take a few seconds to work everywhere, so the check of the
+// new key is retried while it is rejected as invalid.
+const (
+	newKeyAttempts = 10
+	newKeyDelay    = 3 * time.Second
+)
+
+// RotateKeys replaces the long-term access key of a profile: it creates a new
+// key, checks that it works, saves it in the long-term section, and only then
+// deactivates and deletes the old key. Until the old key is deactivated,
+// any failure rolls back to the old key, deleting the new one.
+func RotateKeys(ctx context.Context, in RotateKeysInputs, deps Deps) error {
+	if deps.Env == nil || deps.STSFactory == nil || deps.IAMFactory == nil {
+		return errors.New("missing required dependencies")
+	}
+	if deps.Stdout == nil {
+		deps.Stdout = io.Discard
+	}
+	if deps.Stderr == nil {
+		deps.Stderr = io.Discard
+	}
+
+	c, err := newLongTermClient(ctx, in.Inputs, in.Region, deps)
+	if err != nil {
+		return err
+	}
+	oldKey := c.Credentials
+	if oldKey.SessionToken != "" {
+		return configError(fmt.Errorf("section [%s] holds temporary credentials, not long-term keys", c.Names.LongTerm))
+	}
+
+	keys, err := c.IAM.ListAccessKeys(ctx)
+	if err != nil {
+		return err
+	}
+	if len(keys) >= 2 {
+		var other []string
+		for _, k := range keys {
+			if k.AccessKeyID != oldKey.AccessKeyID {
+				other = append(other, fmt.Sprintf("%s (%s)", k.AccessKeyID, strings.ToLower(k.Status)))
+			}
+		}
+		return configError(fmt.Errorf("the IAM user already has %d access keys, the most allowed: delete %s first", len(keys), strings.Join(other, ", ")))
+	}
+
+	created, err := c.IAM.CreateAccessKey(ctx)
+	if err != nil {
+		return err
+	}
+	newKey := awssts.Credentials{AccessKeyID: created.AccessKeyID, SecretAccessKey: created.SecretAccessKey}
+	_, _ = fmt.Fprintf(deps.Stdout, "🔑 Created access key %s.\n", newKey.AccessKeyID)
+
+	saved := false
+	rollback := func(cause error) error {
+		// Not ctx, so Ctrl-C still rolls back; the client's timeout applies.
+		if saved {
+			c.Store.Set(c.Names.LongTerm, "aws_access_key_id", oldKey.AccessKeyID)
+			c.Store.Set(c.Names.LongTerm, "aws_secret_access_key", oldKey.SecretAccessKey)
+			if err := c.Store.SaveAtomic(); err != nil {
+				_, _ = fmt.Fprintf(deps.Stderr, "⚠️ Could not restore the old key in [%s]: %v\n", c.Names.LongTerm, err)
+				_, _ = fmt.Fprintf(deps.Stderr, "⚠️ The new key %s is kept, since it is the one saved.\n", newKey.AccessKeyID)
+				return cause
+			}
+		}
+		if err := c.IAM.DeleteAccessKey(context.Background(), newKey.AccessKeyID); err != nil {
+			_, _ = fmt.Fprintf(deps.Stderr, "⚠️ Could not delete the new key %s: %v\n", newKey.AccessKeyID, err)
+			return cause
+		}
+		_, _ = fmt.Fprintf(deps.Stdout, "↩️ Rolled back: deleted the new key %s, the old key %s is unchanged.\n", newKey.AccessKeyID, oldKey.AccessKeyID)
+		return cause
+	}
+
+	id, err := checkNewKey(ctx, deps, stsOptions(c.Region, c.Endpoint, c.HTTP, in.Timeout), newKey)
+	if err != nil {
+		return rollback(fmt.Errorf("check new access key: %w", err))
+	}
+	_, _ = fmt.Fprintf(deps.Stdout, "✅ The new key works (%s).\n", id.ARN)
+
+	c.Store.Set(c.Names.LongTerm, "aws_access_key_id", newKey.AccessKeyID)
+	c.Store.Set(c.Names.LongTerm, "aws_secret_access_key", newKey.SecretAccessKey)
+	if err := c.Store.SaveAtomic(); err != nil {
+		return rollback(err)
+	}
+	saved = true
+	_, _ = fmt.Fprintf(deps.Stdout, "💾 Saved the new key in [%s].\n", c.Names.LongTerm)
+
+	// The old key is deactivated with its own client, since IAM may not
+	// accept the new key yet; once inactive, it can only be deleted with the
+	// new key.
+	newIAM, err := deps.IAMFactory(ctx, iamOptions(c.Region, c.Endpoint, c.HTTP, in.Timeout), newKey)
+	if err != nil {
+		return rollback(err)
+	}
+	if err := c.IAM.UpdateAccessKey(ctx, oldKey.AccessKeyID, awsiam.StatusInactive); err != nil {
+		return rollback(fmt.Errorf("deactivate old access key: %w", err))
+	}
+	_, _ = fmt.Fprintf(deps.Stdout, "🚫 Deactivated the old key %s.\n", oldKey.AccessKeyID)
+
+	// From here on the new key is the only working one, so there is nothing
+	// to roll back to; an old key that is left over is only reported.
+	err = retryNewKey(ctx, deps, func() error {
+		return newIAM.DeleteAccessKey(ctx, oldKey.AccessKeyID)
+	})
+	if err != nil {
+		_, _ = fmt.Fprintf(deps.Stderr, "⚠️ Could not delete the deactivated old key %s, delete it later: %v\n", oldKey.AccessKeyID, err)
+		return nil
+	}
+	_, _ = fmt.Fprintf(deps.Stdout, "🗑️ Deleted the old key %s.\n", oldKey.AccessKeyID)
+	return nil
+}
+
+// checkNewKey calls GetCallerIdentity with a new access key until it is no
+// longer rejected as invalid, or newKeyAttempts run out.
+func checkNewKey(ctx context.Context, deps Deps, opts awssts.Options, key awssts.Credentials) (awssts.CallerIdentity, error) {
+	client, err := deps.STSFactory(ctx, opts, key)
+	if err != nil {
+		return awssts.CallerIdentity{}, err
+	}
+	var id awssts.CallerIdentity
+	err = retryNewKey(ctx, deps, func() error {
+		var err error
+		id, err = client.GetCallerIdentity(ctx)
+		return err
+	})
+	return id, err
+}
+
+// retryNewKey calls fn, which uses a new access key, until the key is no
+// longer rejected as invalid, or newKeyAttempts run out.
+func retryNewKey(ctx context.Context, deps Deps, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		var stsErr *awssts.Error
+		if err == nil || attempt == newKeyAttempts || !errors.As(err, &stsErr) || stsErr.Kind != awssts.KindInvalidCredentials {
+			return err
+		}
+		if err := sleepContext(ctx, deps, newKeyDelay); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for d with deps.Sleep, or a timer that stops when ctx
+// is done.
+func sleepContext(ctx context.Context, deps Deps, d time.Duration) error {
+	if deps.Sleep != nil {
+		return deps.Sleep(ctx, d)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,193 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+// rotateTestSetup writes a long-term section with the old key and returns
+// inputs and deps using sts and iam. gotIAMKeys records the key of each IAM
+// client created.
+func rotateTestSetup(t *testing.T, sts *fakeSTS, iam *fakeIAM) (RotateKeysInputs, Deps, string, *[]string) {
+	t.Helper()
+	credsPath := filepath.Join(t.TempDir(), "credentials")
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("prod-long-term", "aws_access_key_id", "AKIA_OLD")
+	store.Set("prod-long-term", "aws_secret_access_key", "SECRET_OLD")
+	store.Set("prod-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/alice")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	var gotIAMKeys []string
+	var out bytes.Buffer
+	deps := DefaultDeps()
+	deps.Env = mapEnv{}
+	deps.Stdout = &out
+	deps.Stderr = &out
+	deps.Sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		if creds.AccessKeyID != "AKIA_NEW" {
+			t.Errorf("expected the new key to be checked, got %+v", creds)
+		}
+		return sts, nil
+	}
+	deps.IAMFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awsiam.Client, error) {
+		gotIAMKeys = append(gotIAMKeys, creds.AccessKeyID)
+		return iam, nil
+	}
+	in := RotateKeysInputs{Inputs: Inputs{
+		Profile:         "prod",
+		ProfileChanged:  true,
+		LongTermSuffix:  "long-term",
+		ShortTermSuffix: "none",
+		CredentialsFile: credsPath,
+	}}
+	return in, deps, credsPath, &gotIAMKeys
+}
+
+func loadKey(t *testing.T, credsPath string) string {
+	t.Helper()
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	id, _ := store.Get("prod-long-term", "aws_access_key_id")
+	secret, _ := store.Get("prod-long-term", "aws_secret_access_key")
+	return id + "/" + secret
+}
+
+func TestRotateKeys_ReplacesOldKeyOnceNewOneWorks(t *testing.T) {
+	sts := &fakeSTS{
+		identity:     awssts.CallerIdentity{ARN: "arn:aws:iam::123456789012:user/alice"},
+		identityErrs: []error{&awssts.Error{Op: "get-caller-identity", Kind: awssts.KindInvalidCredentials, Err: errors.New("InvalidClientTokenId")}},
+	}
+	iam := &fakeIAM{
+		keys:   []awsiam.AccessKey{{AccessKeyID: "AKIA_OLD", Status: awsiam.StatusActive}},
+		newKey: awsiam.NewAccessKey{AccessKeyID: "AKIA_NEW", SecretAccessKey: "SECRET_NEW"},
+	}
+	in, deps, credsPath, gotIAMKeys := rotateTestSetup(t, sts, iam)
+
+	if err := RotateKeys(context.Background(), in, deps); err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+	if sts.identityCalls != 2 {
+		t.Fatalf("expected the check to be retried once, got %d calls", sts.identityCalls)
+	}
+	if got := loadKey(t, credsPath); got != "AKIA_NEW/SECRET_NEW" {
+		t.Fatalf("expected the new key to be saved, got %s", got)
+	}
+	if len(*gotIAMKeys) != 2 || (*gotIAMKeys)[1] != "AKIA_NEW" {
+		t.Fatalf("expected the old key to be deleted with the new key, got IAM clients for %v", *gotIAMKeys)
+	}
+	if len(iam.gotUpdate) != 1 || iam.gotUpdate[0] != "AKIA_OLD Inactive" {
+		t.Fatalf("unexpected UpdateAccessKey calls: %v", iam.gotUpdate)
+	}
+	if len(iam.gotDeleteKey) != 1 || iam.gotDeleteKey[0] != "AKIA_OLD" {
+		t.Fatalf("unexpected DeleteAccessKey calls: %v", iam.gotDeleteKey)
+	}
+}
+
+func TestRotateKeys_RollsBackWhenOldKeyCannotBeDeactivated(t *testing.T) {
+	sts := &fakeSTS{identity: awssts.CallerIdentity{ARN: "arn:aws:iam::123456789012:user/alice"}}
+	iam := &fakeIAM{
+		keys:      []awsiam.AccessKey{{AccessKeyID: "AKIA_OLD", Status: awsiam.StatusActive}},
+		newKey:    awsiam.NewAccessKey{AccessKeyID: "AKIA_NEW", SecretAccessKey: "SECRET_NEW"},
+		updateErr: &awssts.Error{Service: "iam", Op: "update-access-key", Kind: awssts.KindAccessDenied, Err: errors.New("AccessDenied")},
+	}
+	in, deps, credsPath, _ := rotateTestSetup(t, sts, iam)
+
+	err := RotateKeys(context.Background(), in, deps)
+	if ExitCode(err) != ExitAccessDenied {
+		t.Fatalf("expected an access denied error, got %v", err)
+	}
+	if got := loadKey(t, credsPath); got != "AKIA_OLD/SECRET_OLD" {
+		t.Fatalf("expected the old key to be restored, got %s", got)
+	}
+	if len(iam.gotDeleteKey) != 1 || iam.gotDeleteKey[0] != "AKIA_NEW" {
+		t.Fatalf("expected the new key to be deleted, got %v", iam.gotDeleteKey)
+	}
+}
+
+func TestRotateKeys_RollsBackWhenNewKeyDoesNotWork(t *testing.T) {
+	invalid := &awssts.Error{Op: "get-caller-identity", Kind: awssts.KindInvalidCredentials, Err: errors.New("InvalidClientTokenId")}
+	sts := &fakeSTS{}
+	for i := 0; i < newKeyAttempts; i++ {
+		sts.identityErrs = append(sts.identityErrs, invalid)
+	}
+	iam := &fakeIAM{
+		keys:   []awsiam.AccessKey{{AccessKeyID: "AKIA_OLD", Status: awsiam.StatusActive}},
+		newKey: awsiam.NewAccessKey{AccessKeyID: "AKIA_NEW", SecretAccessKey: "SECRET_NEW"},
+	}
+	in, deps, credsPath, _ := rotateTestSetup(t, sts, iam)
+
+	err := RotateKeys(context.Background(), in, deps)
+	if ExitCode(err) != ExitInvalidCredentials {
+		t.Fatalf("expected an invalid credentials error, got %v", err)
+	}
+	if sts.identityCalls != newKeyAttempts {
+		t.Fatalf("expected %d checks, got %d", newKeyAttempts, sts.identityCalls)
+	}
+	if got := loadKey(t, credsPath); got != "AKIA_OLD/SECRET_OLD" {
+		t.Fatalf("expected the old key to be kept, got %s", got)
+	}
+	if len(iam.gotDeleteKey) != 1 || iam.gotDeleteKey[0] != "AKIA_NEW" || len(iam.gotUpdate) != 0 {
+		t.Fatalf("expected only the new key to be deleted, got deletes %v, updates %v", iam.gotDeleteKey, iam.gotUpdate)
+	}
+}
+
+func TestRotateKeys_RefusesWithTwoKeys(t *testing.T) {
+	iam := &fakeIAM{keys: []awsiam.AccessKey{
+		{AccessKeyID: "AKIA_OLD", Status: awsiam.StatusActive},
+		{AccessKeyID: "AKIA_SPARE", Status: awsiam.StatusInactive},
+	}}
+	in, deps, _, _ := rotateTestSetup(t, &fakeSTS{}, iam)
+
+	err := RotateKeys(context.Background(), in, deps)
+	if ExitCode(err) != ExitConfig || iam.calls != 0 {
+		t.Fatalf("expected a config error without IAM changes, got %v (%d calls)", err, iam.calls)
+	}
+}
+
+func TestRotateKeys_DeactivatesWithOldKeyAndDeletesWithNewKey(t *testing.T) {
+	sts := &fakeSTS{identity: awssts.CallerIdentity{ARN: "arn:aws:iam::123456789012:user/alice"}}
+	oldIAM := &fakeIAM{
+		keys:   []awsiam.AccessKey{{AccessKeyID: "AKIA_OLD", Status: awsiam.StatusActive}},
+		newKey: awsiam.NewAccessKey{AccessKeyID: "AKIA_NEW", SecretAccessKey: "SECRET_NEW"},
+	}
+	// IAM does not accept the new key at first.
+	newIAM := &fakeIAM{deleteKeyErrs: []error{
+		&awssts.Error{Service: "iam", Op: "delete-access-key", Kind: awssts.KindInvalidCredentials, Err: errors.New("InvalidClientTokenId")},
+	}}
+	in, deps, credsPath, _ := rotateTestSetup(t, sts, oldIAM)
+	deps.IAMFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awsiam.Client, error) {
+		if creds.AccessKeyID == "AKIA_NEW" {
+			return newIAM, nil
+		}
+		return oldIAM, nil
+	}
+
+	if err := RotateKeys(context.Background(), in, deps); err != nil {
+		t.Fatalf("RotateKeys: %v", err)
+	}
+	if got := loadKey(t, credsPath); got != "AKIA_NEW/SECRET_NEW" {
+		t.Fatalf("expected the new key to be saved, got %s", got)
+	}
+	if len(oldIAM.gotUpdate) != 1 || oldIAM.gotUpdate[0] != "AKIA_OLD Inactive" || len(newIAM.gotUpdate) != 0 {
+		t.Fatalf("expected the old key to deactivate itself, got updates %v with the old key, %v with the new key", oldIAM.gotUpdate, newIAM.gotUpdate)
+	}
+	if len(newIAM.gotDeleteKey) != 2 || newIAM.gotDeleteKey[1] != "AKIA_OLD" || len(oldIAM.gotDeleteKey) != 0 {
+		t.Fatalf("expected the new key to delete the old one after a retry, got deletes %v with the new key, %v with the old key", newIAM.gotDeleteKey, oldIAM.gotDeleteKey)
+	}
+}
@@ -1,7 +1,6 @@
 package app
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"fmt"
@@ -10,16 +9,32 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jlis/aws-mfa-go/internal/awsiam"
 	"github.com/jlis/aws-mfa-go/internal/awssts"
 	"github.com/jlis/aws-mfa-go/internal/credentials"
 )
 
-type STSFactory func(ctx context.Context, region, accessKeyID, secretAccessKey string) (awssts.Client, error)
+type STSFactory func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error)
+
+type IAMFactory func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awsiam.Client, error)
 
 type Deps struct {
 	Now        func() time.Time
 	Env        Env
 	STSFactory STSFactory
+	// IAMFactory creates IAM clients (MFA device discovery).
+	IAMFactory IAMFactory
+	// GitEmail returns the git user.email, used by the {{git_email}} template.
+	GitEmail func(ctx context.Context) (string, error)
+	// OpenBrowser opens a URL in the default browser (console command, OIDC login).
+	OpenBrowser func(url string) error
+	// Sleep waits between OIDC token polls; nil uses a real timer.
+	Sleep func(ctx context.Context, d time.Duration) error
+	// Helper runs a helper command and returns its output (saml_helper).
+	Helper func(ctx context.Context, command string) (string, error)
+	// StoreSeed passes a virtual MFA device's seed to a command that stores
+	// it (mfa enroll --seed-command).
+	StoreSeed func(ctx context.Context, command, seed string) error
 
 	Stdout io.Writer
 	Stderr io.Writer
@@ -30,9 +45,16 @@ func DefaultDeps() Deps {
 	return Deps{
 		Now: func() time.Time { return time.Now().UTC() },
 		Env: OSEnv{},
-		STSFactory: func(ctx context.Context, region, accessKeyID, secretAccessKey string) (awssts.Client, error) {
-			return awssts.NewRealClient(ctx, region, accessKeyID, secretAccessKey)
+		STSFactory: func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+			return awssts.NewRealClient(ctx, opts, creds)
+		},
+		IAMFactory: func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awsiam.Client, error) {
+			return awsiam.NewRealClient(ctx, opts, creds)
 		},
+		GitEmail:    gitEmail,
+		OpenBrowser: openBrowser,
+		Helper:      runHelper,
+		StoreSeed:   storeSeed,
 	}
 }
 
@@ -40,7 +62,9 @@ var token6Digits = regexp.MustCompile(`^\d{6}$`)
 
 type RunInputs struct {
 	Inputs
-	// Region is optional; if empty, we will fall back to env/default.
+	// Region is optional; if empty, we will fall back to env, the region key
+	// in the long-term section, then the default region of the MFA device's
+	// partition.
 	Region string
 }
 
@@ -65,27 +89,35 @@ func Run(ctx context.Context, in RunInputs, deps Deps) error {
 	credsPath := ExpandHome(in.CredentialsFile)
 	store, err := credentials.Load(credsPath)
 	if err != nil {
-		return err
+		return configError(err)
 	}
 
 	resolved, err := Resolve(ctx, in.Inputs, deps.Env, store)
 	if err != nil {
-		return err
+		return configError(err)
+	}
+	if err := expandTemplates(ctx, &resolved, deps); err != nil {
+		return configError(err)
 	}
 
 	_, _ = fmt.Fprintf(deps.Stdout, "👤 Using profile: %s\n", resolved.ShortTermSection)
-
-	ltKeyID, err := store.MustGet(resolved.LongTermSection, "aws_access_key_id")
-	if err != nil {
-		return fmt.Errorf("long-term section [%s] missing aws_access_key_id", resolved.LongTermSection)
+	for _, note := range resolved.DurationNotes {
+		_, _ = fmt.Fprintf(deps.Stdout, "⏱️ %s.\n", note)
 	}
-	ltSecret, err := store.MustGet(resolved.LongTermSection, "aws_secret_access_key")
-	if err != nil {
-		return fmt.Errorf("long-term section [%s] missing aws_secret_access_key", resolved.LongTermSection)
+
+	var longTerm awssts.Credentials
+	if usesLongTermKeys(resolved.Mode) {
+		if longTerm.AccessKeyID, err = store.MustGet(resolved.KeysSection, "aws_access_key_id"); err != nil {
+			return configError(fmt.Errorf("long-term section [%s] missing aws_access_key_id", resolved.KeysSection))
+		}
+		if longTerm.SecretAccessKey, err = store.MustGet(resolved.KeysSection, "aws_secret_access_key"); err != nil {
+			return configError(fmt.Errorf("long-term section [%s] missing aws_secret_access_key", resolved.KeysSection))
+		}
 	}
 
 	now := deps.Now().UTC()
-	dec := DecideRefresh(now, store, resolved.ShortTermSection, resolved.Force)
+	target := refreshTarget(resolved)
+	dec := DecideRefresh(now, store, target, resolved.Force)
 	if !dec.ShouldRefresh {
 		// Match upstream-ish wording.
 		if dec.Remaining != nil && dec.ExpiresAt != nil {
@@ -105,78 +137,358 @@ func Run(ctx context.Context, in RunInputs, deps Deps) error {
 		_, _ = fmt.Fprintln(deps.Stdout, "♻️ Your credentials have expired, renewing.")
 	case "short-term section missing":
 		_, _ = fmt.Fprintf(deps.Stdout, "➕ Short-term credentials section [%s] is missing, obtaining new credentials.\n", resolved.ShortTermSection)
+	case "mode changed":
+		_, _ = fmt.Fprintln(deps.Stdout, "🔀 Mode changed, obtaining new credentials.")
+	case "role changed":
+		_, _ = fmt.Fprintln(deps.Stdout, "🔀 Target role changed, obtaining new credentials.")
+	case "settings changed":
+		_, _ = fmt.Fprintln(deps.Stdout, "🔀 Session settings changed, obtaining new credentials.")
+	case "parent changed":
+		_, _ = fmt.Fprintln(deps.Stdout, "🔀 Credentials were derived from another section, obtaining new credentials.")
 	default:
 		_, _ = fmt.Fprintln(deps.Stdout, "⏳ Obtaining new credentials.")
 	}
 
-	token := strings.TrimSpace(resolved.Token)
-	if token == "" {
-		token, err = promptToken(deps.Stdout, deps.Stdin, resolved.Device, resolved.DurationSeconds)
+	// The MFA device is only looked up when an MFA code will be asked for, so
+	// runs that reuse a cached session make no IAM calls.
+	if resolved.Device == "" && needsMFASession(resolved.Mode, dec) {
+		region, err := resolveRegion(in.Region, deps.Env, store, resolved.LongTermSection, partitionFromARN(resolved.RoleARN))
 		if err != nil {
+			return configError(err)
+		}
+		iamOpts := iamOptions(region, resolved.Endpoint, resolved.HTTP, in.Timeout)
+		if resolved.Device, err = discoverMFADevice(ctx, deps, store, iamOpts, longTerm, resolved.KeysSection); err != nil {
 			return err
 		}
 	}
-	if !token6Digits.MatchString(token) {
-		return errors.New("token must be six digits")
+
+	partition := partitionFromARN(resolved.Device)
+	if partition == "" {
+		partition = partitionFromARN(resolved.RoleARN)
+	}
+	region, err := resolveRegion(in.Region, deps.Env, store, resolved.LongTermSection, partition)
+	if err != nil {
+		return configError(err)
 	}
+	opts := stsOptions(region, resolved.Endpoint, resolved.HTTP, in.Timeout)
 
-	region := strings.TrimSpace(in.Region)
-	if region == "" {
-		region = strings.TrimSpace(deps.Env.Get("AWS_REGION"))
+	iamOpts := iamOptions(region, resolved.Endpoint, resolved.HTTP, in.Timeout)
+	if err := limitRoleDuration(ctx, deps, iamOpts, longTerm, &resolved); err != nil {
+		return err
 	}
-	if region == "" {
-		region = strings.TrimSpace(deps.Env.Get("AWS_DEFAULT_REGION"))
+
+	var issued issuedCredentials
+	switch resolved.Mode {
+	case ModeRole:
+		issued, err = assumeRoleChain(ctx, deps, store, opts, longTerm, resolved, target, dec)
+		if err != nil {
+			return err
+		}
+	case ModeFederation:
+		issued, err = newFederationToken(ctx, deps, opts, longTerm, resolved)
+		if err != nil {
+			return err
+		}
+		writeShortTerm(store, target, issued)
+	case ModeWebIdentity:
+		issued, err = newWebIdentitySession(ctx, deps, opts, resolved)
+		if err != nil {
+			return err
+		}
+		writeShortTerm(store, target, issued)
+	case ModeOIDC:
+		issued, err = newOIDCSession(ctx, deps, store, opts, resolved)
+		if err != nil {
+			return err
+		}
+		writeShortTerm(store, target, issued)
+	case ModeSSO:
+		issued, err = newSSOSession(ctx, deps, opts, resolved)
+		if err != nil {
+			return err
+		}
+		writeShortTerm(store, target, issued)
+	case ModeRolesAnywhere:
+		issued, err = newRolesAnywhereSession(ctx, deps, opts, resolved)
+		if err != nil {
+			return err
+		}
+		writeShortTerm(store, target, issued)
+	case ModeSAML:
+		issued, target.RoleARN, err = newSAMLSession(ctx, deps, opts, resolved)
+		if err != nil {
+			return err
+		}
+		writeShortTerm(store, target, issued)
+	default:
+		issued, err = newMFASession(ctx, deps, opts, longTerm, resolved, resolved.DurationSeconds)
+		if err != nil {
+			return err
+		}
+		writeShortTerm(store, target, issued)
 	}
-	if region == "" {
-		region = "us-east-1"
+
+	var identity *awssts.CallerIdentity
+	if resolved.SkipVerify {
+		store.DeleteKey(resolved.ShortTermSection, "aws_account_id")
+		store.DeleteKey(resolved.ShortTermSection, "aws_caller_arn")
+	} else {
+		id, err := verifyIdentity(ctx, deps, opts, issued)
+		if err != nil {
+			return err
+		}
+		store.Set(resolved.ShortTermSection, "aws_account_id", id.Account)
+		store.Set(resolved.ShortTermSection, "aws_caller_arn", id.ARN)
+		identity = &id
 	}
 
-	stsClient, err := deps.STSFactory(ctx, region, ltKeyID, ltSecret)
-	if err != nil {
+	// Ctrl-C after the last STS call still leaves the file untouched.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := store.SaveAtomic(); err != nil {
 		return err
 	}
 
+	// The lifetime is reported from the expiration, since in sso mode it is
+	// set by the permission set rather than requested.
+	lifetime := int64(issued.Expiration.Sub(now).Seconds())
+	if identity != nil {
+		_, _ = fmt.Fprintf(deps.Stdout, "✅ Success! Credentials for account %s (%s) will expire in %d seconds at: %s\n",
+			identity.Account,
+			identity.ARN,
+			lifetime,
+			issued.Expiration.UTC().Format(time.RFC3339),
+		)
+		return nil
+	}
+	_, _ = fmt.Fprintf(deps.Stdout, "✅ Success! Your credentials will expire in %d seconds at: %s\n",
+		lifetime,
+		issued.Expiration.UTC().Format(time.RFC3339),
+	)
+	return nil
+}
+
+// verifyIdentity checks that freshly issued credentials work by calling
+// GetCallerIdentity with them. Nothing is written when this fails.
+func verifyIdentity(ctx context.Context, deps Deps, opts awssts.Options, issued issuedCredentials) (awssts.CallerIdentity, error) {
+	stsClient, err := deps.STSFactory(ctx, opts, issued.credentials())
+	if err != nil {
+		return awssts.CallerIdentity{}, err
+	}
+	id, err := stsClient.GetCallerIdentity(ctx)
+	if err != nil {
+		return awssts.CallerIdentity{}, fmt.Errorf("verify new credentials: %w", err)
+	}
+	return id, nil
+}
+
+// issuedCredentials is the common shape of the temporary credentials returned
+// by the STS calls we make.
+type issuedCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+
+	// FederatedUserARN is set for federation tokens.
+	FederatedUserARN string
+	// OIDCRefreshToken is cached to renew oidc mode sessions without a browser.
+	OIDCRefreshToken string
+}
+
+func (c issuedCredentials) credentials() awssts.Credentials {
+	return awssts.Credentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+	}
+}
+
+// newMFASession prompts for an MFA token (unless one was given) and calls
+// GetSessionToken with the long-term credentials.
+func newMFASession(ctx context.Context, deps Deps, opts awssts.Options, longTerm awssts.Credentials, resolved Resolved, duration int32) (issuedCredentials, error) {
+	token := strings.TrimSpace(resolved.Token)
+	if token == "" {
+		var err error
+		token, err = promptToken(ctx, deps.Stdout, deps.Stdin, resolved.Device, duration)
+		if err != nil {
+			return issuedCredentials{}, err
+		}
+	}
+	if !token6Digits.MatchString(token) {
+		return issuedCredentials{}, errInvalidToken
+	}
+
+	stsClient, err := deps.STSFactory(ctx, opts, longTerm)
+	if err != nil {
+		return issuedCredentials{}, err
+	}
+
 	out, err := stsClient.GetSessionToken(ctx, awssts.GetSessionTokenInput{
 		SerialNumber:    resolved.Device,
 		TokenCode:       token,
+		DurationSeconds: duration,
+	})
+	if err != nil {
+		return issuedCredentials{}, err
+	}
+	return issuedCredentials{
+		AccessKeyID:     out.AccessKeyID,
+		SecretAccessKey: out.SecretAccessKey,
+		SessionToken:    out.SessionToken,
+		Expiration:      out.Expiration,
+	}, nil
+}
+
+// newFederationToken calls GetFederationToken with the long-term credentials.
+// Federation tokens cannot be requested with MFA, so there is no prompt.
+func newFederationToken(ctx context.Context, deps Deps, opts awssts.Options, longTerm awssts.Credentials, resolved Resolved) (issuedCredentials, error) {
+	if resolved.Policy == "" && len(resolved.PolicyARNs) == 0 {
+		_, _ = fmt.Fprintln(deps.Stderr, "⚠️ No session policy given (policy_file, policy_arns): the federated session will have no permissions.")
+	}
+
+	stsClient, err := deps.STSFactory(ctx, opts, longTerm)
+	if err != nil {
+		return issuedCredentials{}, err
+	}
+
+	out, err := stsClient.GetFederationToken(ctx, awssts.GetFederationTokenInput{
+		Name:            resolved.FederatedUserName,
 		DurationSeconds: resolved.DurationSeconds,
+		Policy:          resolved.Policy,
+		PolicyARNs:      resolved.PolicyARNs,
 	})
 	if err != nil {
-		return err
+		return issuedCredentials{}, err
 	}
+	return issuedCredentials{
+		AccessKeyID:      out.AccessKeyID,
+		SecretAccessKey:  out.SecretAccessKey,
+		SessionToken:     out.SessionToken,
+		Expiration:       out.Expiration,
+		FederatedUserARN: out.FederatedUserARN,
+	}, nil
+}
+
+// sectionCredentials reads the credentials of any section: temporary
+// credentials previously written by writeShortTerm, or static keys without a
+// session token. Callers that need a session token check for it themselves.
+func sectionCredentials(store *credentials.Store, sec string) (awssts.Credentials, error) {
+	if !store.HasSection(sec) {
+		return awssts.Credentials{}, fmt.Errorf("credentials section [%s] does not exist", sec)
+	}
+	var c awssts.Credentials
+	var err error
+	if c.AccessKeyID, err = store.MustGet(sec, "aws_access_key_id"); err != nil {
+		return awssts.Credentials{}, err
+	}
+	if c.SecretAccessKey, err = store.MustGet(sec, "aws_secret_access_key"); err != nil {
+		return awssts.Credentials{}, err
+	}
+	c.SessionToken, _ = store.Get(sec, "aws_session_token")
+	return c, nil
+}
+
+// writeShortTerm writes temporary credentials into target.Section, together
+// with the metadata DecideRefresh later compares against: the mode, the
+// assumed role, target.Metadata and the parent section.
+func writeShortTerm(store *credentials.Store, target RefreshTarget, c issuedCredentials) {
+	sec := target.Section
 
 	// Ensure section exists and write keys required by AWS SDKs.
-	sec := resolved.ShortTermSection
 	store.Section(sec)
 
 	// Keep close to upstream: provide both session/security token keys.
-	store.Set(sec, "aws_access_key_id", out.AccessKeyID)
-	store.Set(sec, "aws_secret_access_key", out.SecretAccessKey)
-	store.Set(sec, "aws_session_token", out.SessionToken)
-	store.Set(sec, "aws_security_token", out.SessionToken)
-	store.Set(sec, "expiration", out.Expiration.UTC().Format(expirationLayout))
+	store.Set(sec, "aws_access_key_id", c.AccessKeyID)
+	store.Set(sec, "aws_secret_access_key", c.SecretAccessKey)
+	store.Set(sec, "aws_session_token", c.SessionToken)
+	store.Set(sec, "aws_security_token", c.SessionToken)
+	store.Set(sec, "expiration", c.Expiration.UTC().Format(expirationLayout))
 
-	// Future-proofing: upstream writes this; we keep it explicit even in v1.
-	store.Set(sec, "assumed_role", "False")
-	store.DeleteKey(sec, "assumed_role_arn")
+	store.Set(sec, "mode", target.mode())
+	for _, kv := range [][2]string{
+		{"federated_user_arn", c.FederatedUserARN},
+		{"oidc_refresh_token", c.OIDCRefreshToken},
+	} {
+		if kv[1] != "" {
+			store.Set(sec, kv[0], kv[1])
+		} else {
+			store.DeleteKey(sec, kv[0])
+		}
+	}
 
-	if err := store.SaveAtomic(); err != nil {
-		return err
+	// Same metadata keys as upstream aws-mfa.
+	if target.RoleARN != "" {
+		store.Set(sec, "assumed_role", "True")
+		store.Set(sec, "assumed_role_arn", target.RoleARN)
+	} else {
+		store.Set(sec, "assumed_role", "False")
+		store.DeleteKey(sec, "assumed_role_arn")
 	}
 
-	_, _ = fmt.Fprintf(deps.Stdout, "✅ Success! Your credentials will expire in %d seconds at: %s\n",
-		resolved.DurationSeconds,
-		out.Expiration.UTC().Format(time.RFC3339),
-	)
-	return nil
+	for k, v := range target.Metadata {
+		if v == "" {
+			store.DeleteKey(sec, k)
+			continue
+		}
+		store.Set(sec, k, v)
+	}
+
+	parent := ""
+	if target.Parent != nil {
+		parent = target.Parent.Section
+	}
+	store.SetParent(sec, parent)
 }
 
-func promptToken(stdout io.Writer, stdin io.Reader, device string, duration int32) (string, error) {
+// promptToken reads an MFA code from stdin. It returns ctx.Err() as soon as
+// ctx is canceled (Ctrl-C), without waiting for the read to finish.
+func promptToken(ctx context.Context, stdout io.Writer, stdin io.Reader, device string, duration int32) (string, error) {
 	_, _ = fmt.Fprintf(stdout, "🔐 Enter AWS MFA code for device [%s] (renewing for %d seconds): ", device, duration)
-	r := bufio.NewReader(stdin)
-	line, err := r.ReadString('\n')
-	if err != nil && !errors.Is(err, io.EOF) {
+	line, err := readLine(ctx, stdout, stdin)
+	if err != nil && ctx.Err() == nil {
 		return "", fmt.Errorf("read token: %w", err)
 	}
-	return strings.TrimSpace(line), nil
+	return line, err
+}
+
+// readLine reads one line of input. It returns ctx.Err() as soon as ctx is
+// canceled, without waiting for the read to finish. It reads byte by byte, so
+// consecutive prompts can share stdin.
+func readLine(ctx context.Context, stdout io.Writer, stdin io.Reader) (string, error) {
+	type result struct {
+		line string
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		var line strings.Builder
+		buf := make([]byte, 1)
+		for {
+			n, err := stdin.Read(buf)
+			if n > 0 {
+				if buf[0] == '\n' {
+					break
+				}
+				line.WriteByte(buf[0])
+			}
+			if err != nil {
+				ch <- result{line.String(), err}
+				return
+			}
+		}
+		ch <- result{line.String(), nil}
+	}()
+
+	select {
+	case <-ctx.Done():
+		_, _ = fmt.Fprintln(stdout)
+		return "", ctx.Err()
+	case r := <-ch:
+		if r.err != nil && !errors.Is(r.err, io.EOF) {
+			return "", r.err
+		}
+		return strings.TrimSpace(r.line), nil
+	}
 }
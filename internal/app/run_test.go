@@ -3,7 +3,12 @@ package app
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
+	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,16 +17,59 @@ import (
 )
 
 type fakeSTS struct {
-	calls int
-	out   awssts.GetSessionTokenOutput
-	err   error
+	calls   int
+	out     awssts.GetSessionTokenOutput
+	roleOut awssts.AssumeRoleOutput
+	fedOut  awssts.GetFederationTokenOutput
+	err     error
+
+	gotSession []awssts.GetSessionTokenInput
+	gotRole    []awssts.AssumeRoleInput
+	gotFed     []awssts.GetFederationTokenInput
+	gotWeb     []awssts.AssumeRoleWithWebIdentityInput
+	gotSAML    []awssts.AssumeRoleWithSAMLInput
+
+	// identity is returned by GetCallerIdentity, which is not counted in calls,
+	// after the errors in identityErrs, one per call.
+	identity      awssts.CallerIdentity
+	identityErrs  []error
+	identityCalls int
+
+	// decoded is returned by DecodeAuthorizationMessage.
+	decoded   string
+	gotDecode []string
 }
 
 func (f *fakeSTS) GetSessionToken(ctx context.Context, in awssts.GetSessionTokenInput) (awssts.GetSessionTokenOutput, error) {
 	f.calls++
+	f.gotSession = append(f.gotSession, in)
 	return f.out, f.err
 }
 
+func (f *fakeSTS) AssumeRole(ctx context.Context, in awssts.AssumeRoleInput) (awssts.AssumeRoleOutput, error) {
+	f.calls++
+	f.gotRole = append(f.gotRole, in)
+	return f.roleOut, f.err
+}
+
+func (f *fakeSTS) GetFederationToken(ctx context.Context, in awssts.GetFederationTokenInput) (awssts.GetFederationTokenOutput, error) {
+	f.calls++
+	f.gotFed = append(f.gotFed, in)
+	return f.fedOut, f.err
+}
+
+func (f *fakeSTS) AssumeRoleWithWebIdentity(ctx context.Context, in awssts.AssumeRoleWithWebIdentityInput) (awssts.AssumeRoleOutput, error) {
+	f.calls++
+	f.gotWeb = append(f.gotWeb, in)
+	return f.roleOut, f.err
+}
+
+func (f *fakeSTS) AssumeRoleWithSAML(ctx context.Context, in awssts.AssumeRoleWithSAMLInput) (awssts.AssumeRoleOutput, error) {
+	f.calls++
+	f.gotSAML = append(f.gotSAML, in)
+	return f.roleOut, f.err
+}
+
 func TestRun_RefreshWritesCredentials(t *testing.T) {
 	dir := t.TempDir()
 	credsPath := filepath.Join(dir, "credentials")
@@ -55,7 +103,7 @@ func TestRun_RefreshWritesCredentials(t *testing.T) {
 	deps.Now = func() time.Time { return time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC) }
 	deps.Stdout = &stdout
 	deps.Stderr = &stdout
-	deps.STSFactory = func(ctx context.Context, region, accessKeyID, secretAccessKey string) (awssts.Client, error) {
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
 		return fake, nil
 	}
 
@@ -125,7 +173,7 @@ func TestRun_SkipsRefreshWhenStillValid(t *testing.T) {
 	deps.Now = func() time.Time { return now }
 	deps.Stdout = ioDiscard{}
 	deps.Stderr = ioDiscard{}
-	deps.STSFactory = func(ctx context.Context, region, accessKeyID, secretAccessKey string) (awssts.Client, error) {
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
 		return fake, nil
 	}
 
@@ -147,7 +195,878 @@ func TestRun_SkipsRefreshWhenStillValid(t *testing.T) {
 	}
 }
 
-// ioDiscard is a tiny io.Writer used to avoid importing io in this test file.
-type ioDiscard struct{}
+func TestRun_AssumeRoleWritesRoleMetadata(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
 
-func (ioDiscard) Write(p []byte) (int, error) { return len(p), nil }
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	roleARN := "arn:aws:iam::210987654321:role/admin"
+	store.Set("prod-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("prod-long-term", "aws_secret_access_key", "SECRET_LT")
+	store.Set("prod-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/me")
+	store.Set("prod-long-term", "assume_role", roleARN)
+	store.Set("prod-long-term", "external_id", "ext-123")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	exp := time.Date(2026, 2, 9, 12, 0, 0, 0, time.UTC)
+	fake := &fakeSTS{
+		out: awssts.GetSessionTokenOutput{
+			AccessKeyID:     "ASIA_SESSION",
+			SecretAccessKey: "SECRET_SESSION",
+			SessionToken:    "TOKEN_SESSION",
+			Expiration:      exp.Add(11 * time.Hour),
+		},
+		roleOut: awssts.AssumeRoleOutput{
+			AccessKeyID:     "ASIA_ROLE",
+			SecretAccessKey: "SECRET_ROLE",
+			SessionToken:    "TOKEN_ROLE",
+			Expiration:      exp,
+		},
+	}
+
+	deps := DefaultDeps()
+	var gotCreds []awssts.Credentials
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1", "USER": "jane"}
+	deps.Now = func() time.Time { return time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC) }
+	deps.Stdout = ioDiscard{}
+	deps.Stderr = ioDiscard{}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		gotCreds = append(gotCreds, creds)
+		return fake, nil
+	}
+
+	err = Run(context.Background(), RunInputs{
+		Inputs: Inputs{
+			Profile:         "prod",
+			ProfileChanged:  true,
+			LongTermSuffix:  "long-term",
+			ShortTermSuffix: "none",
+			CredentialsFile: credsPath,
+			Token:           "123456",
+			TokenChanged:    true,
+		},
+	}, deps)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if fake.calls != 2 || len(fake.gotRole) != 1 {
+		t.Fatalf("expected GetSessionToken and AssumeRole once each, got %d calls", fake.calls)
+	}
+	want := awssts.AssumeRoleInput{
+		RoleARN:         roleARN,
+		RoleSessionName: "jane",
+		ExternalID:      "ext-123",
+		DurationSeconds: 3600,
+	}
+	if !reflect.DeepEqual(fake.gotRole[0], want) {
+		t.Fatalf("expected AssumeRole input %+v, got %+v", want, fake.gotRole[0])
+	}
+	// Long-term keys for GetSessionToken, the session for AssumeRole, then the
+	// role credentials to verify the caller identity.
+	if len(gotCreds) != 3 || gotCreds[0].AccessKeyID != "AKIA_LT" || gotCreds[1].SessionToken != "TOKEN_SESSION" || gotCreds[2].SessionToken != "TOKEN_ROLE" {
+		t.Fatalf("expected long-term, session, then role credentials, got %+v", gotCreds)
+	}
+
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	if v, _ := updated.Get("prod", "aws_access_key_id"); v != "ASIA_ROLE" {
+		t.Fatalf("expected role key id, got %q", v)
+	}
+	if v, _ := updated.Get("prod", "assumed_role"); v != "True" {
+		t.Fatalf("expected assumed_role=True, got %q", v)
+	}
+	if v, _ := updated.Get("prod", "assumed_role_arn"); v != roleARN {
+		t.Fatalf("expected assumed_role_arn=%q, got %q", roleARN, v)
+	}
+	if v, _ := updated.Get("prod-mfa-session", "aws_session_token"); v != "TOKEN_SESSION" {
+		t.Fatalf("expected cached MFA session, got %q", v)
+	}
+	if p, _ := updated.Parent("prod"); p != "prod-mfa-session" {
+		t.Fatalf("expected parent section prod-mfa-session, got %q", p)
+	}
+}
+
+func TestRun_ReassumesRoleFromValidMFASessionWithoutPrompt(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 12, 0, 0, 0, time.UTC)
+	roleARN := "arn:aws:iam::210987654321:role/admin"
+	store.Set("prod-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("prod-long-term", "aws_secret_access_key", "SECRET_LT")
+	store.Set("prod-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/me")
+	store.Set("prod-long-term", "assume_role", roleARN)
+
+	// Expired role session.
+	store.Set("prod", "aws_access_key_id", "ASIA_OLD")
+	store.Set("prod", "aws_secret_access_key", "SECRET_OLD")
+	store.Set("prod", "aws_session_token", "TOKEN_OLD")
+	store.Set("prod", "aws_security_token", "TOKEN_OLD")
+	store.Set("prod", "expiration", now.Add(-time.Minute).Format(expirationLayout))
+	store.Set("prod", "assumed_role", "True")
+	store.Set("prod", "assumed_role_arn", roleARN)
+
+	// Still valid MFA session.
+	store.Set("prod-mfa-session", "aws_access_key_id", "ASIA_SESSION")
+	store.Set("prod-mfa-session", "aws_secret_access_key", "SECRET_SESSION")
+	store.Set("prod-mfa-session", "aws_session_token", "TOKEN_SESSION")
+	store.Set("prod-mfa-session", "aws_security_token", "TOKEN_SESSION")
+	store.Set("prod-mfa-session", "expiration", now.Add(10*time.Hour).Format(expirationLayout))
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	fake := &fakeSTS{
+		roleOut: awssts.AssumeRoleOutput{
+			AccessKeyID:     "ASIA_ROLE",
+			SecretAccessKey: "SECRET_ROLE",
+			SessionToken:    "TOKEN_ROLE",
+			Expiration:      now.Add(time.Hour),
+		},
+	}
+
+	var gotCreds []awssts.Credentials
+	var stdout bytes.Buffer
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = &stdout
+	deps.Stderr = &stdout
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		gotCreds = append(gotCreds, creds)
+		return fake, nil
+	}
+
+	// No token and empty stdin: a prompt would fail the six-digit check.
+	err = Run(context.Background(), RunInputs{
+		Inputs: Inputs{
+			Profile:         "prod",
+			ProfileChanged:  true,
+			LongTermSuffix:  "long-term",
+			ShortTermSuffix: "none",
+			CredentialsFile: credsPath,
+		},
+	}, deps)
+	if err != nil {
+		t.Fatalf("Run: %v\n%s", err, stdout.String())
+	}
+	if fake.calls != 1 || len(fake.gotRole) != 1 {
+		t.Fatalf("expected only AssumeRole to be called, got %d calls", fake.calls)
+	}
+	if fake.gotRole[0].SerialNumber != "" || fake.gotRole[0].TokenCode != "" {
+		t.Fatalf("expected AssumeRole without MFA, got %+v", fake.gotRole[0])
+	}
+	wantCreds := awssts.Credentials{AccessKeyID: "ASIA_SESSION", SecretAccessKey: "SECRET_SESSION", SessionToken: "TOKEN_SESSION"}
+	if len(gotCreds) != 2 || gotCreds[0] != wantCreds {
+		t.Fatalf("expected cached session credentials, got %+v", gotCreds)
+	}
+
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	if v, _ := updated.Get("prod", "aws_access_key_id"); v != "ASIA_ROLE" {
+		t.Fatalf("expected refreshed role key id, got %q", v)
+	}
+}
+
+func TestRun_RoleChainAssumesEachHopAndCachesIntermediates(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	hub := "arn:aws:iam::111111111111:role/hub"
+	workload := "arn:aws:iam::222222222222:role/workload"
+	store.Set("prod-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("prod-long-term", "aws_secret_access_key", "SECRET_LT")
+	store.Set("prod-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/me")
+	store.Set("prod-long-term", "role_chain", hub+", "+workload)
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+	fake := &fakeSTS{
+		out: awssts.GetSessionTokenOutput{
+			AccessKeyID:     "ASIA_SESSION",
+			SecretAccessKey: "SECRET_SESSION",
+			SessionToken:    "TOKEN_SESSION",
+			Expiration:      now.Add(12 * time.Hour),
+		},
+		roleOut: awssts.AssumeRoleOutput{
+			AccessKeyID:     "ASIA_ROLE",
+			SecretAccessKey: "SECRET_ROLE",
+			SessionToken:    "TOKEN_ROLE",
+			Expiration:      now.Add(time.Hour),
+		},
+	}
+
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1", "USER": "jane"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = ioDiscard{}
+	deps.Stderr = ioDiscard{}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+
+	err = Run(context.Background(), RunInputs{
+		Inputs: Inputs{
+			Profile:         "prod",
+			ProfileChanged:  true,
+			LongTermSuffix:  "long-term",
+			ShortTermSuffix: "none",
+			CredentialsFile: credsPath,
+			Token:           "123456",
+			TokenChanged:    true,
+		},
+	}, deps)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(fake.gotRole) != 2 || fake.gotRole[0].RoleARN != hub || fake.gotRole[1].RoleARN != workload {
+		t.Fatalf("expected hub then workload to be assumed, got %+v", fake.gotRole)
+	}
+
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	if v, _ := updated.Get("prod-hop-1", "assumed_role_arn"); v != hub {
+		t.Fatalf("expected cached hub hop, got %q", v)
+	}
+	if p, _ := updated.Parent("prod-hop-1"); p != "prod-mfa-session" {
+		t.Fatalf("expected hub hop parent prod-mfa-session, got %q", p)
+	}
+	if p, _ := updated.Parent("prod"); p != "prod-hop-1" {
+		t.Fatalf("expected short-term parent prod-hop-1, got %q", p)
+	}
+
+	// Later, the workload session expired but the hub hop is still cached:
+	// only the last hop is assumed again, from the hub credentials.
+	updated.Set("prod", "expiration", now.Add(-time.Minute).Format(expirationLayout))
+	if err := updated.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+	fake.gotRole = nil
+	fake.calls = 0
+	err = Run(context.Background(), RunInputs{
+		Inputs: Inputs{
+			Profile:         "prod",
+			ProfileChanged:  true,
+			LongTermSuffix:  "long-term",
+			ShortTermSuffix: "none",
+			CredentialsFile: credsPath,
+		},
+	}, deps)
+	if err != nil {
+		t.Fatalf("Run (second): %v", err)
+	}
+	if fake.calls != 1 || len(fake.gotRole) != 1 || fake.gotRole[0].RoleARN != workload {
+		t.Fatalf("expected only the workload role to be assumed again, got %+v", fake.gotRole)
+	}
+}
+
+func TestRun_SessionTagsAreSentAndRecorded(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+	store.Set("prod-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("prod-long-term", "aws_secret_access_key", "SECRET_LT")
+	store.Set("prod-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/me")
+	store.Set("prod-long-term", "assume_role", "arn:aws:iam::210987654321:role/admin")
+	store.Set("prod-long-term", "session_tags", "team=platform, email={{git_email}}")
+	store.Set("prod-long-term", "transitive_tag_keys", "team")
+	store.Set("prod-long-term", "source_identity", "{{username}}")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	fake := &fakeSTS{
+		out: awssts.GetSessionTokenOutput{
+			AccessKeyID: "ASIA_SESSION", SecretAccessKey: "SECRET_SESSION", SessionToken: "TOKEN_SESSION",
+			Expiration: now.Add(12 * time.Hour),
+		},
+		roleOut: awssts.AssumeRoleOutput{
+			AccessKeyID: "ASIA_ROLE", SecretAccessKey: "SECRET_ROLE", SessionToken: "TOKEN_ROLE",
+			Expiration: now.Add(time.Hour),
+		},
+	}
+
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1", "USER": "jane"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = ioDiscard{}
+	deps.Stderr = ioDiscard{}
+	deps.GitEmail = func(ctx context.Context) (string, error) { return "jane@example.com", nil }
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+
+	in := RunInputs{
+		Inputs: Inputs{
+			Profile:         "prod",
+			ProfileChanged:  true,
+			LongTermSuffix:  "long-term",
+			ShortTermSuffix: "none",
+			CredentialsFile: credsPath,
+			Token:           "123456",
+			TokenChanged:    true,
+		},
+	}
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(fake.gotRole) != 1 {
+		t.Fatalf("expected one AssumeRole call, got %d", len(fake.gotRole))
+	}
+	got := fake.gotRole[0]
+	wantTags := []awssts.Tag{{Key: "team", Value: "platform"}, {Key: "email", Value: "jane@example.com"}}
+	if !reflect.DeepEqual(got.Tags, wantTags) {
+		t.Fatalf("expected tags %+v, got %+v", wantTags, got.Tags)
+	}
+	if !reflect.DeepEqual(got.TransitiveTagKeys, []string{"team"}) || got.SourceIdentity != "jane" {
+		t.Fatalf("unexpected transitive keys/source identity: %+v", got)
+	}
+
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	if v, _ := updated.Get("prod", "session_tags"); v != "email=jane@example.com,team=platform" {
+		t.Fatalf("expected recorded session tags, got %q", v)
+	}
+
+	// Changing a tag invalidates the still-valid role session.
+	updated.Set("prod-long-term", "session_tags", "team=security")
+	updated.Set("prod-long-term", "transitive_tag_keys", "")
+	if err := updated.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+	fake.gotRole = nil
+	in.Token, in.TokenChanged = "", false
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run (second): %v", err)
+	}
+	if len(fake.gotRole) != 1 || fake.gotRole[0].Tags[0].Value != "security" {
+		t.Fatalf("expected the role to be assumed again with new tags, got %+v", fake.gotRole)
+	}
+}
+
+func TestRun_SessionPolicyScopesFinalRoleAndWritesMarker(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+	policyPath := filepath.Join(dir, "read-only.json")
+	if err := os.WriteFile(policyPath, []byte("{\n  \"Version\": \"2012-10-17\",\n  \"Statement\": []\n}\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+	store.Set("prod-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("prod-long-term", "aws_secret_access_key", "SECRET_LT")
+	store.Set("prod-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/me")
+	store.Set("prod-long-term", "assume_role", "arn:aws:iam::210987654321:role/admin")
+	store.Set("prod-long-term", "policy_file", policyPath)
+	store.Set("prod-long-term", "policy_arns", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	fake := &fakeSTS{
+		out: awssts.GetSessionTokenOutput{
+			AccessKeyID: "ASIA_SESSION", SecretAccessKey: "SECRET_SESSION", SessionToken: "TOKEN_SESSION",
+			Expiration: now.Add(12 * time.Hour),
+		},
+		roleOut: awssts.AssumeRoleOutput{
+			AccessKeyID: "ASIA_ROLE", SecretAccessKey: "SECRET_ROLE", SessionToken: "TOKEN_ROLE",
+			Expiration: now.Add(time.Hour),
+		},
+	}
+
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1", "USER": "jane"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = ioDiscard{}
+	deps.Stderr = ioDiscard{}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+
+	err = Run(context.Background(), RunInputs{
+		Inputs: Inputs{
+			Profile:         "prod",
+			ProfileChanged:  true,
+			LongTermSuffix:  "long-term",
+			ShortTermSuffix: "none",
+			CredentialsFile: credsPath,
+			Token:           "123456",
+			TokenChanged:    true,
+		},
+	}, deps)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(fake.gotRole) != 1 {
+		t.Fatalf("expected one AssumeRole call, got %d", len(fake.gotRole))
+	}
+	if got := fake.gotRole[0].Policy; got != `{"Version":"2012-10-17","Statement":[]}` {
+		t.Fatalf("expected compacted policy, got %q", got)
+	}
+	if !reflect.DeepEqual(fake.gotRole[0].PolicyARNs, []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}) {
+		t.Fatalf("unexpected policy ARNs: %v", fake.gotRole[0].PolicyARNs)
+	}
+
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	if v, _ := updated.Get("prod", "scoped"); v != "True" {
+		t.Fatalf("expected scoped=True, got %q", v)
+	}
+	if v, _ := updated.Get("prod", "session_policy_hash"); !strings.HasPrefix(v, "sha256:") {
+		t.Fatalf("expected policy fingerprint, got %q", v)
+	}
+	if _, ok := updated.Get("prod-mfa-session", "scoped"); ok {
+		t.Fatalf("expected the MFA session not to be marked as scoped")
+	}
+}
+
+func TestRun_VerifiesCallerIdentityAndRecordsAccount(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("default-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("default-long-term", "aws_secret_access_key", "SECRET_LT")
+	store.Set("default-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/me")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+	fake := &fakeSTS{
+		out: awssts.GetSessionTokenOutput{
+			AccessKeyID: "ASIA_ST", SecretAccessKey: "SECRET_ST", SessionToken: "TOKEN_ST",
+			Expiration: now.Add(12 * time.Hour),
+		},
+		identity: awssts.CallerIdentity{
+			Account: "123456789012",
+			ARN:     "arn:aws:iam::123456789012:user/me",
+			UserID:  "AIDAEXAMPLE",
+		},
+	}
+
+	var stdout bytes.Buffer
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = &stdout
+	deps.Stderr = &stdout
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+
+	in := RunInputs{
+		Inputs: Inputs{
+			Profile:         "default",
+			ProfileChanged:  true,
+			LongTermSuffix:  "long-term",
+			ShortTermSuffix: "none",
+			CredentialsFile: credsPath,
+			Token:           "123456",
+			TokenChanged:    true,
+		},
+	}
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if fake.identityCalls != 1 {
+		t.Fatalf("expected one GetCallerIdentity call, got %d", fake.identityCalls)
+	}
+	if !strings.Contains(stdout.String(), "account 123456789012") {
+		t.Fatalf("expected success message to mention the account, got:\n%s", stdout.String())
+	}
+
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	if v, _ := updated.Get("default", "aws_account_id"); v != "123456789012" {
+		t.Fatalf("expected aws_account_id, got %q", v)
+	}
+	if v, _ := updated.Get("default", "aws_caller_arn"); v != "arn:aws:iam::123456789012:user/me" {
+		t.Fatalf("expected aws_caller_arn, got %q", v)
+	}
+
+	// Opting out skips the call and drops the now unverified identity keys.
+	in.Force = true
+	in.SkipVerify = true
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run (skip verify): %v", err)
+	}
+	if fake.identityCalls != 1 {
+		t.Fatalf("expected no additional GetCallerIdentity call, got %d", fake.identityCalls)
+	}
+	updated, err = credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	if _, ok := updated.Get("default", "aws_account_id"); ok {
+		t.Fatalf("expected aws_account_id to be removed when verification is skipped")
+	}
+}
+
+func TestRun_FederationModeWritesFederatedSession(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("default-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("default-long-term", "aws_secret_access_key", "SECRET_LT")
+	store.Set("default-long-term", "mode", "federation")
+	store.Set("default-long-term", "federated_user_name", "console-alice")
+	store.Set("default-long-term", "policy_arns", "arn:aws:iam::aws:policy/ReadOnlyAccess")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+	fake := &fakeSTS{
+		fedOut: awssts.GetFederationTokenOutput{
+			AccessKeyID: "ASIA_FED", SecretAccessKey: "SECRET_FED", SessionToken: "TOKEN_FED",
+			Expiration:       now.Add(12 * time.Hour),
+			FederatedUserARN: "arn:aws:sts::123456789012:federated-user/console-alice",
+		},
+	}
+
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = ioDiscard{}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+
+	in := RunInputs{
+		Inputs: Inputs{
+			Profile:         "default",
+			ProfileChanged:  true,
+			LongTermSuffix:  "long-term",
+			ShortTermSuffix: "none",
+			CredentialsFile: credsPath,
+		},
+	}
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := awssts.GetFederationTokenInput{
+		Name:            "console-alice",
+		DurationSeconds: 43200,
+		PolicyARNs:      []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+	}
+	if len(fake.gotFed) != 1 || !reflect.DeepEqual(fake.gotFed[0], want) {
+		t.Fatalf("expected GetFederationToken %+v, got %+v", want, fake.gotFed)
+	}
+
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	for k, want := range map[string]string{
+		"aws_access_key_id":   "ASIA_FED",
+		"mode":                "federation",
+		"assumed_role":        "False",
+		"federated_user_name": "console-alice",
+		"federated_user_arn":  "arn:aws:sts::123456789012:federated-user/console-alice",
+		"scoped":              "True",
+	} {
+		if v, _ := updated.Get("default", k); v != want {
+			t.Fatalf("expected %s=%q, got %q", k, want, v)
+		}
+	}
+
+	// The federated session is reused while valid.
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run (second): %v", err)
+	}
+	if fake.calls != 1 {
+		t.Fatalf("expected no new STS call, got %d calls", fake.calls)
+	}
+}
+
+func TestRun_WebIdentityNeedsNoLongTermKeys(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+	tokenPath := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenPath, []byte("eyJ.JWT.sig\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("ci-long-term", "web_identity_token_file", tokenPath)
+	store.Set("ci-long-term", "role_arn", "arn:aws:iam::123456789012:role/ci")
+	store.Set("ci-long-term", "role_session_name", "runner-1")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+	fake := &fakeSTS{
+		roleOut: awssts.AssumeRoleOutput{
+			AccessKeyID: "ASIA_WEB", SecretAccessKey: "SECRET_WEB", SessionToken: "TOKEN_WEB",
+			Expiration: now.Add(time.Hour),
+		},
+	}
+	var gotCreds []awssts.Credentials
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = ioDiscard{}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		gotCreds = append(gotCreds, creds)
+		return fake, nil
+	}
+
+	in := RunInputs{
+		Inputs: Inputs{
+			Profile:         "ci",
+			ProfileChanged:  true,
+			LongTermSuffix:  "long-term",
+			ShortTermSuffix: "none",
+			CredentialsFile: credsPath,
+		},
+	}
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := awssts.AssumeRoleWithWebIdentityInput{
+		RoleARN:          "arn:aws:iam::123456789012:role/ci",
+		RoleSessionName:  "runner-1",
+		WebIdentityToken: "eyJ.JWT.sig",
+		DurationSeconds:  3600,
+	}
+	if len(fake.gotWeb) != 1 || !reflect.DeepEqual(fake.gotWeb[0], want) {
+		t.Fatalf("expected AssumeRoleWithWebIdentity %+v, got %+v", want, fake.gotWeb)
+	}
+	if gotCreds[0] != (awssts.Credentials{}) {
+		t.Fatalf("expected an unsigned client for the web identity call, got %+v", gotCreds[0])
+	}
+
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	for k, want := range map[string]string{
+		"aws_access_key_id": "ASIA_WEB",
+		"mode":              ModeWebIdentity,
+		"assumed_role":      "True",
+		"assumed_role_arn":  "arn:aws:iam::123456789012:role/ci",
+	} {
+		if v, _ := updated.Get("ci", k); v != want {
+			t.Fatalf("expected %s=%q, got %q", k, want, v)
+		}
+	}
+
+	// Still valid: no new call.
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run (second): %v", err)
+	}
+	if fake.calls != 1 {
+		t.Fatalf("expected one STS call, got %d", fake.calls)
+	}
+}
+
+func TestRun_CancelDuringPromptLeavesFileUntouched(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("default-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("default-long-term", "aws_secret_access_key", "SECRET_LT")
+	store.Set("default-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/me")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+	before, err := os.ReadFile(credsPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	fake := &fakeSTS{}
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1"}
+	deps.Stdout = ioDiscard{}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+
+	// The prompt blocks on stdin until the context is canceled, as with Ctrl-C.
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+	deps.Stdin = stdin
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	err = Run(ctx, RunInputs{
+		Inputs: Inputs{
+			Profile:         "default",
+			ProfileChanged:  true,
+			LongTermSuffix:  "long-term",
+			ShortTermSuffix: "none",
+			CredentialsFile: credsPath,
+		},
+	}, deps)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if ExitCode(err) != ExitCanceled {
+		t.Fatalf("expected exit code %d, got %d", ExitCanceled, ExitCode(err))
+	}
+	if fake.calls != 0 {
+		t.Fatalf("expected no STS calls, got %d", fake.calls)
+	}
+	after, err := os.ReadFile(credsPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatalf("expected credentials file to be untouched")
+	}
+}
+
+func (f *fakeSTS) GetCallerIdentity(ctx context.Context) (awssts.CallerIdentity, error) {
+	f.identityCalls++
+	if len(f.identityErrs) > 0 {
+		err := f.identityErrs[0]
+		f.identityErrs = f.identityErrs[1:]
+		return awssts.CallerIdentity{}, err
+	}
+	return f.identity, nil
+}
+
+func (f *fakeSTS) DecodeAuthorizationMessage(ctx context.Context, encoded string) (string, error) {
+	f.gotDecode = append(f.gotDecode, encoded)
+	return f.decoded, f.err
+}
+
+// ioDiscard is a tiny io.Writer used to avoid importing io in this test file.
+type ioDiscard struct{}
+
+func (ioDiscard) Write(p []byte) (int, error) { return len(p), nil }
+
+func TestRun_SourceProfileUsesSourceKeysAndSharesMFASession(t *testing.T) {
+	credsPath := filepath.Join(t.TempDir(), "credentials")
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("prod-long-term", "aws_access_key_id", "AKIA_LT")
+	store.Set("prod-long-term", "aws_secret_access_key", "SECRET_LT")
+	store.Set("prod-long-term", "aws_mfa_device", "arn:aws:iam::123456789012:mfa/me")
+	for _, role := range []string{"admin", "readonly"} {
+		store.Set("prod-"+role+"-long-term", "source_profile", "prod")
+		store.Set("prod-"+role+"-long-term", "assume_role", "arn:aws:iam::210987654321:role/"+role)
+	}
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+	fake := &fakeSTS{
+		out:     awssts.GetSessionTokenOutput{AccessKeyID: "ASIA_SESSION", SecretAccessKey: "SECRET_SESSION", SessionToken: "TOKEN_SESSION", Expiration: now.Add(12 * time.Hour)},
+		roleOut: awssts.AssumeRoleOutput{AccessKeyID: "ASIA_ROLE", SecretAccessKey: "SECRET_ROLE", SessionToken: "TOKEN_ROLE", Expiration: now.Add(time.Hour)},
+	}
+	var gotCreds []awssts.Credentials
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1", "USER": "jane"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = ioDiscard{}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		gotCreds = append(gotCreds, creds)
+		return fake, nil
+	}
+	run := func(profile, token string) error {
+		return Run(context.Background(), RunInputs{Inputs: Inputs{
+			Profile:         profile,
+			ProfileChanged:  true,
+			LongTermSuffix:  "long-term",
+			ShortTermSuffix: "none",
+			CredentialsFile: credsPath,
+			Token:           token,
+			TokenChanged:    token != "",
+		}}, deps)
+	}
+
+	if err := run("prod-admin", "123456"); err != nil {
+		t.Fatalf("Run prod-admin: %v", err)
+	}
+	if len(fake.gotSession) != 1 || fake.gotSession[0].SerialNumber != "arn:aws:iam::123456789012:mfa/me" || gotCreds[0].AccessKeyID != "AKIA_LT" {
+		t.Fatalf("expected GetSessionToken with the source's keys and device, got %+v with %+v", fake.gotSession, gotCreds)
+	}
+
+	// The second role profile reuses the MFA session of prod: no token needed.
+	if err := run("prod-readonly", ""); err != nil {
+		t.Fatalf("Run prod-readonly: %v", err)
+	}
+	if len(fake.gotSession) != 1 || len(fake.gotRole) != 2 || fake.gotRole[1].RoleARN != "arn:aws:iam::210987654321:role/readonly" {
+		t.Fatalf("expected the shared MFA session to be reused, got %d sessions and roles %+v", len(fake.gotSession), fake.gotRole)
+	}
+
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	if v, _ := updated.Get("prod-mfa-session", "aws_session_token"); v != "TOKEN_SESSION" {
+		t.Fatalf("expected the MFA session in [prod-mfa-session], got %q", v)
+	}
+	if updated.HasSection("prod-admin-mfa-session") || updated.HasSection("prod-readonly-mfa-session") {
+		t.Fatal("expected no MFA session sections of the role profiles")
+	}
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/saml"
+)
+
+// SAMLSettings configure where saml mode gets its assertion from. Exactly
+// one of AssertionFile ("-" for stdin) and Helper is set.
+type SAMLSettings struct {
+	AssertionFile string
+	Helper        string
+	// RoleRemembered is true when RoleARN was not configured but taken from
+	// the previous run, so a role the IdP no longer offers is asked for again.
+	RoleRemembered bool
+}
+
+// runHelper runs a helper command through the shell and returns its output.
+// The helper shares the terminal, so it can prompt for an IdP login.
+func runHelper(ctx context.Context, command string) (string, error) {
+	cmd := shellCommand(ctx, command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("saml helper %q: %w", command, err)
+	}
+	return string(out), nil
+}
+
+// shellCommand runs a user-configured command line through the shell.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command) //nolint:gosec // G204: command is user-provided configuration
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command) //nolint:gosec // G204: command is user-provided configuration
+}
+
+// readSAMLAssertion reads the base64 SAMLResponse from the configured file,
+// stdin or helper command.
+func readSAMLAssertion(ctx context.Context, deps Deps, settings SAMLSettings) (string, error) {
+	var raw string
+	switch {
+	case settings.Helper != "":
+		if deps.Helper == nil {
+			return "", configError(fmt.Errorf("saml_helper %q is configured but running helper commands is not available", settings.Helper))
+		}
+		out, err := deps.Helper(ctx, settings.Helper)
+		if err != nil {
+			return "", err
+		}
+		raw = out
+	case settings.AssertionFile == "-":
+		b, err := io.ReadAll(deps.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("read saml assertion: %w", err)
+		}
+		raw = string(b)
+	default:
+		b, err := os.ReadFile(ExpandHome(settings.AssertionFile)) //nolint:gosec // G304: path is user-provided configuration
+		if err != nil {
+			return "", configError(fmt.Errorf("read saml assertion: %w", err))
+		}
+		raw = string(b)
+	}
+	return saml.Normalize(raw)
+}
+
+// newSAMLSession exchanges a SAML assertion for credentials of one of the
+// roles it offers, and returns them along with the chosen role ARN.
+//
+// The role is the configured one (or the one chosen last time); otherwise a
+// single offered role is used as is, and several are offered in a prompt.
+func newSAMLSession(ctx context.Context, deps Deps, opts awssts.Options, resolved Resolved) (issuedCredentials, string, error) {
+	assertion, err := readSAMLAssertion(ctx, deps, resolved.SAML)
+	if err != nil {
+		return issuedCredentials{}, "", err
+	}
+	roles, err := saml.Roles(assertion)
+	if err != nil {
+		return issuedCredentials{}, "", err
+	}
+	role, err := selectSAMLRole(ctx, deps, roles, resolved)
+	if err != nil {
+		return issuedCredentials{}, "", err
+	}
+
+	stsClient, err := deps.STSFactory(ctx, opts, awssts.Credentials{})
+	if err != nil {
+		return issuedCredentials{}, "", err
+	}
+	out, err := stsClient.AssumeRoleWithSAML(ctx, awssts.AssumeRoleWithSAMLInput{
+		RoleARN:         role.RoleARN,
+		PrincipalARN:    role.PrincipalARN,
+		SAMLAssertion:   assertion,
+		DurationSeconds: resolved.DurationSeconds,
+		Policy:          resolved.Policy,
+		PolicyARNs:      resolved.PolicyARNs,
+	})
+	if err != nil {
+		return issuedCredentials{}, "", err
+	}
+	return issuedCredentials{
+		AccessKeyID:     out.AccessKeyID,
+		SecretAccessKey: out.SecretAccessKey,
+		SessionToken:    out.SessionToken,
+		Expiration:      out.Expiration,
+	}, role.RoleARN, nil
+}
+
+// selectSAMLRole picks the role to assume among those offered by the assertion.
+func selectSAMLRole(ctx context.Context, deps Deps, roles []saml.Role, resolved Resolved) (saml.Role, error) {
+	if resolved.RoleARN != "" {
+		for _, r := range roles {
+			if r.RoleARN == resolved.RoleARN {
+				return r, nil
+			}
+		}
+		if !resolved.SAML.RoleRemembered {
+			return saml.Role{}, fmt.Errorf("role %s is not offered by the saml assertion", resolved.RoleARN)
+		}
+	}
+	if len(roles) == 1 {
+		return roles[0], nil
+	}
+	// The assertion was read from stdin to EOF, so there is nothing left to
+	// read a choice from.
+	if resolved.SAML.AssertionFile == "-" {
+		return saml.Role{}, configError(fmt.Errorf("the saml assertion from stdin offers %d roles: set --assume-role to choose one", len(roles)))
+	}
+
+	_, _ = fmt.Fprintln(deps.Stdout, "🎭 The SAML assertion offers several roles:")
+	for i, r := range roles {
+		_, _ = fmt.Fprintf(deps.Stdout, "  %d) %s\n", i+1, r.RoleARN)
+	}
+	_, _ = fmt.Fprintf(deps.Stdout, "Choose a role [1-%d]: ", len(roles))
+	line, err := readLine(ctx, deps.Stdout, deps.Stdin)
+	if err != nil {
+		if ctx.Err() != nil {
+			return saml.Role{}, err
+		}
+		return saml.Role{}, fmt.Errorf("read role choice: %w", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || n < 1 || n > len(roles) {
+		return saml.Role{}, configError(fmt.Errorf("invalid role choice %q: choose 1-%d, or set --assume-role", line, len(roles)))
+	}
+	return roles[n-1], nil
+}
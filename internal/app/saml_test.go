@@ -0,0 +1,212 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+const samlResponse = `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">
+  <saml:Assertion>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">
+        <saml:AttributeValue>arn:aws:iam::123456789012:role/dev,arn:aws:iam::123456789012:saml-provider/corp</saml:AttributeValue>
+        <saml:AttributeValue>arn:aws:iam::123456789012:role/admin,arn:aws:iam::123456789012:saml-provider/corp</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+
+func TestRun_SAMLModeRemembersChosenRole(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+	assertion := base64.StdEncoding.EncodeToString([]byte(samlResponse))
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("corp-long-term", "saml_helper", "idp-login --profile corp")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+	fake := &fakeSTS{roleOut: awssts.AssumeRoleOutput{
+		AccessKeyID: "ASIA_SAML", SecretAccessKey: "SECRET", SessionToken: "TOKEN",
+		Expiration: now.Add(time.Hour),
+	}}
+	var helpers []string
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = ioDiscard{}
+	deps.Stdin = strings.NewReader("2\n")
+	deps.Helper = func(ctx context.Context, command string) (string, error) {
+		helpers = append(helpers, command)
+		return assertion + "\n", nil
+	}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+
+	in := RunInputs{Inputs: Inputs{
+		Profile:         "corp",
+		ProfileChanged:  true,
+		LongTermSuffix:  "long-term",
+		ShortTermSuffix: "none",
+		CredentialsFile: credsPath,
+	}}
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(helpers) != 1 || helpers[0] != "idp-login --profile corp" {
+		t.Fatalf("unexpected helper calls: %v", helpers)
+	}
+	if len(fake.gotSAML) != 1 {
+		t.Fatalf("expected one AssumeRoleWithSAML call, got %d", len(fake.gotSAML))
+	}
+	got := fake.gotSAML[0]
+	if got.RoleARN != "arn:aws:iam::123456789012:role/admin" ||
+		got.PrincipalARN != "arn:aws:iam::123456789012:saml-provider/corp" ||
+		got.SAMLAssertion != assertion ||
+		got.DurationSeconds != 3600 {
+		t.Fatalf("unexpected AssumeRoleWithSAML input: %+v", got)
+	}
+
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	for k, want := range map[string]string{
+		"aws_access_key_id": "ASIA_SAML",
+		"mode":              ModeSAML,
+		"assumed_role_arn":  "arn:aws:iam::123456789012:role/admin",
+	} {
+		if v, _ := updated.Get("corp", k); v != want {
+			t.Fatalf("expected %s=%q, got %q", k, want, v)
+		}
+	}
+
+	// Once expired, the chosen role is reused without prompting.
+	now = now.Add(2 * time.Hour)
+	deps.Stdin = strings.NewReader("")
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run (renew): %v", err)
+	}
+	if len(fake.gotSAML) != 2 || fake.gotSAML[1].RoleARN != "arn:aws:iam::123456789012:role/admin" {
+		t.Fatalf("expected the remembered role to be assumed, got %+v", fake.gotSAML)
+	}
+}
+
+func TestRun_SAMLModeRejectsRoleNotOffered(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+	assertionPath := filepath.Join(dir, "assertion")
+	if err := os.WriteFile(assertionPath, []byte(base64.StdEncoding.EncodeToString([]byte(samlResponse))), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	fake := &fakeSTS{}
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1"}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+
+	err := Run(context.Background(), RunInputs{Inputs: Inputs{
+		Profile:                  "corp",
+		ProfileChanged:           true,
+		LongTermSuffix:           "long-term",
+		ShortTermSuffix:          "none",
+		CredentialsFile:          credsPath,
+		SAMLAssertionFile:        assertionPath,
+		SAMLAssertionFileChanged: true,
+		AssumeRole:               "arn:aws:iam::123456789012:role/other",
+		AssumeRoleChanged:        true,
+	}}, deps)
+	if err == nil || !strings.Contains(err.Error(), "not offered") {
+		t.Fatalf("expected an error for a role the assertion does not offer, got %v", err)
+	}
+	if fake.calls != 0 {
+		t.Fatalf("expected no STS calls, got %d", fake.calls)
+	}
+}
+
+func TestRun_SAMLModeStdinNeedsRoleWhenSeveralOffered(t *testing.T) {
+	credsPath := filepath.Join(t.TempDir(), "credentials")
+	assertion := base64.StdEncoding.EncodeToString([]byte(samlResponse))
+
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+	fake := &fakeSTS{roleOut: awssts.AssumeRoleOutput{
+		AccessKeyID: "ASIA_SAML", SecretAccessKey: "SECRET", SessionToken: "TOKEN",
+		Expiration: now.Add(time.Hour),
+	}}
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1"}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = ioDiscard{}
+	deps.Stdin = strings.NewReader(assertion + "\n")
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+
+	in := RunInputs{Inputs: Inputs{
+		Profile:                  "corp",
+		ProfileChanged:           true,
+		LongTermSuffix:           "long-term",
+		ShortTermSuffix:          "none",
+		CredentialsFile:          credsPath,
+		SAMLAssertionFile:        "-",
+		SAMLAssertionFileChanged: true,
+	}}
+	err := Run(context.Background(), in, deps)
+	if err == nil || !strings.Contains(err.Error(), "set --assume-role") || ExitCode(err) != ExitConfig {
+		t.Fatalf("expected a config error asking for --assume-role, got %v", err)
+	}
+	if fake.calls != 0 {
+		t.Fatalf("expected no STS calls, got %d", fake.calls)
+	}
+
+	deps.Stdin = strings.NewReader(assertion + "\n")
+	in.AssumeRole, in.AssumeRoleChanged = "arn:aws:iam::123456789012:role/dev", true
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run with --assume-role: %v", err)
+	}
+	if len(fake.gotSAML) != 1 || fake.gotSAML[0].RoleARN != "arn:aws:iam::123456789012:role/dev" {
+		t.Fatalf("expected the configured role to be assumed, got %+v", fake.gotSAML)
+	}
+}
+
+func TestRun_SAMLModeHelperWithoutRunnerIsAConfigError(t *testing.T) {
+	fake := &fakeSTS{}
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1"}
+	deps.Helper = nil
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return fake, nil
+	}
+
+	err := Run(context.Background(), RunInputs{Inputs: Inputs{
+		Profile:           "corp",
+		ProfileChanged:    true,
+		LongTermSuffix:    "long-term",
+		ShortTermSuffix:   "none",
+		CredentialsFile:   filepath.Join(t.TempDir(), "credentials"),
+		SAMLHelper:        "saml2aws login --skip-prompt",
+		SAMLHelperChanged: true,
+	}}, deps)
+	if err == nil || !strings.Contains(err.Error(), "saml_helper") || ExitCode(err) != ExitConfig {
+		t.Fatalf("expected a config error for the missing helper runner, got %v", err)
+	}
+	if fake.calls != 0 {
+		t.Fatalf("expected no STS calls, got %d", fake.calls)
+	}
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/sso"
+)
+
+// SSOSettings configure sso mode (IAM Identity Center).
+type SSOSettings struct {
+	StartURL  string
+	Region    string
+	AccountID string
+	RoleName  string
+
+	// OIDCEndpointURL and PortalEndpointURL override the service endpoints.
+	OIDCEndpointURL   string
+	PortalEndpointURL string
+}
+
+const (
+	// ssoCacheDir is the token cache of the AWS CLI, shared with it.
+	ssoCacheDir = "~/.aws/sso/cache"
+	// ssoClientName is the name the OIDC client registers with.
+	ssoClientName = "aws-mfa-go"
+	// ssoExpiryMargin renews cached tokens and registrations shortly before
+	// they expire, so they do not expire mid-run.
+	ssoExpiryMargin = time.Minute
+)
+
+// newSSOSession obtains role credentials from IAM Identity Center.
+//
+// The access token is taken from the AWS CLI's SSO token cache when still
+// valid; otherwise it is refreshed, or obtained with a device login in the
+// browser, and written back to the cache.
+func newSSOSession(ctx context.Context, deps Deps, opts awssts.Options, resolved Resolved) (issuedCredentials, error) {
+	httpClient, err := awssts.NewHTTPClient(opts)
+	if err != nil {
+		return issuedCredentials{}, configError(err)
+	}
+	if opts.Timeout > 0 {
+		httpClient = httpClient.WithTimeout(opts.Timeout)
+	}
+	s := resolved.SSO
+	client := sso.NewClient(sso.Options{
+		Region:            s.Region,
+		OIDCEndpointURL:   s.OIDCEndpointURL,
+		PortalEndpointURL: s.PortalEndpointURL,
+		HTTPClient:        httpClient,
+		Sleep:             deps.Sleep,
+	})
+	cachePath := sso.CacheFile(ExpandHome(ssoCacheDir), s.StartURL)
+
+	cached, _ := sso.LoadToken(cachePath) // a missing or unreadable cache means a new login
+	accessToken := ""
+	fromCache := cached.StartURL == s.StartURL && cached.AccessToken != "" && ssoValid(cached.ExpiresAt, deps.Now())
+	if fromCache {
+		accessToken = cached.AccessToken
+	} else if accessToken, err = ssoLogin(ctx, deps, client, cachePath, s, cached); err != nil {
+		return issuedCredentials{}, err
+	}
+
+	creds, err := client.RoleCredentials(ctx, accessToken, s.AccountID, s.RoleName)
+	if errors.Is(err, sso.ErrUnauthorized) && fromCache {
+		// The cached token was revoked before it expired.
+		_, _ = fmt.Fprintln(deps.Stdout, "🔁 Cached SSO login was rejected, logging in again.")
+		if accessToken, err = ssoLogin(ctx, deps, client, cachePath, s, sso.CachedToken{}); err != nil {
+			return issuedCredentials{}, err
+		}
+		creds, err = client.RoleCredentials(ctx, accessToken, s.AccountID, s.RoleName)
+	}
+	if err != nil {
+		return issuedCredentials{}, err
+	}
+	return issuedCredentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Expiration:      creds.Expiration,
+	}, nil
+}
+
+// ssoLogin obtains a new access token, with the cached refresh token if
+// possible and with a device login otherwise, and caches it.
+func ssoLogin(ctx context.Context, deps Deps, client *sso.Client, cachePath string, s SSOSettings, cached sso.CachedToken) (string, error) {
+	now := deps.Now
+	reg := sso.Registration{ClientID: cached.ClientID, ClientSecret: cached.ClientSecret}
+	registered := reg.ClientID != "" && reg.ClientSecret != "" && ssoValid(cached.RegistrationExpiresAt, now())
+	if registered {
+		reg.ExpiresAt, _ = sso.ParseTime(cached.RegistrationExpiresAt)
+	}
+
+	var tok sso.AccessToken
+	if registered && cached.RefreshToken != "" && cached.StartURL == s.StartURL {
+		var err error
+		if tok, err = client.Refresh(ctx, reg, cached.RefreshToken, now); err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			tok = sso.AccessToken{}
+		}
+	}
+
+	if tok.AccessToken == "" {
+		var err error
+		if !registered {
+			if reg, err = client.Register(ctx, ssoClientName); err != nil {
+				return "", err
+			}
+		}
+		da, err := client.StartDeviceAuthorization(ctx, reg, s.StartURL)
+		if err != nil {
+			return "", err
+		}
+		link := da.VerificationURIComplete
+		if link == "" {
+			link = da.VerificationURI
+		}
+		_, _ = fmt.Fprintf(deps.Stdout, "🌐 To sign in, open %s and confirm the code: %s\n", link, da.UserCode)
+		if deps.OpenBrowser != nil {
+			_ = deps.OpenBrowser(link)
+		}
+		if tok, err = client.PollToken(ctx, reg, da, now); err != nil {
+			return "", err
+		}
+	}
+
+	err := sso.SaveToken(cachePath, sso.CachedToken{
+		StartURL:              s.StartURL,
+		Region:                s.Region,
+		AccessToken:           tok.AccessToken,
+		ExpiresAt:             sso.FormatTime(tok.ExpiresAt),
+		RefreshToken:          tok.RefreshToken,
+		ClientID:              reg.ClientID,
+		ClientSecret:          reg.ClientSecret,
+		RegistrationExpiresAt: sso.FormatTime(reg.ExpiresAt),
+	})
+	if err != nil {
+		return "", err
+	}
+	return tok.AccessToken, nil
+}
+
+// ssoValid reports whether a cache timestamp is far enough in the future.
+func ssoValid(expiresAt string, now time.Time) bool {
+	t, err := sso.ParseTime(expiresAt)
+	return err == nil && t.After(now.Add(ssoExpiryMargin))
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+	"github.com/jlis/aws-mfa-go/internal/sso"
+)
+
+func TestRun_SSOModeSharesAWSCLITokenCache(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	const startURL = "https://corp.awsapps.com/start"
+
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		var body any
+		switch r.URL.Path {
+		case "/client/register":
+			body = map[string]any{"clientId": "CID", "clientSecret": "SECRET", "clientSecretExpiresAt": now.Add(90 * 24 * time.Hour).Unix()}
+		case "/device_authorization":
+			body = map[string]any{"deviceCode": "DEV", "userCode": "ABCD", "verificationUri": "https://device.sso", "interval": 1}
+		case "/token":
+			body = map[string]any{"accessToken": "AT_NEW", "refreshToken": "RT", "expiresIn": 28800}
+		case "/federation/credentials":
+			body = map[string]any{"roleCredentials": map[string]any{
+				"accessKeyId": "ASIA_" + r.Header.Get("X-Amz-Sso_bearer_token"), "secretAccessKey": "S", "sessionToken": "T",
+				"expiration": now.Add(time.Hour).UnixMilli(),
+			}}
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	defer srv.Close()
+
+	// A token from `aws sso login` is reused as is.
+	cachePath := sso.CacheFile(filepath.Join(home, ".aws", "sso", "cache"), startURL)
+	if err := sso.SaveToken(cachePath, sso.CachedToken{
+		StartURL: startURL, Region: "eu-west-1", AccessToken: "AT_CLI", ExpiresAt: sso.FormatTime(now.Add(4 * time.Hour)),
+	}); err != nil {
+		t.Fatalf("SaveToken: %v", err)
+	}
+
+	credsPath := filepath.Join(home, "credentials")
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store.Set("corp-long-term", "sso_start_url", startURL)
+	store.Set("corp-long-term", "sso_region", "eu-west-1")
+	store.Set("corp-long-term", "sso_account_id", "123456789012")
+	store.Set("corp-long-term", "sso_role_name", "Developer")
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	var opened []string
+	deps := DefaultDeps()
+	deps.Env = mapEnv{"AWS_REGION": "us-east-1", "AWS_ENDPOINT_URL": srv.URL}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = ioDiscard{}
+	deps.Sleep = func(context.Context, time.Duration) error { return nil }
+	deps.OpenBrowser = func(u string) error {
+		opened = append(opened, u)
+		return nil
+	}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		return &fakeSTS{}, nil
+	}
+	in := RunInputs{Inputs: Inputs{
+		Profile:         "corp",
+		ProfileChanged:  true,
+		LongTermSuffix:  "long-term",
+		ShortTermSuffix: "none",
+		CredentialsFile: credsPath,
+	}}
+
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(paths) != 1 || len(opened) != 0 {
+		t.Fatalf("expected only a role credentials call, got %v (opened %v)", paths, opened)
+	}
+	updated, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	for k, want := range map[string]string{
+		"aws_access_key_id": "ASIA_AT_CLI",
+		"mode":              ModeSSO,
+		"sso_account_id":    "123456789012",
+		"sso_role_name":     "Developer",
+		"expiration":        "2026-02-09 12:00:00",
+	} {
+		if v, _ := updated.Get("corp", k); v != want {
+			t.Fatalf("expected %s=%q, got %q", k, want, v)
+		}
+	}
+
+	// Once the cached token expired, a device login renews it and the cache.
+	now = now.Add(5 * time.Hour)
+	paths = nil
+	if err := Run(context.Background(), in, deps); err != nil {
+		t.Fatalf("Run (login): %v", err)
+	}
+	if len(opened) != 1 || opened[0] != "https://device.sso" {
+		t.Fatalf("expected a browser login, got %v", opened)
+	}
+	updated, err = credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load updated: %v", err)
+	}
+	if got, _ := updated.Get("corp", "aws_access_key_id"); got != "ASIA_AT_NEW" {
+		t.Fatalf("expected credentials from the new token, got %q", got)
+	}
+	cached, err := sso.LoadToken(cachePath)
+	if err != nil {
+		t.Fatalf("LoadToken: %v", err)
+	}
+	if cached.AccessToken != "AT_NEW" || cached.RefreshToken != "RT" || cached.ClientID != "CID" || cached.StartURL != startURL {
+		t.Fatalf("unexpected cache entry: %+v", cached)
+	}
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+)
+
+// parseTags parses Key=Value session tags, one per item.
+func parseTags(items []string) ([]awssts.Tag, error) {
+	var tags []awssts.Tag
+	for _, item := range items {
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid session tag %q: expected Key=Value", item)
+		}
+		if hasTag(tags, key) {
+			return nil, fmt.Errorf("duplicate session tag %q", key)
+		}
+		tags = append(tags, awssts.Tag{Key: key, Value: strings.TrimSpace(value)})
+	}
+	return tags, nil
+}
+
+// hasTag reports whether tags contains key. Like STS, keys are case-insensitive.
+func hasTag(tags []awssts.Tag, key string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatTags returns the canonical (sorted) representation stored in the
+// short-term section, so that DecideRefresh can detect configuration changes.
+func formatTags(tags []awssts.Tag) string {
+	items := make([]string, 0, len(tags))
+	for _, t := range tags {
+		items = append(items, t.Key+"="+t.Value)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// formatKeys returns the canonical (sorted) representation of a key list.
+func formatKeys(keys []string) string {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// expandTemplates replaces template placeholders in session tag values and
+// the source identity:
+//
+// - {{username}}: the local username (USER, or USERNAME on Windows)
+// - {{git_email}}: the output of `git config user.email`
+func expandTemplates(ctx context.Context, resolved *Resolved, deps Deps) error {
+	values := map[string]func() (string, error){
+		"{{username}}": func() (string, error) {
+			if v := strings.TrimSpace(deps.Env.Get("USER")); v != "" {
+				return v, nil
+			}
+			if v := strings.TrimSpace(deps.Env.Get("USERNAME")); v != "" {
+				return v, nil
+			}
+			return "", fmt.Errorf("cannot expand {{username}}: USER is not set")
+		},
+		"{{git_email}}": func() (string, error) {
+			if deps.GitEmail == nil {
+				return "", fmt.Errorf("cannot expand {{git_email}}: git is not available")
+			}
+			v, err := deps.GitEmail(ctx)
+			if err != nil {
+				return "", fmt.Errorf("cannot expand {{git_email}}: %w", err)
+			}
+			return v, nil
+		},
+	}
+
+	expand := func(s string) (string, error) {
+		for placeholder, value := range values {
+			if !strings.Contains(s, placeholder) {
+				continue
+			}
+			v, err := value()
+			if err != nil {
+				return "", err
+			}
+			s = strings.ReplaceAll(s, placeholder, v)
+		}
+		return s, nil
+	}
+
+	for i, t := range resolved.SessionTags {
+		v, err := expand(t.Value)
+		if err != nil {
+			return err
+		}
+		resolved.SessionTags[i].Value = v
+	}
+	v, err := expand(resolved.SourceIdentity)
+	if err != nil {
+		return err
+	}
+	resolved.SourceIdentity = v
+	return nil
+}
+
+// gitEmail reads the git user.email setting of the current directory.
+func gitEmail(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", "config", "--get", "user.email").Output()
+	if err != nil {
+		return "", fmt.Errorf("git config user.email: %w", err)
+	}
+	v := strings.TrimSpace(string(out))
+	if v == "" {
+		return "", fmt.Errorf("git config user.email is empty")
+	}
+	return v, nil
+}
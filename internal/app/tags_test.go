@@ -0,0 +1,53 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+)
+
+func TestParseTags(t *testing.T) {
+	got, err := parseTags(splitList("team=platform, cost-center = 42 ,empty="))
+	if err != nil {
+		t.Fatalf("parseTags: %v", err)
+	}
+	want := []awssts.Tag{{Key: "team", Value: "platform"}, {Key: "cost-center", Value: "42"}, {Key: "empty", Value: ""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if formatTags(got) != "cost-center=42,empty=,team=platform" {
+		t.Fatalf("unexpected canonical form %q", formatTags(got))
+	}
+
+	for _, bad := range []string{"novalue", "=value", "team=a,Team=b"} {
+		if _, err := parseTags(splitList(bad)); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestExpandTemplates(t *testing.T) {
+	resolved := Resolved{
+		SessionTags:    []awssts.Tag{{Key: "user", Value: "{{username}}"}, {Key: "email", Value: "{{git_email}}"}},
+		SourceIdentity: "{{username}}",
+	}
+	deps := Deps{
+		Env:      mapEnv{"USER": "jane"},
+		GitEmail: func(ctx context.Context) (string, error) { return "jane@example.com", nil },
+	}
+	if err := expandTemplates(context.Background(), &resolved, deps); err != nil {
+		t.Fatalf("expandTemplates: %v", err)
+	}
+	if resolved.SessionTags[0].Value != "jane" || resolved.SessionTags[1].Value != "jane@example.com" || resolved.SourceIdentity != "jane" {
+		t.Fatalf("unexpected expansion: %+v", resolved)
+	}
+
+	resolved = Resolved{SourceIdentity: "{{git_email}}"}
+	deps.GitEmail = func(ctx context.Context) (string, error) { return "", errors.New("not a git repository") }
+	if err := expandTemplates(context.Background(), &resolved, deps); err == nil {
+		t.Fatalf("expected error when git email is unavailable")
+	}
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+)
+
+// newWebIdentitySession exchanges the OIDC token in the web identity token
+// file for role credentials. The call is unsigned, so no keys are needed.
+func newWebIdentitySession(ctx context.Context, deps Deps, opts awssts.Options, resolved Resolved) (issuedCredentials, error) {
+	raw, err := os.ReadFile(ExpandHome(resolved.WebIdentityTokenFile)) //nolint:gosec // G304: path is user-provided configuration
+	if err != nil {
+		return issuedCredentials{}, configError(fmt.Errorf("read web identity token: %w", err))
+	}
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return issuedCredentials{}, configError(fmt.Errorf("web identity token file %s is empty", resolved.WebIdentityTokenFile))
+	}
+
+	stsClient, err := deps.STSFactory(ctx, opts, awssts.Credentials{})
+	if err != nil {
+		return issuedCredentials{}, err
+	}
+
+	out, err := stsClient.AssumeRoleWithWebIdentity(ctx, awssts.AssumeRoleWithWebIdentityInput{
+		RoleARN:          resolved.RoleARN,
+		RoleSessionName:  resolved.RoleSessionName,
+		WebIdentityToken: token,
+		DurationSeconds:  resolved.DurationSeconds,
+		Policy:           resolved.Policy,
+		PolicyARNs:       resolved.PolicyARNs,
+	})
+	if err != nil {
+		return issuedCredentials{}, err
+	}
+	return issuedCredentials{
+		AccessKeyID:     out.AccessKeyID,
+		SecretAccessKey: out.SecretAccessKey,
+		SessionToken:    out.SessionToken,
+		Expiration:      out.Expiration,
+	}, nil
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+type WhoamiInputs struct {
+	// Only the profile, suffix and credentials file fields are used.
+	Inputs
+	// Region is optional; if empty, we will fall back to env, the region key
+	// in the long-term section, then the default region of the partition.
+	Region string
+	JSON   bool
+}
+
+// WhoamiResult is printed by Whoami (as JSON with --json).
+type WhoamiResult struct {
+	Profile string `json:"profile"`
+	Section string `json:"section"`
+	Account string `json:"account"`
+	ARN     string `json:"arn"`
+	UserID  string `json:"user_id"`
+	// Expiration and RemainingSeconds are omitted when the section has no
+	// (valid) expiration, for example for long-term keys.
+	Expiration       string `json:"expiration,omitempty"`
+	RemainingSeconds *int64 `json:"remaining_seconds,omitempty"`
+}
+
+// Whoami calls GetCallerIdentity with the short-term credentials of a profile
+// and prints the account, ARN, user ID and remaining lifetime.
+func Whoami(ctx context.Context, in WhoamiInputs, deps Deps) error {
+	if deps.Now == nil || deps.Env == nil || deps.STSFactory == nil {
+		return errors.New("missing required dependencies")
+	}
+	if deps.Stdout == nil {
+		deps.Stdout = io.Discard
+	}
+
+	c, err := newShortTermClient(ctx, in.Inputs, in.Region, deps)
+	if err != nil {
+		return err
+	}
+	id, err := c.STS.GetCallerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	res := WhoamiResult{
+		Profile: c.Profile,
+		Section: c.Names.ShortTerm,
+		Account: id.Account,
+		ARN:     id.ARN,
+		UserID:  id.UserID,
+	}
+	if v, ok := c.Store.Get(c.Names.ShortTerm, "expiration"); ok {
+		if exp, err := ParseExpiration(v); err == nil {
+			remaining := int64(exp.Sub(deps.Now().UTC()).Seconds())
+			res.Expiration = exp.Format(time.RFC3339)
+			res.RemainingSeconds = &remaining
+		}
+	}
+
+	if in.JSON {
+		enc := json.NewEncoder(deps.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+
+	_, _ = fmt.Fprintf(deps.Stdout, "👤 Profile:  %s [%s]\n", res.Profile, res.Section)
+	_, _ = fmt.Fprintf(deps.Stdout, "🏢 Account:  %s\n", res.Account)
+	_, _ = fmt.Fprintf(deps.Stdout, "🔖 ARN:      %s\n", res.ARN)
+	_, _ = fmt.Fprintf(deps.Stdout, "🆔 User ID:  %s\n", res.UserID)
+	switch {
+	case res.RemainingSeconds == nil:
+		_, _ = fmt.Fprintln(deps.Stdout, "⏳ Expires:  never (no expiration recorded)")
+	case *res.RemainingSeconds <= 0:
+		_, _ = fmt.Fprintf(deps.Stdout, "⏳ Expires:  %s (expired)\n", res.Expiration)
+	default:
+		_, _ = fmt.Fprintf(deps.Stdout, "⏳ Expires:  %s (in %s)\n", res.Expiration, time.Duration(*res.RemainingSeconds)*time.Second)
+	}
+	return nil
+}
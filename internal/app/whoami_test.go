@@ -0,0 +1,97 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+	"github.com/jlis/aws-mfa-go/internal/credentials"
+)
+
+func TestWhoami_PrintsIdentityAndRemainingLifetime(t *testing.T) {
+	dir := t.TempDir()
+	credsPath := filepath.Join(dir, "credentials")
+
+	store, err := credentials.Load(credsPath)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	now := time.Date(2026, 2, 9, 10, 0, 0, 0, time.UTC)
+	store.Set("prod", "aws_access_key_id", "ASIA_ST")
+	store.Set("prod", "aws_secret_access_key", "SECRET_ST")
+	store.Set("prod", "aws_session_token", "TOKEN_ST")
+	store.Set("prod", "expiration", now.Add(90*time.Minute).Format(expirationLayout))
+	if err := store.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	fake := &fakeSTS{identity: awssts.CallerIdentity{
+		Account: "123456789012",
+		ARN:     "arn:aws:sts::123456789012:assumed-role/admin/me",
+		UserID:  "AROAEXAMPLE:me",
+	}}
+	var gotCreds awssts.Credentials
+	var stdout bytes.Buffer
+	deps := DefaultDeps()
+	deps.Env = mapEnv{}
+	deps.Now = func() time.Time { return now }
+	deps.Stdout = &stdout
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		gotCreds = creds
+		return fake, nil
+	}
+
+	in := WhoamiInputs{Inputs: Inputs{
+		Profile:         "prod",
+		ProfileChanged:  true,
+		LongTermSuffix:  "long-term",
+		ShortTermSuffix: "none",
+		CredentialsFile: credsPath,
+	}}
+	if err := Whoami(context.Background(), in, deps); err != nil {
+		t.Fatalf("Whoami: %v", err)
+	}
+	if gotCreds.SessionToken != "TOKEN_ST" {
+		t.Fatalf("expected short-term credentials to be used, got %+v", gotCreds)
+	}
+	for _, want := range []string{"123456789012", "assumed-role/admin/me", "AROAEXAMPLE:me", "in 1h30m0s"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	in.JSON = true
+	if err := Whoami(context.Background(), in, deps); err != nil {
+		t.Fatalf("Whoami (json): %v", err)
+	}
+	var res WhoamiResult
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		t.Fatalf("Unmarshal: %v\n%s", err, stdout.String())
+	}
+	if res.Account != "123456789012" || res.RemainingSeconds == nil || *res.RemainingSeconds != 5400 {
+		t.Fatalf("unexpected JSON result: %+v", res)
+	}
+}
+
+func TestWhoami_MissingSection(t *testing.T) {
+	deps := DefaultDeps()
+	deps.Env = mapEnv{}
+	deps.STSFactory = func(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (awssts.Client, error) {
+		t.Fatalf("STS should not be called")
+		return nil, nil
+	}
+	err := Whoami(context.Background(), WhoamiInputs{Inputs: Inputs{
+		Profile:         "prod",
+		ProfileChanged:  true,
+		CredentialsFile: filepath.Join(t.TempDir(), "credentials"),
+	}}, deps)
+	if err == nil {
+		t.Fatalf("expected error for a missing section")
+	}
+}
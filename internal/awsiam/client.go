@@ -0,0 +1,583 @@
+// Package awsiam is the IAM counterpart of awssts: a small client interface
+// for the IAM calls we make with an IAM user's long-term keys.
+package awsiam
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+)
+
+// Client is the minimal interface we need from IAM.
+type Client interface {
+	// ListMFADevices lists the MFA devices of the calling IAM user.
+	ListMFADevices(ctx context.Context) ([]MFADevice, error)
+	// ResyncMFADevice resynchronizes a drifted device with two consecutive codes.
+	ResyncMFADevice(ctx context.Context, in ResyncMFADeviceInput) error
+	// DeactivateMFADevice removes a device from a user.
+	DeactivateMFADevice(ctx context.Context, userName, serialNumber string) error
+
+	// GetUser returns the calling IAM user.
+	GetUser(ctx context.Context) (User, error)
+	// CreateVirtualMFADevice creates a virtual device that is not yet
+	// assigned to a user; EnableMFADevice assigns it.
+	CreateVirtualMFADevice(ctx context.Context, name string) (VirtualMFADevice, error)
+	EnableMFADevice(ctx context.Context, in EnableMFADeviceInput) error
+	// DeleteVirtualMFADevice deletes a virtual device that is not assigned.
+	DeleteVirtualMFADevice(ctx context.Context, serialNumber string) error
+
+	// ListAccessKeys lists the access keys of the calling IAM user.
+	ListAccessKeys(ctx context.Context) ([]AccessKey, error)
+	// CreateAccessKey creates an access key for the calling IAM user.
+	CreateAccessKey(ctx context.Context) (NewAccessKey, error)
+	// UpdateAccessKey sets the status of an access key: StatusActive or
+	// StatusInactive.
+	UpdateAccessKey(ctx context.Context, accessKeyID, status string) error
+	DeleteAccessKey(ctx context.Context, accessKeyID string) error
+	// GetAccessKeyLastUsed returns when and where an access key was last
+	// used; LastUsed is zero if it never was.
+	GetAccessKeyLastUsed(ctx context.Context, accessKeyID string) (AccessKeyLastUsed, error)
+	// ListAttachedUserPolicies lists the managed policies attached to a user.
+	ListAttachedUserPolicies(ctx context.Context, userName string) ([]AttachedPolicy, error)
+
+	// GetRole returns a role of the caller's account by name.
+	GetRole(ctx context.Context, name string) (Role, error)
+
+	// ListUserPolicies lists the names of a user's inline policies.
+	ListUserPolicies(ctx context.Context, userName string) ([]string, error)
+	// GetUserPolicy returns the document of a user's inline policy.
+	GetUserPolicy(ctx context.Context, userName, policyName string) (string, error)
+	// ListGroupsForUser lists the names of the groups a user belongs to.
+	ListGroupsForUser(ctx context.Context, userName string) ([]string, error)
+	ListAttachedGroupPolicies(ctx context.Context, groupName string) ([]AttachedPolicy, error)
+	// ListGroupPolicies lists the names of a group's inline policies.
+	ListGroupPolicies(ctx context.Context, groupName string) ([]string, error)
+	// GetGroupPolicy returns the document of a group's inline policy.
+	GetGroupPolicy(ctx context.Context, groupName, policyName string) (string, error)
+	// GetPolicyDocument returns the document of the default version of a
+	// managed policy.
+	GetPolicyDocument(ctx context.Context, policyARN string) (string, error)
+}
+
+// Role is an IAM role.
+type Role struct {
+	RoleName string
+	ARN      string
+	// MaxSessionDuration is the longest session, in seconds, AssumeRole
+	// grants for the role.
+	MaxSessionDuration int32
+}
+
+type AccessKeyLastUsed struct {
+	LastUsed    time.Time
+	ServiceName string
+	Region      string
+}
+
+// AttachedPolicy is a managed policy attached to a user.
+type AttachedPolicy struct {
+	PolicyName string
+	PolicyARN  string
+}
+
+// Access key statuses.
+const (
+	StatusActive   = "Active"
+	StatusInactive = "Inactive"
+)
+
+// AccessKey describes an access key, without its secret.
+type AccessKey struct {
+	AccessKeyID string
+	Status      string
+	CreateDate  time.Time
+}
+
+// NewAccessKey is a newly created access key. The secret is only returned
+// on creation.
+type NewAccessKey struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	CreateDate      time.Time
+}
+
+// User is an IAM user.
+type User struct {
+	UserName string
+	ARN      string
+}
+
+// VirtualMFADevice is a newly created virtual MFA device.
+type VirtualMFADevice struct {
+	SerialNumber string
+	// Base32StringSeed is the TOTP secret, base32-encoded as authenticator
+	// apps expect it. It is only returned on creation.
+	Base32StringSeed string
+}
+
+type ResyncMFADeviceInput struct {
+	UserName            string
+	SerialNumber        string
+	AuthenticationCode1 string
+	AuthenticationCode2 string
+}
+
+type EnableMFADeviceInput struct {
+	UserName            string
+	SerialNumber        string
+	AuthenticationCode1 string
+	AuthenticationCode2 string
+}
+
+// MFADevice is an MFA device assigned to an IAM user.
+type MFADevice struct {
+	// SerialNumber is the device ARN for virtual and FIDO devices, or the
+	// serial number of a hardware device.
+	SerialNumber string
+	UserName     string
+	EnableDate   time.Time
+}
+
+// RealClient calls AWS IAM using AWS SDK for Go v2.
+// Failed calls return an *awssts.Error with Service "iam".
+type RealClient struct {
+	api     *iam.Client
+	timeout time.Duration
+}
+
+var _ Client = (*RealClient)(nil)
+
+// NewRealClient constructs an IAM client from the same options as an STS
+// client. IAM is a global service: the region only selects the partition.
+// RegionalEndpoints is ignored.
+func NewRealClient(ctx context.Context, opts awssts.Options, creds awssts.Credentials) (*RealClient, error) {
+	if opts.Region == "" {
+		return nil, fmt.Errorf("region is empty")
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("access key id/secret access key must both be set")
+	}
+
+	httpClient, err := awssts.NewHTTPClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := aws.Config{
+		Region:      opts.Region,
+		Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken)),
+		HTTPClient:  httpClient,
+		Retryer:     awssts.NewRetryer,
+	}
+	api := iam.NewFromConfig(cfg, func(o *iam.Options) {
+		if opts.EndpointURL != "" {
+			o.EndpointResolver = iam.EndpointResolverFromURL(opts.EndpointURL)
+			return
+		}
+		if opts.UseFIPSEndpoint {
+			o.EndpointOptions.UseFIPSEndpoint = aws.FIPSEndpointStateEnabled
+		}
+		if opts.UseDualStackEndpoint {
+			o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+		}
+	})
+	return &RealClient{api: api, timeout: opts.Timeout}, nil
+}
+
+func (c *RealClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+func (c *RealClient) ListMFADevices(ctx context.Context) ([]MFADevice, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var devices []MFADevice
+	p := iam.NewListMFADevicesPaginator(c.api, &iam.ListMFADevicesInput{})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, awssts.Classify("iam", "list-mfa-devices", err)
+		}
+		for _, d := range out.MFADevices {
+			devices = append(devices, MFADevice{
+				SerialNumber: aws.ToString(d.SerialNumber),
+				UserName:     aws.ToString(d.UserName),
+				EnableDate:   aws.ToTime(d.EnableDate).UTC(),
+			})
+		}
+	}
+	return devices, nil
+}
+
+func (c *RealClient) ResyncMFADevice(ctx context.Context, in ResyncMFADeviceInput) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	_, err := c.api.ResyncMFADevice(ctx, &iam.ResyncMFADeviceInput{
+		UserName:            aws.String(in.UserName),
+		SerialNumber:        aws.String(in.SerialNumber),
+		AuthenticationCode1: aws.String(in.AuthenticationCode1),
+		AuthenticationCode2: aws.String(in.AuthenticationCode2),
+	})
+	if err != nil {
+		return awssts.Classify("iam", "resync-mfa-device", err)
+	}
+	return nil
+}
+
+func (c *RealClient) DeactivateMFADevice(ctx context.Context, userName, serialNumber string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	_, err := c.api.DeactivateMFADevice(ctx, &iam.DeactivateMFADeviceInput{
+		UserName:     aws.String(userName),
+		SerialNumber: aws.String(serialNumber),
+	})
+	if err != nil {
+		return awssts.Classify("iam", "deactivate-mfa-device", err)
+	}
+	return nil
+}
+
+func (c *RealClient) GetUser(ctx context.Context) (User, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.GetUser(ctx, &iam.GetUserInput{})
+	if err != nil {
+		return User{}, awssts.Classify("iam", "get-user", err)
+	}
+	if out.User == nil {
+		return User{}, fmt.Errorf("iam get-user: no user in response")
+	}
+	return User{
+		UserName: aws.ToString(out.User.UserName),
+		ARN:      aws.ToString(out.User.Arn),
+	}, nil
+}
+
+func (c *RealClient) CreateVirtualMFADevice(ctx context.Context, name string) (VirtualMFADevice, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.CreateVirtualMFADevice(ctx, &iam.CreateVirtualMFADeviceInput{
+		VirtualMFADeviceName: aws.String(name),
+	})
+	if err != nil {
+		return VirtualMFADevice{}, awssts.Classify("iam", "create-virtual-mfa-device", err)
+	}
+	if out.VirtualMFADevice == nil {
+		return VirtualMFADevice{}, fmt.Errorf("iam create-virtual-mfa-device: no device in response")
+	}
+	return VirtualMFADevice{
+		SerialNumber:     aws.ToString(out.VirtualMFADevice.SerialNumber),
+		Base32StringSeed: string(out.VirtualMFADevice.Base32StringSeed),
+	}, nil
+}
+
+func (c *RealClient) EnableMFADevice(ctx context.Context, in EnableMFADeviceInput) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	_, err := c.api.EnableMFADevice(ctx, &iam.EnableMFADeviceInput{
+		UserName:            aws.String(in.UserName),
+		SerialNumber:        aws.String(in.SerialNumber),
+		AuthenticationCode1: aws.String(in.AuthenticationCode1),
+		AuthenticationCode2: aws.String(in.AuthenticationCode2),
+	})
+	if err != nil {
+		return awssts.Classify("iam", "enable-mfa-device", err)
+	}
+	return nil
+}
+
+func (c *RealClient) DeleteVirtualMFADevice(ctx context.Context, serialNumber string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	_, err := c.api.DeleteVirtualMFADevice(ctx, &iam.DeleteVirtualMFADeviceInput{
+		SerialNumber: aws.String(serialNumber),
+	})
+	if err != nil {
+		return awssts.Classify("iam", "delete-virtual-mfa-device", err)
+	}
+	return nil
+}
+
+func (c *RealClient) ListAccessKeys(ctx context.Context) ([]AccessKey, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var keys []AccessKey
+	p := iam.NewListAccessKeysPaginator(c.api, &iam.ListAccessKeysInput{})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, awssts.Classify("iam", "list-access-keys", err)
+		}
+		for _, k := range out.AccessKeyMetadata {
+			keys = append(keys, AccessKey{
+				AccessKeyID: aws.ToString(k.AccessKeyId),
+				Status:      string(k.Status),
+				CreateDate:  aws.ToTime(k.CreateDate).UTC(),
+			})
+		}
+	}
+	return keys, nil
+}
+
+func (c *RealClient) CreateAccessKey(ctx context.Context) (NewAccessKey, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.CreateAccessKey(ctx, &iam.CreateAccessKeyInput{})
+	if err != nil {
+		return NewAccessKey{}, awssts.Classify("iam", "create-access-key", err)
+	}
+	if out.AccessKey == nil {
+		return NewAccessKey{}, fmt.Errorf("iam create-access-key: no access key in response")
+	}
+	return NewAccessKey{
+		AccessKeyID:     aws.ToString(out.AccessKey.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.AccessKey.SecretAccessKey),
+		CreateDate:      aws.ToTime(out.AccessKey.CreateDate).UTC(),
+	}, nil
+}
+
+func (c *RealClient) UpdateAccessKey(ctx context.Context, accessKeyID, status string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	_, err := c.api.UpdateAccessKey(ctx, &iam.UpdateAccessKeyInput{
+		AccessKeyId: aws.String(accessKeyID),
+		Status:      types.StatusType(status),
+	})
+	if err != nil {
+		return awssts.Classify("iam", "update-access-key", err)
+	}
+	return nil
+}
+
+func (c *RealClient) DeleteAccessKey(ctx context.Context, accessKeyID string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	_, err := c.api.DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{
+		AccessKeyId: aws.String(accessKeyID),
+	})
+	if err != nil {
+		return awssts.Classify("iam", "delete-access-key", err)
+	}
+	return nil
+}
+
+func (c *RealClient) GetAccessKeyLastUsed(ctx context.Context, accessKeyID string) (AccessKeyLastUsed, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.GetAccessKeyLastUsed(ctx, &iam.GetAccessKeyLastUsedInput{
+		AccessKeyId: aws.String(accessKeyID),
+	})
+	if err != nil {
+		return AccessKeyLastUsed{}, awssts.Classify("iam", "get-access-key-last-used", err)
+	}
+	if out.AccessKeyLastUsed == nil {
+		return AccessKeyLastUsed{}, nil
+	}
+	used := AccessKeyLastUsed{
+		ServiceName: aws.ToString(out.AccessKeyLastUsed.ServiceName),
+		Region:      aws.ToString(out.AccessKeyLastUsed.Region),
+	}
+	if out.AccessKeyLastUsed.LastUsedDate != nil {
+		used.LastUsed = out.AccessKeyLastUsed.LastUsedDate.UTC()
+	}
+	return used, nil
+}
+
+func (c *RealClient) ListAttachedUserPolicies(ctx context.Context, userName string) ([]AttachedPolicy, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var policies []AttachedPolicy
+	p := iam.NewListAttachedUserPoliciesPaginator(c.api, &iam.ListAttachedUserPoliciesInput{
+		UserName: aws.String(userName),
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, awssts.Classify("iam", "list-attached-user-policies", err)
+		}
+		for _, a := range out.AttachedPolicies {
+			policies = append(policies, AttachedPolicy{
+				PolicyName: aws.ToString(a.PolicyName),
+				PolicyARN:  aws.ToString(a.PolicyArn),
+			})
+		}
+	}
+	return policies, nil
+}
+
+func (c *RealClient) GetRole(ctx context.Context, name string) (Role, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(name)})
+	if err != nil {
+		return Role{}, awssts.Classify("iam", "get-role", err)
+	}
+	if out.Role == nil {
+		return Role{}, fmt.Errorf("iam get-role: no role in response")
+	}
+	return Role{
+		RoleName:           aws.ToString(out.Role.RoleName),
+		ARN:                aws.ToString(out.Role.Arn),
+		MaxSessionDuration: aws.ToInt32(out.Role.MaxSessionDuration),
+	}, nil
+}
+
+func (c *RealClient) ListUserPolicies(ctx context.Context, userName string) ([]string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var names []string
+	p := iam.NewListUserPoliciesPaginator(c.api, &iam.ListUserPoliciesInput{UserName: aws.String(userName)})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, awssts.Classify("iam", "list-user-policies", err)
+		}
+		names = append(names, out.PolicyNames...)
+	}
+	return names, nil
+}
+
+func (c *RealClient) GetUserPolicy(ctx context.Context, userName, policyName string) (string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.GetUserPolicy(ctx, &iam.GetUserPolicyInput{
+		UserName:   aws.String(userName),
+		PolicyName: aws.String(policyName),
+	})
+	if err != nil {
+		return "", awssts.Classify("iam", "get-user-policy", err)
+	}
+	return decodeDocument("get-user-policy", aws.ToString(out.PolicyDocument))
+}
+
+func (c *RealClient) ListGroupsForUser(ctx context.Context, userName string) ([]string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var names []string
+	p := iam.NewListGroupsForUserPaginator(c.api, &iam.ListGroupsForUserInput{UserName: aws.String(userName)})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, awssts.Classify("iam", "list-groups-for-user", err)
+		}
+		for _, g := range out.Groups {
+			names = append(names, aws.ToString(g.GroupName))
+		}
+	}
+	return names, nil
+}
+
+func (c *RealClient) ListAttachedGroupPolicies(ctx context.Context, groupName string) ([]AttachedPolicy, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var policies []AttachedPolicy
+	p := iam.NewListAttachedGroupPoliciesPaginator(c.api, &iam.ListAttachedGroupPoliciesInput{
+		GroupName: aws.String(groupName),
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, awssts.Classify("iam", "list-attached-group-policies", err)
+		}
+		for _, a := range out.AttachedPolicies {
+			policies = append(policies, AttachedPolicy{
+				PolicyName: aws.ToString(a.PolicyName),
+				PolicyARN:  aws.ToString(a.PolicyArn),
+			})
+		}
+	}
+	return policies, nil
+}
+
+func (c *RealClient) ListGroupPolicies(ctx context.Context, groupName string) ([]string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var names []string
+	p := iam.NewListGroupPoliciesPaginator(c.api, &iam.ListGroupPoliciesInput{GroupName: aws.String(groupName)})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, awssts.Classify("iam", "list-group-policies", err)
+		}
+		names = append(names, out.PolicyNames...)
+	}
+	return names, nil
+}
+
+func (c *RealClient) GetGroupPolicy(ctx context.Context, groupName, policyName string) (string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.GetGroupPolicy(ctx, &iam.GetGroupPolicyInput{
+		GroupName:  aws.String(groupName),
+		PolicyName: aws.String(policyName),
+	})
+	if err != nil {
+		return "", awssts.Classify("iam", "get-group-policy", err)
+	}
+	return decodeDocument("get-group-policy", aws.ToString(out.PolicyDocument))
+}
+
+func (c *RealClient) GetPolicyDocument(ctx context.Context, policyARN string) (string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	policy, err := c.api.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: aws.String(policyARN)})
+	if err != nil {
+		return "", awssts.Classify("iam", "get-policy", err)
+	}
+	if policy.Policy == nil {
+		return "", fmt.Errorf("iam get-policy: no policy in response")
+	}
+	out, err := c.api.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+		PolicyArn: aws.String(policyARN),
+		VersionId: policy.Policy.DefaultVersionId,
+	})
+	if err != nil {
+		return "", awssts.Classify("iam", "get-policy-version", err)
+	}
+	if out.PolicyVersion == nil {
+		return "", fmt.Errorf("iam get-policy-version: no policy version in response")
+	}
+	return decodeDocument("get-policy-version", aws.ToString(out.PolicyVersion.Document))
+}
+
+// decodeDocument decodes a policy document, which IAM returns URL-encoded
+// (RFC 3986, so "+" is not a space).
+func decodeDocument(op, doc string) (string, error) {
+	decoded, err := url.PathUnescape(doc)
+	if err != nil {
+		return "", fmt.Errorf("iam %s: decode policy document: %w", op, err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,125 @@
+package awsiam
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+)
+
+func TestRealClientListMFADevicesFollowsPages(t *testing.T) {
+	var gotMarkers []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		if got := r.Form.Get("Action"); got != "ListMFADevices" {
+			t.Errorf("unexpected action %q", got)
+		}
+		gotMarkers = append(gotMarkers, r.Form.Get("Marker"))
+		w.Header().Set("Content-Type", "text/xml")
+		if r.Form.Get("Marker") == "" {
+			_, _ = w.Write([]byte(listMFADevicesResponse("arn:aws:iam::123456789012:mfa/phone", "<IsTruncated>true</IsTruncated><Marker>next</Marker>")))
+			return
+		}
+		_, _ = w.Write([]byte(listMFADevicesResponse("GAHT12345678", "<IsTruncated>false</IsTruncated>")))
+	}))
+	defer srv.Close()
+
+	c, err := NewRealClient(context.Background(), awssts.Options{Region: "us-east-1", EndpointURL: srv.URL}, awssts.Credentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewRealClient: %v", err)
+	}
+	devices, err := c.ListMFADevices(context.Background())
+	if err != nil {
+		t.Fatalf("ListMFADevices: %v", err)
+	}
+	if len(gotMarkers) != 2 || gotMarkers[1] != "next" {
+		t.Fatalf("expected two pages, got markers %q", gotMarkers)
+	}
+	if len(devices) != 2 || devices[0].SerialNumber != "arn:aws:iam::123456789012:mfa/phone" || devices[1].SerialNumber != "GAHT12345678" {
+		t.Fatalf("unexpected devices: %+v", devices)
+	}
+	if devices[0].UserName != "alice" || devices[0].EnableDate.IsZero() {
+		t.Fatalf("expected user name and enable date, got %+v", devices[0])
+	}
+}
+
+func TestRealClientClassifiesErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<ErrorResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+  <Error><Type>Sender</Type><Code>AccessDenied</Code><Message>not authorized to perform: iam:ListMFADevices</Message></Error>
+  <RequestId>test</RequestId>
+</ErrorResponse>`))
+	}))
+	defer srv.Close()
+
+	c, err := NewRealClient(context.Background(), awssts.Options{Region: "us-east-1", EndpointURL: srv.URL}, awssts.Credentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewRealClient: %v", err)
+	}
+	_, err = c.ListMFADevices(context.Background())
+	var e *awssts.Error
+	if !errors.As(err, &e) || e.Kind != awssts.KindAccessDenied || e.Service != "iam" {
+		t.Fatalf("expected an iam access denied error, got %v", err)
+	}
+}
+
+func TestRealClientGetPolicyDocumentDecodesDefaultVersion(t *testing.T) {
+	var gotVersion string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		switch r.Form.Get("Action") {
+		case "GetPolicy":
+			_, _ = w.Write([]byte(`<GetPolicyResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+  <GetPolicyResult><Policy><PolicyName>assume</PolicyName><DefaultVersionId>v3</DefaultVersionId></Policy></GetPolicyResult>
+</GetPolicyResponse>`))
+		case "GetPolicyVersion":
+			gotVersion = r.Form.Get("VersionId")
+			_, _ = w.Write([]byte(`<GetPolicyVersionResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+  <GetPolicyVersionResult><PolicyVersion><Document>%7B%22Sid%22%3A%20%22a+b%22%7D</Document></PolicyVersion></GetPolicyVersionResult>
+</GetPolicyVersionResponse>`))
+		default:
+			t.Errorf("unexpected action %q", r.Form.Get("Action"))
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewRealClient(context.Background(), awssts.Options{Region: "us-east-1", EndpointURL: srv.URL}, awssts.Credentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewRealClient: %v", err)
+	}
+	doc, err := c.GetPolicyDocument(context.Background(), "arn:aws:iam::123456789012:policy/assume")
+	if err != nil {
+		t.Fatalf("GetPolicyDocument: %v", err)
+	}
+	if gotVersion != "v3" {
+		t.Fatalf("expected the default version v3, got %q", gotVersion)
+	}
+	if doc != `{"Sid": "a+b"}` {
+		t.Fatalf("unexpected document %q", doc)
+	}
+}
+
+func listMFADevicesResponse(serial, page string) string {
+	return `<ListMFADevicesResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+  <ListMFADevicesResult>
+    <MFADevices>
+      <member>
+        <UserName>alice</UserName>
+        <SerialNumber>` + serial + `</SerialNumber>
+        <EnableDate>2025-01-02T03:04:05Z</EnableDate>
+      </member>
+    </MFADevices>
+    ` + page + `
+  </ListMFADevicesResult>
+</ListMFADevicesResponse>`
+}
@@ -3,18 +3,26 @@ package awssts
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
 )
 
 // Client is the minimal interface we need from STS.
 // Keeping it small makes unit testing easy.
 type Client interface {
 	GetSessionToken(ctx context.Context, in GetSessionTokenInput) (GetSessionTokenOutput, error)
+	AssumeRole(ctx context.Context, in AssumeRoleInput) (AssumeRoleOutput, error)
+	GetFederationToken(ctx context.Context, in GetFederationTokenInput) (GetFederationTokenOutput, error)
+	AssumeRoleWithWebIdentity(ctx context.Context, in AssumeRoleWithWebIdentityInput) (AssumeRoleOutput, error)
+	AssumeRoleWithSAML(ctx context.Context, in AssumeRoleWithSAMLInput) (AssumeRoleOutput, error)
+	GetCallerIdentity(ctx context.Context) (CallerIdentity, error)
+	DecodeAuthorizationMessage(ctx context.Context, encoded string) (string, error)
 }
 
 type GetSessionTokenInput struct {
@@ -30,42 +38,256 @@ type GetSessionTokenOutput struct {
 	Expiration      time.Time
 }
 
+// AssumeRoleInput mirrors the subset of sts.AssumeRoleInput we support.
+// SerialNumber/TokenCode are optional; when set, the call is MFA-authenticated.
+type AssumeRoleInput struct {
+	RoleARN         string
+	RoleSessionName string
+	ExternalID      string
+	SerialNumber    string
+	TokenCode       string
+	DurationSeconds int32
+
+	// Tags are session tags; keys listed in TransitiveTagKeys persist
+	// through role chaining. SourceIdentity is set once and cannot change.
+	Tags              []Tag
+	TransitiveTagKeys []string
+	SourceIdentity    string
+
+	// Policy (an inline JSON policy document) and PolicyARNs (managed
+	// policies) scope the session down; they cannot grant extra permissions.
+	Policy     string
+	PolicyARNs []string
+}
+
+// Tag is an STS session tag.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+type AssumeRoleOutput struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+
+	// AssumedRoleARN is the ARN of the assumed role session
+	// (arn:aws:sts::<account>:assumed-role/<role>/<session>).
+	AssumedRoleARN string
+}
+
+// AssumeRoleWithWebIdentityInput mirrors the subset of
+// sts.AssumeRoleWithWebIdentityInput we support. The call is not signed, so
+// the client may be created without credentials.
+type AssumeRoleWithWebIdentityInput struct {
+	RoleARN          string
+	RoleSessionName  string
+	WebIdentityToken string
+	DurationSeconds  int32
+
+	Policy     string
+	PolicyARNs []string
+}
+
+// AssumeRoleWithSAMLInput mirrors the subset of sts.AssumeRoleWithSAMLInput
+// we support. Like AssumeRoleWithWebIdentity, the call is not signed; the
+// role session name comes from the assertion.
+type AssumeRoleWithSAMLInput struct {
+	RoleARN      string
+	PrincipalARN string
+	// SAMLAssertion is the base64-encoded SAMLResponse.
+	SAMLAssertion   string
+	DurationSeconds int32
+
+	Policy     string
+	PolicyARNs []string
+}
+
+// GetFederationTokenInput mirrors the subset of sts.GetFederationTokenInput we
+// support. The call must be signed with long-term IAM user keys and does not
+// accept MFA.
+type GetFederationTokenInput struct {
+	// Name is the federated user name, shown in the resulting ARN.
+	Name            string
+	DurationSeconds int32
+
+	// Policy and PolicyARNs define the permissions of the federated session;
+	// without them the session has none.
+	Policy     string
+	PolicyARNs []string
+}
+
+type GetFederationTokenOutput struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+
+	// FederatedUserARN is arn:aws:sts::<account>:federated-user/<name>.
+	FederatedUserARN string
+}
+
+// CallerIdentity is the principal the client's credentials belong to.
+type CallerIdentity struct {
+	Account string
+	ARN     string
+	UserID  string
+}
+
+// Credentials are the AWS credentials the client signs requests with.
+// SessionToken is empty for long-term IAM user keys. The zero value creates
+// an anonymous client, for calls that are not signed.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Options configure how the client reaches STS.
+type Options struct {
+	// Region is required by the AWS SDK; STS is a global service but still
+	// expects a region to be set (we default in higher layers).
+	Region string
+
+	// EndpointURL overrides endpoint resolution entirely (for example a
+	// LocalStack-style stand-in). UseFIPSEndpoint, UseDualStackEndpoint and
+	// RegionalEndpoints are ignored when it is set.
+	EndpointURL string
+
+	UseFIPSEndpoint      bool
+	UseDualStackEndpoint bool
+
+	// RegionalEndpoints mirrors the sts_regional_endpoints setting: "regional"
+	// (the default) or "legacy", which sends requests for the regions that
+	// historically used it to the global endpoint sts.amazonaws.com.
+	RegionalEndpoints string
+
+	// Timeout bounds each STS call, including retries. Zero means no timeout.
+	Timeout time.Duration
+
+	// HTTPSProxy and HTTPProxy are the proxy URLs for https and http
+	// requests to STS, unless the endpoint host is a loopback address or
+	// matches NoProxy (a comma-separated list of hosts and domains, as in the
+	// NO_PROXY environment variable).
+	HTTPSProxy string
+	HTTPProxy  string
+	NoProxy    string
+
+	// CABundle holds PEM certificates trusted in addition to the system roots.
+	CABundle []byte
+}
+
+// maxAttempts bounds how often a throttled or transiently failing call is
+// attempted, with exponential backoff (capped at maxBackoff) in between.
+const (
+	maxAttempts = 5
+	maxBackoff  = 10 * time.Second
+)
+
+// retryBackoff overrides the retryer's backoff; tests set it to avoid sleeping.
+var retryBackoff retry.BackoffDelayer
+
+// legacyGlobalRegions are the regions that used the global STS endpoint under
+// sts_regional_endpoints = legacy.
+var legacyGlobalRegions = map[string]bool{
+	"ap-northeast-1": true, "ap-south-1": true, "ap-southeast-1": true, "ap-southeast-2": true,
+	"ca-central-1": true, "eu-central-1": true, "eu-north-1": true, "eu-west-1": true,
+	"eu-west-2": true, "eu-west-3": true, "sa-east-1": true, "us-east-1": true,
+	"us-east-2": true, "us-west-1": true, "us-west-2": true,
+}
+
+// clientOptions translates Options into STS client options.
+func clientOptions(opts Options) func(*sts.Options) {
+	return func(o *sts.Options) {
+		if opts.EndpointURL != "" {
+			o.EndpointResolver = sts.EndpointResolverFromURL(opts.EndpointURL)
+			return
+		}
+		if opts.UseFIPSEndpoint {
+			o.EndpointOptions.UseFIPSEndpoint = aws.FIPSEndpointStateEnabled
+		}
+		if opts.UseDualStackEndpoint {
+			o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+		}
+		if strings.EqualFold(opts.RegionalEndpoints, "legacy") && !opts.UseFIPSEndpoint && !opts.UseDualStackEndpoint && legacyGlobalRegions[o.Region] {
+			// The SDK resolves the pseudo region "aws-global" to
+			// sts.amazonaws.com and signs for us-east-1.
+			o.Region = "aws-global"
+		}
+	}
+}
+
 // RealClient calls AWS STS using AWS SDK for Go v2.
+// Failed calls return an *Error.
 type RealClient struct {
-	api *sts.Client
+	api     *sts.Client
+	timeout time.Duration
 }
 
+var _ Client = (*RealClient)(nil)
+
 // NewRealClient constructs an STS client that authenticates using the provided
-// long-term credentials. Region is required by the AWS SDK; STS is a global
-// service but still expects a region to be set (we default in higher layers).
-func NewRealClient(ctx context.Context, region, accessKeyID, secretAccessKey string) (*RealClient, error) {
-	if region == "" {
+// credentials: long-term keys, or temporary credentials from an earlier STS call.
+//
+// The client is built from opts alone: unlike config.LoadDefaultConfig, it
+// does not read ~/.aws/config or AWS_* environment variables.
+func NewRealClient(ctx context.Context, opts Options, creds Credentials) (*RealClient, error) {
+	if opts.Region == "" {
 		return nil, fmt.Errorf("region is empty")
 	}
-	if accessKeyID == "" || secretAccessKey == "" {
-		return nil, fmt.Errorf("access key id/secret access key must be set")
+	if (creds.AccessKeyID == "") != (creds.SecretAccessKey == "") {
+		return nil, fmt.Errorf("access key id/secret access key must both be set")
 	}
 
-	cfg, err := config.LoadDefaultConfig(
-		ctx,
-		config.WithRegion(region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, "")),
-	)
+	httpClient, err := NewHTTPClient(opts)
 	if err != nil {
-		return nil, fmt.Errorf("load aws config: %w", err)
+		return nil, err
+	}
+
+	cfg := aws.Config{
+		Region:      opts.Region,
+		Credentials: aws.AnonymousCredentials{},
+		HTTPClient:  httpClient,
+		Retryer:     NewRetryer,
 	}
+	if creds.AccessKeyID != "" {
+		cfg.Credentials = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken))
+	}
+
+	return &RealClient{api: sts.NewFromConfig(cfg, clientOptions(opts)), timeout: opts.Timeout}, nil
+}
 
-	return &RealClient{api: sts.NewFromConfig(cfg)}, nil
+// NewRetryer returns the retryer of STS clients: standard retries with
+// maxAttempts and maxBackoff.
+func NewRetryer() aws.Retryer {
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		o.MaxAttempts = maxAttempts
+		o.MaxBackoff = maxBackoff
+		if retryBackoff != nil {
+			o.Backoff = retryBackoff
+		}
+	})
+}
+
+func (c *RealClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
 }
 
 func (c *RealClient) GetSessionToken(ctx context.Context, in GetSessionTokenInput) (GetSessionTokenOutput, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	out, err := c.api.GetSessionToken(ctx, &sts.GetSessionTokenInput{
 		DurationSeconds: aws.Int32(in.DurationSeconds),
 		SerialNumber:    aws.String(in.SerialNumber),
 		TokenCode:       aws.String(in.TokenCode),
 	})
 	if err != nil {
-		return GetSessionTokenOutput{}, fmt.Errorf("sts get-session-token: %w", err)
+		return GetSessionTokenOutput{}, classify("get-session-token", err)
 	}
 	if out.Credentials == nil {
 		return GetSessionTokenOutput{}, fmt.Errorf("sts get-session-token: no credentials in response")
@@ -77,3 +299,195 @@ func (c *RealClient) GetSessionToken(ctx context.Context, in GetSessionTokenInpu
 		Expiration:      aws.ToTime(out.Credentials.Expiration).UTC(),
 	}, nil
 }
+
+func (c *RealClient) AssumeRole(ctx context.Context, in AssumeRoleInput) (AssumeRoleOutput, error) {
+	params := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(in.RoleARN),
+		RoleSessionName: aws.String(in.RoleSessionName),
+	}
+	if in.DurationSeconds > 0 {
+		params.DurationSeconds = aws.Int32(in.DurationSeconds)
+	}
+	if in.ExternalID != "" {
+		params.ExternalId = aws.String(in.ExternalID)
+	}
+	if in.SerialNumber != "" {
+		params.SerialNumber = aws.String(in.SerialNumber)
+		params.TokenCode = aws.String(in.TokenCode)
+	}
+	for _, t := range in.Tags {
+		params.Tags = append(params.Tags, types.Tag{Key: aws.String(t.Key), Value: aws.String(t.Value)})
+	}
+	params.TransitiveTagKeys = in.TransitiveTagKeys
+	if in.SourceIdentity != "" {
+		params.SourceIdentity = aws.String(in.SourceIdentity)
+	}
+	if in.Policy != "" {
+		params.Policy = aws.String(in.Policy)
+	}
+	params.PolicyArns = policyDescriptors(in.PolicyARNs)
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.AssumeRole(ctx, params)
+	if err != nil {
+		return AssumeRoleOutput{}, classify("assume-role", err)
+	}
+	if out.Credentials == nil {
+		return AssumeRoleOutput{}, fmt.Errorf("sts assume-role: no credentials in response")
+	}
+	return AssumeRoleOutput{
+		AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(out.Credentials.SessionToken),
+		Expiration:      aws.ToTime(out.Credentials.Expiration).UTC(),
+		AssumedRoleARN:  assumedRoleARN(out.AssumedRoleUser),
+	}, nil
+}
+
+func (c *RealClient) AssumeRoleWithWebIdentity(ctx context.Context, in AssumeRoleWithWebIdentityInput) (AssumeRoleOutput, error) {
+	params := &sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(in.RoleARN),
+		RoleSessionName:  aws.String(in.RoleSessionName),
+		WebIdentityToken: aws.String(in.WebIdentityToken),
+	}
+	if in.DurationSeconds > 0 {
+		params.DurationSeconds = aws.Int32(in.DurationSeconds)
+	}
+	if in.Policy != "" {
+		params.Policy = aws.String(in.Policy)
+	}
+	params.PolicyArns = policyDescriptors(in.PolicyARNs)
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.AssumeRoleWithWebIdentity(ctx, params)
+	if err != nil {
+		return AssumeRoleOutput{}, classify("assume-role-with-web-identity", err)
+	}
+	if out.Credentials == nil {
+		return AssumeRoleOutput{}, fmt.Errorf("sts assume-role-with-web-identity: no credentials in response")
+	}
+	return AssumeRoleOutput{
+		AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(out.Credentials.SessionToken),
+		Expiration:      aws.ToTime(out.Credentials.Expiration).UTC(),
+		AssumedRoleARN:  assumedRoleARN(out.AssumedRoleUser),
+	}, nil
+}
+
+func (c *RealClient) AssumeRoleWithSAML(ctx context.Context, in AssumeRoleWithSAMLInput) (AssumeRoleOutput, error) {
+	params := &sts.AssumeRoleWithSAMLInput{
+		RoleArn:       aws.String(in.RoleARN),
+		PrincipalArn:  aws.String(in.PrincipalARN),
+		SAMLAssertion: aws.String(in.SAMLAssertion),
+	}
+	if in.DurationSeconds > 0 {
+		params.DurationSeconds = aws.Int32(in.DurationSeconds)
+	}
+	if in.Policy != "" {
+		params.Policy = aws.String(in.Policy)
+	}
+	params.PolicyArns = policyDescriptors(in.PolicyARNs)
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.AssumeRoleWithSAML(ctx, params)
+	if err != nil {
+		return AssumeRoleOutput{}, classify("assume-role-with-saml", err)
+	}
+	if out.Credentials == nil {
+		return AssumeRoleOutput{}, fmt.Errorf("sts assume-role-with-saml: no credentials in response")
+	}
+	return AssumeRoleOutput{
+		AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(out.Credentials.SessionToken),
+		Expiration:      aws.ToTime(out.Credentials.Expiration).UTC(),
+		AssumedRoleARN:  assumedRoleARN(out.AssumedRoleUser),
+	}, nil
+}
+
+func (c *RealClient) GetFederationToken(ctx context.Context, in GetFederationTokenInput) (GetFederationTokenOutput, error) {
+	params := &sts.GetFederationTokenInput{
+		Name: aws.String(in.Name),
+	}
+	if in.DurationSeconds > 0 {
+		params.DurationSeconds = aws.Int32(in.DurationSeconds)
+	}
+	if in.Policy != "" {
+		params.Policy = aws.String(in.Policy)
+	}
+	params.PolicyArns = policyDescriptors(in.PolicyARNs)
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.GetFederationToken(ctx, params)
+	if err != nil {
+		return GetFederationTokenOutput{}, classify("get-federation-token", err)
+	}
+	if out.Credentials == nil {
+		return GetFederationTokenOutput{}, fmt.Errorf("sts get-federation-token: no credentials in response")
+	}
+	fedARN := ""
+	if out.FederatedUser != nil {
+		fedARN = aws.ToString(out.FederatedUser.Arn)
+	}
+	return GetFederationTokenOutput{
+		AccessKeyID:      aws.ToString(out.Credentials.AccessKeyId),
+		SecretAccessKey:  aws.ToString(out.Credentials.SecretAccessKey),
+		SessionToken:     aws.ToString(out.Credentials.SessionToken),
+		Expiration:       aws.ToTime(out.Credentials.Expiration).UTC(),
+		FederatedUserARN: fedARN,
+	}, nil
+}
+
+// DecodeAuthorizationMessage decodes the "encoded authorization failure
+// message" of a denied request into its JSON document.
+func (c *RealClient) DecodeAuthorizationMessage(ctx context.Context, encoded string) (string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.DecodeAuthorizationMessage(ctx, &sts.DecodeAuthorizationMessageInput{
+		EncodedMessage: aws.String(encoded),
+	})
+	if err != nil {
+		return "", classify("decode-authorization-message", err)
+	}
+	return aws.ToString(out.DecodedMessage), nil
+}
+
+func (c *RealClient) GetCallerIdentity(ctx context.Context) (CallerIdentity, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	out, err := c.api.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return CallerIdentity{}, classify("get-caller-identity", err)
+	}
+	return CallerIdentity{
+		Account: aws.ToString(out.Account),
+		ARN:     aws.ToString(out.Arn),
+		UserID:  aws.ToString(out.UserId),
+	}, nil
+}
+
+func assumedRoleARN(u *types.AssumedRoleUser) string {
+	if u == nil {
+		return ""
+	}
+	return aws.ToString(u.Arn)
+}
+
+func policyDescriptors(arns []string) []types.PolicyDescriptorType {
+	var out []types.PolicyDescriptorType
+	for _, arn := range arns {
+		out = append(out, types.PolicyDescriptorType{Arn: aws.String(arn)})
+	}
+	return out
+}
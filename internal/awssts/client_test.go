@@ -0,0 +1,216 @@
+package awssts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+func TestRealClientUsesEndpointURL(t *testing.T) {
+	var gotAction string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		gotAction = r.Form.Get("Action")
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(callerIdentityResponse))
+	}))
+	defer srv.Close()
+
+	c, err := NewRealClient(context.Background(), Options{Region: "us-east-1", EndpointURL: srv.URL}, Credentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewRealClient: %v", err)
+	}
+	id, err := c.GetCallerIdentity(context.Background())
+	if err != nil {
+		t.Fatalf("GetCallerIdentity: %v", err)
+	}
+	if gotAction != "GetCallerIdentity" {
+		t.Fatalf("expected GetCallerIdentity action, got %q", gotAction)
+	}
+	if id.Account != "123456789012" || id.ARN != "arn:aws:iam::123456789012:user/alice" {
+		t.Fatalf("unexpected identity: %+v", id)
+	}
+}
+
+const callerIdentityResponse = `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::123456789012:user/alice</Arn>
+    <UserId>AIDAEXAMPLE</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`
+
+const throttlingResponse = `<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <Error><Type>Sender</Type><Code>Throttling</Code><Message>Rate exceeded</Message></Error>
+  <RequestId>test</RequestId>
+</ErrorResponse>`
+
+func noBackoff(t *testing.T) {
+	t.Helper()
+	retryBackoff = zeroBackoff{}
+	t.Cleanup(func() { retryBackoff = nil })
+}
+
+type zeroBackoff struct{}
+
+func (zeroBackoff) BackoffDelay(int, error) (time.Duration, error) { return 0, nil }
+
+func TestRealClientWebIdentityIsUnsigned(t *testing.T) {
+	var gotAuth, gotToken string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		gotAuth = r.Header.Get("Authorization")
+		gotToken = r.Form.Get("WebIdentityToken")
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIA_WEB</AccessKeyId>
+      <SecretAccessKey>SECRET_WEB</SecretAccessKey>
+      <SessionToken>TOKEN_WEB</SessionToken>
+      <Expiration>2026-02-09T12:00:00Z</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::123456789012:assumed-role/ci/runner</Arn>
+      <AssumedRoleId>AROAEXAMPLE:runner</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer srv.Close()
+
+	c, err := NewRealClient(context.Background(), Options{Region: "us-east-1", EndpointURL: srv.URL}, Credentials{})
+	if err != nil {
+		t.Fatalf("NewRealClient: %v", err)
+	}
+	out, err := c.AssumeRoleWithWebIdentity(context.Background(), AssumeRoleWithWebIdentityInput{
+		RoleARN:          "arn:aws:iam::123456789012:role/ci",
+		RoleSessionName:  "runner",
+		WebIdentityToken: "eyJ.JWT.sig",
+	})
+	if err != nil {
+		t.Fatalf("AssumeRoleWithWebIdentity: %v", err)
+	}
+	if gotAuth != "" {
+		t.Fatalf("expected an unsigned request, got Authorization %q", gotAuth)
+	}
+	if gotToken != "eyJ.JWT.sig" || out.AccessKeyID != "ASIA_WEB" || out.AssumedRoleARN != "arn:aws:sts::123456789012:assumed-role/ci/runner" {
+		t.Fatalf("unexpected request/response: token=%q out=%+v", gotToken, out)
+	}
+}
+
+func TestRealClientRetriesThrottling(t *testing.T) {
+	noBackoff(t)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/xml")
+		if requests < 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(throttlingResponse))
+			return
+		}
+		_, _ = w.Write([]byte(callerIdentityResponse))
+	}))
+	defer srv.Close()
+
+	c, err := NewRealClient(context.Background(), Options{Region: "us-east-1", EndpointURL: srv.URL}, Credentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewRealClient: %v", err)
+	}
+	if _, err := c.GetCallerIdentity(context.Background()); err != nil {
+		t.Fatalf("GetCallerIdentity: %v", err)
+	}
+	if requests != 3 {
+		t.Fatalf("expected 3 requests, got %d", requests)
+	}
+}
+
+func TestRealClientThrottlingExhaustsRetries(t *testing.T) {
+	noBackoff(t)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(throttlingResponse))
+	}))
+	defer srv.Close()
+
+	c, err := NewRealClient(context.Background(), Options{Region: "us-east-1", EndpointURL: srv.URL}, Credentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewRealClient: %v", err)
+	}
+	_, err = c.GetCallerIdentity(context.Background())
+	var stsErr *Error
+	if !errors.As(err, &stsErr) || stsErr.Kind != KindThrottled {
+		t.Fatalf("expected throttled error, got %v", err)
+	}
+	if requests != maxAttempts {
+		t.Fatalf("expected %d requests, got %d", maxAttempts, requests)
+	}
+}
+
+func TestRealClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	c, err := NewRealClient(context.Background(), Options{Region: "us-east-1", EndpointURL: srv.URL, Timeout: 50 * time.Millisecond}, Credentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewRealClient: %v", err)
+	}
+	_, err = c.GetCallerIdentity(context.Background())
+	var stsErr *Error
+	if !errors.As(err, &stsErr) || stsErr.Kind != KindNetwork {
+		t.Fatalf("expected network error, got %v", err)
+	}
+}
+
+func TestClientOptionsEndpointSelection(t *testing.T) {
+	resolve := func(opts Options) string {
+		t.Helper()
+		o := sts.Options{Region: opts.Region}
+		clientOptions(opts)(&o)
+		ep, err := sts.NewDefaultEndpointResolver().ResolveEndpoint(o.Region, o.EndpointOptions)
+		if err != nil {
+			t.Fatalf("ResolveEndpoint: %v", err)
+		}
+		return ep.URL
+	}
+
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{Region: "eu-west-1"}, "https://sts.eu-west-1.amazonaws.com"},
+		{Options{Region: "eu-west-1", RegionalEndpoints: "legacy"}, "https://sts.amazonaws.com"},
+		{Options{Region: "af-south-1", RegionalEndpoints: "legacy"}, "https://sts.af-south-1.amazonaws.com"},
+		{Options{Region: "us-east-1", UseFIPSEndpoint: true}, "https://sts-fips.us-east-1.amazonaws.com"},
+		{Options{Region: "us-east-1", UseDualStackEndpoint: true}, "https://sts.us-east-1.api.aws"},
+		{Options{Region: "us-gov-west-1"}, "https://sts.us-gov-west-1.amazonaws.com"},
+		{Options{Region: "cn-north-1", RegionalEndpoints: "legacy"}, "https://sts.cn-north-1.amazonaws.com.cn"},
+	}
+	for _, tt := range tests {
+		if got := resolve(tt.opts); got != tt.want {
+			t.Errorf("%+v: expected %s, got %s", tt.opts, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package awssts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/aws/smithy-go"
+)
+
+// ErrorKind classifies STS failures so callers can react to them (and map
+// them to exit codes) without parsing error strings.
+type ErrorKind int
+
+const (
+	// KindUnknown is any failure not covered by the kinds below.
+	KindUnknown ErrorKind = iota
+	// KindInvalidMFA means the MFA code was wrong, expired or already used.
+	KindInvalidMFA
+	// KindInvalidCredentials means the signing keys are invalid or expired.
+	KindInvalidCredentials
+	// KindAccessDenied means the principal is not allowed to make the call.
+	KindAccessDenied
+	// KindThrottled means STS kept throttling us after all retries.
+	KindThrottled
+	// KindNetwork means STS could not be reached, or the call timed out.
+	KindNetwork
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindInvalidMFA:
+		return "invalid MFA code"
+	case KindInvalidCredentials:
+		return "invalid credentials"
+	case KindAccessDenied:
+		return "access denied"
+	case KindThrottled:
+		return "throttled"
+	case KindNetwork:
+		return "network error"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is returned by RealClient for failed STS calls.
+type Error struct {
+	// Service is the AWS service; empty means STS. Clients for other
+	// services built on this package (see Classify) set it.
+	Service string
+	// Op is the STS operation, for example "get-session-token".
+	Op   string
+	Kind ErrorKind
+	// Code is the STS error code, empty for errors that are not API errors.
+	Code string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	service := e.Service
+	if service == "" {
+		service = "sts"
+	}
+	return fmt.Sprintf("%s %s: %v", service, e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var (
+	invalidCredentialsCodes = map[string]bool{
+		"InvalidClientTokenId":        true,
+		"SignatureDoesNotMatch":       true,
+		"ExpiredToken":                true,
+		"ExpiredTokenException":       true,
+		"InvalidAccessKeyId":          true,
+		"UnrecognizedClientException": true,
+	}
+	throttlingCodes = map[string]bool{
+		"Throttling":               true,
+		"ThrottlingException":      true,
+		"RequestLimitExceeded":     true,
+		"TooManyRequestsException": true,
+	}
+)
+
+// Classify wraps err from an operation of another AWS service, such as IAM,
+// into an *Error, so callers handle it like a failed STS call.
+func Classify(service, op string, err error) error {
+	e := classify(op, err).(*Error)
+	e.Service = service
+	return e
+}
+
+// classify wraps err from an STS operation into an *Error.
+// Context cancellation is wrapped too but keeps KindUnknown, so callers can
+// still detect it with errors.Is(err, context.Canceled).
+func classify(op string, err error) error {
+	e := &Error{Op: op, Err: err}
+
+	var apiErr smithy.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		e.Code = apiErr.ErrorCode()
+		switch {
+		case strings.Contains(apiErr.ErrorMessage(), "MultiFactorAuthentication"):
+			// Wrong and reused codes both come back as AccessDenied with a
+			// MultiFactorAuthentication message.
+			e.Kind = KindInvalidMFA
+		case e.Code == "InvalidAuthenticationCode":
+			// IAM ResyncMFADevice and EnableMFADevice reject wrong codes so.
+			e.Kind = KindInvalidMFA
+		case invalidCredentialsCodes[e.Code]:
+			e.Kind = KindInvalidCredentials
+		case e.Code == "AccessDenied" || e.Code == "AccessDeniedException":
+			e.Kind = KindAccessDenied
+		case throttlingCodes[e.Code]:
+			e.Kind = KindThrottled
+		}
+	case errors.Is(err, context.Canceled):
+	case errors.Is(err, context.DeadlineExceeded):
+		e.Kind = KindNetwork
+	default:
+		var netErr net.Error
+		if errors.As(err, &netErr) {
+			e.Kind = KindNetwork
+		}
+	}
+	return e
+}
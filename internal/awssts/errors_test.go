@@ -0,0 +1,46 @@
+package awssts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{"invalid mfa", &smithy.GenericAPIError{Code: "AccessDenied", Message: "MultiFactorAuthentication failed with invalid MFA one time pass code."}, KindInvalidMFA},
+		{"reused mfa", &smithy.GenericAPIError{Code: "AccessDenied", Message: "MultiFactorAuthentication failed, unable to validate MFA code."}, KindInvalidMFA},
+		{"invalid iam code", &smithy.GenericAPIError{Code: "InvalidAuthenticationCode", Message: "Authentication code for device is not valid."}, KindInvalidMFA},
+		{"invalid key", &smithy.GenericAPIError{Code: "InvalidClientTokenId", Message: "The security token included in the request is invalid."}, KindInvalidCredentials},
+		{"expired token", &smithy.GenericAPIError{Code: "ExpiredToken"}, KindInvalidCredentials},
+		{"access denied", &smithy.GenericAPIError{Code: "AccessDenied", Message: "User is not authorized to perform: sts:AssumeRole"}, KindAccessDenied},
+		{"throttled", &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"}, KindThrottled},
+		{"timeout", fmt.Errorf("send: %w", context.DeadlineExceeded), KindNetwork},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, KindNetwork},
+		{"canceled", fmt.Errorf("send: %w", context.Canceled), KindUnknown},
+		{"other", errors.New("boom"), KindUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify("get-session-token", tt.err)
+			var stsErr *Error
+			if !errors.As(err, &stsErr) {
+				t.Fatalf("expected *Error, got %T", err)
+			}
+			if stsErr.Kind != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, stsErr.Kind)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected the original error to be wrapped")
+			}
+		})
+	}
+}
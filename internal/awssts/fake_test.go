@@ -2,22 +2,60 @@ package awssts
 
 import (
 	"context"
+	"reflect"
 	"testing"
 	"time"
 )
 
 // fakeClient is a small in-package fake used by unit tests in other packages.
 type fakeClient struct {
-	gotInputs []GetSessionTokenInput
-	out       GetSessionTokenOutput
-	err       error
+	gotInputs     []GetSessionTokenInput
+	gotRoleInputs []AssumeRoleInput
+	gotFedInputs  []GetFederationTokenInput
+	gotWebInputs  []AssumeRoleWithWebIdentityInput
+	gotSAMLInputs []AssumeRoleWithSAMLInput
+	out           GetSessionTokenOutput
+	roleOut       AssumeRoleOutput
+	fedOut        GetFederationTokenOutput
+	identity      CallerIdentity
+	err           error
 }
 
+var _ Client = (*fakeClient)(nil)
+
 func (f *fakeClient) GetSessionToken(ctx context.Context, in GetSessionTokenInput) (GetSessionTokenOutput, error) {
 	f.gotInputs = append(f.gotInputs, in)
 	return f.out, f.err
 }
 
+func (f *fakeClient) AssumeRole(ctx context.Context, in AssumeRoleInput) (AssumeRoleOutput, error) {
+	f.gotRoleInputs = append(f.gotRoleInputs, in)
+	return f.roleOut, f.err
+}
+
+func (f *fakeClient) GetFederationToken(ctx context.Context, in GetFederationTokenInput) (GetFederationTokenOutput, error) {
+	f.gotFedInputs = append(f.gotFedInputs, in)
+	return f.fedOut, f.err
+}
+
+func (f *fakeClient) AssumeRoleWithWebIdentity(ctx context.Context, in AssumeRoleWithWebIdentityInput) (AssumeRoleOutput, error) {
+	f.gotWebInputs = append(f.gotWebInputs, in)
+	return f.roleOut, f.err
+}
+
+func (f *fakeClient) AssumeRoleWithSAML(ctx context.Context, in AssumeRoleWithSAMLInput) (AssumeRoleOutput, error) {
+	f.gotSAMLInputs = append(f.gotSAMLInputs, in)
+	return f.roleOut, f.err
+}
+
+func (f *fakeClient) GetCallerIdentity(ctx context.Context) (CallerIdentity, error) {
+	return f.identity, f.err
+}
+
+func (f *fakeClient) DecodeAuthorizationMessage(ctx context.Context, encoded string) (string, error) {
+	return "{}", f.err
+}
+
 func TestFakeClientRecordsInputs(t *testing.T) {
 	f := &fakeClient{
 		out: GetSessionTokenOutput{
@@ -48,3 +86,32 @@ func TestFakeClientRecordsInputs(t *testing.T) {
 		t.Fatalf("expected recorded input %+v, got %+v", in, f.gotInputs[0])
 	}
 }
+
+func TestFakeClientRecordsAssumeRoleInputs(t *testing.T) {
+	f := &fakeClient{
+		roleOut: AssumeRoleOutput{
+			AccessKeyID:    "ASIA_ROLE",
+			AssumedRoleARN: "arn:aws:sts::123456789012:assumed-role/admin/me",
+		},
+	}
+
+	in := AssumeRoleInput{
+		RoleARN:         "arn:aws:iam::123456789012:role/admin",
+		RoleSessionName: "me",
+		SerialNumber:    "arn:aws:iam::123456789012:mfa/me",
+		TokenCode:       "123456",
+		DurationSeconds: 3600,
+		Tags:            []Tag{{Key: "team", Value: "platform"}},
+	}
+
+	out, err := f.AssumeRole(context.Background(), in)
+	if err != nil {
+		t.Fatalf("AssumeRole: %v", err)
+	}
+	if out.AccessKeyID != "ASIA_ROLE" {
+		t.Fatalf("unexpected output: %+v", out)
+	}
+	if len(f.gotRoleInputs) != 1 || !reflect.DeepEqual(f.gotRoleInputs[0], in) {
+		t.Fatalf("expected recorded input %+v, got %+v", in, f.gotRoleInputs)
+	}
+}
@@ -0,0 +1,113 @@
+package awssts
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// NewHTTPClient builds the HTTP client for STS from the proxy and CA bundle
+// options, on top of the SDK's default transport settings and timeouts.
+// Other AWS endpoints reached with the same settings (such as the console
+// federation endpoint) use it too.
+func NewHTTPClient(opts Options) (*awshttp.BuildableClient, error) {
+	proxy, err := proxyFunc(opts.HTTPSProxy, opts.HTTPProxy, opts.NoProxy)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots *x509.CertPool
+	if len(opts.CABundle) > 0 {
+		roots, err = x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(opts.CABundle) {
+			return nil, errors.New("CA bundle contains no PEM certificates")
+		}
+	}
+
+	return awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		tr.Proxy = proxy
+		if roots != nil {
+			if tr.TLSClientConfig == nil {
+				tr.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+			}
+			tr.TLSClientConfig.RootCAs = roots
+		}
+	}), nil
+}
+
+// proxyFunc returns an http.Transport Proxy function that, like
+// http.ProxyFromEnvironment, sends https requests through httpsProxy and http
+// requests through httpProxy, unless their host is a loopback address or
+// matches noProxy. It returns nil (no proxy) when both proxies are empty.
+func proxyFunc(httpsProxy, httpProxy, noProxy string) (func(*http.Request) (*url.URL, error), error) {
+	if httpsProxy == "" && httpProxy == "" {
+		return nil, nil
+	}
+	proxies := map[string]*url.URL{}
+	for scheme, v := range map[string]string{"https": httpsProxy, "http": httpProxy} {
+		if v == "" {
+			continue
+		}
+		u, err := ParseProxyURL(v)
+		if err != nil {
+			return nil, err
+		}
+		proxies[scheme] = u
+	}
+
+	var skip []string
+	for _, v := range strings.Split(noProxy, ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			skip = append(skip, v)
+		}
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		u, ok := proxies[req.URL.Scheme]
+		if !ok {
+			return nil, nil
+		}
+		host := strings.ToLower(req.URL.Hostname())
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return nil, nil
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return nil, nil
+		}
+		for _, s := range skip {
+			if s == "*" || host == strings.TrimPrefix(s, ".") || strings.HasSuffix(host, "."+strings.TrimPrefix(s, ".")) {
+				return nil, nil
+			}
+		}
+		return u, nil
+	}, nil
+}
+
+// ParseProxyURL parses a proxy setting like HTTPS_PROXY. As with Go's
+// http.ProxyFromEnvironment, a bare host[:port] means an http:// proxy.
+func ParseProxyURL(v string) (*url.URL, error) {
+	raw := v
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", v)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+		return u, nil
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: unsupported scheme %s", v, u.Scheme)
+	}
+}
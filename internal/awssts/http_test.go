@@ -0,0 +1,138 @@
+package awssts
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProxyFuncHonorsNoProxy(t *testing.T) {
+	proxy, err := proxyFunc("proxy.internal:3128", "", ".corp.example")
+	if err != nil {
+		t.Fatalf("proxyFunc: %v", err)
+	}
+
+	tests := map[string]string{
+		"https://sts.us-east-1.amazonaws.com/": "http://proxy.internal:3128",
+		"https://sts.corp.example/":            "",
+		"https://corp.example/":                "",
+		"http://localhost:4566/":               "",
+	}
+	checkProxy(t, proxy, tests)
+
+	if _, err := proxyFunc("ftp://proxy.internal", "", ""); err == nil {
+		t.Fatalf("expected error for unsupported proxy scheme")
+	}
+}
+
+func TestProxyFuncPicksProxyBySchemeAndSkipsLoopback(t *testing.T) {
+	proxy, err := proxyFunc("https-proxy.internal:3128", "http://http-proxy.internal:8080", "")
+	if err != nil {
+		t.Fatalf("proxyFunc: %v", err)
+	}
+	checkProxy(t, proxy, map[string]string{
+		"https://sts.us-east-1.amazonaws.com/": "http://https-proxy.internal:3128",
+		"http://sts.internal.example/":         "http://http-proxy.internal:8080",
+		"http://localhost:4566/":               "",
+		"https://localhost:4566/":              "",
+		"http://sts.localhost/":                "",
+		"http://127.0.0.1:4566/":               "",
+		"http://[::1]:4566/":                   "",
+	})
+
+	// Without an HTTP proxy, http endpoints are reached directly.
+	proxy, err = proxyFunc("https-proxy.internal:3128", "", "")
+	if err != nil {
+		t.Fatalf("proxyFunc: %v", err)
+	}
+	checkProxy(t, proxy, map[string]string{
+		"http://sts.internal.example/": "",
+	})
+}
+
+func checkProxy(t *testing.T, proxy func(*http.Request) (*url.URL, error), tests map[string]string) {
+	t.Helper()
+	for target, want := range tests {
+		req, _ := http.NewRequest(http.MethodPost, target, nil)
+		u, err := proxy(req)
+		if err != nil {
+			t.Fatalf("proxy(%s): %v", target, err)
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != want {
+			t.Errorf("proxy(%s) = %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestRealClientTrustsCABundle(t *testing.T) {
+	noBackoff(t)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(callerIdentityResponse))
+	}))
+	defer srv.Close()
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	creds := Credentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"}
+	opts := Options{Region: "us-east-1", EndpointURL: srv.URL, Timeout: 5 * time.Second}
+
+	untrusted, err := NewRealClient(context.Background(), opts, creds)
+	if err != nil {
+		t.Fatalf("NewRealClient: %v", err)
+	}
+	if _, err := untrusted.GetCallerIdentity(context.Background()); err == nil {
+		t.Fatalf("expected TLS error without the CA bundle")
+	}
+
+	opts.CABundle = bundle
+	trusted, err := NewRealClient(context.Background(), opts, creds)
+	if err != nil {
+		t.Fatalf("NewRealClient: %v", err)
+	}
+	if _, err := trusted.GetCallerIdentity(context.Background()); err != nil {
+		t.Fatalf("GetCallerIdentity: %v", err)
+	}
+
+	opts.CABundle = []byte("not a certificate")
+	if _, err := NewRealClient(context.Background(), opts, creds); err == nil {
+		t.Fatalf("expected error for a CA bundle without certificates")
+	}
+}
+
+func TestNewRealClientIgnoresSharedConfig(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "config")
+	if err := os.WriteFile(broken, []byte("[profile broken\nregion ="), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", broken)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", broken)
+	t.Setenv("AWS_PROFILE", "only-in-credentials-file")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("HTTPS_PROXY", "http://127.0.0.1:1")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(callerIdentityResponse))
+	}))
+	defer srv.Close()
+
+	c, err := NewRealClient(context.Background(), Options{Region: "us-east-1", EndpointURL: srv.URL}, Credentials{AccessKeyID: "AKIA", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewRealClient: %v", err)
+	}
+	if _, err := c.GetCallerIdentity(context.Background()); err != nil {
+		t.Fatalf("GetCallerIdentity: %v", err)
+	}
+}
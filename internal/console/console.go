@@ -0,0 +1,117 @@
+// Package console turns temporary credentials into an AWS Management Console
+// sign-in URL using the federation endpoint.
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+)
+
+// Issuer is reported to the federation endpoint as the sign-in link's origin.
+const Issuer = "aws-mfa-go"
+
+// partitionEndpoints maps a partition to its federation endpoint and console URL.
+var partitionEndpoints = map[string][2]string{
+	"aws":        {"https://signin.aws.amazon.com/federation", "https://console.aws.amazon.com/"},
+	"aws-us-gov": {"https://signin.amazonaws-us-gov.com/federation", "https://console.amazonaws-us-gov.com/"},
+	"aws-cn":     {"https://signin.amazonaws.cn/federation", "https://console.amazonaws.cn/"},
+}
+
+// DefaultEndpoints returns the federation endpoint and console URL of a
+// partition, falling back to the aws partition.
+func DefaultEndpoints(partition string) (federationURL, consoleURL string) {
+	e, ok := partitionEndpoints[partition]
+	if !ok {
+		e = partitionEndpoints["aws"]
+	}
+	return e[0], e[1]
+}
+
+// HTTPClient is the subset of *http.Client the package needs.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// SigninToken exchanges temporary credentials (from AssumeRole or
+// GetFederationToken; GetSessionToken credentials are rejected by AWS) for a
+// sign-in token at federationURL.
+func SigninToken(ctx context.Context, client HTTPClient, federationURL string, creds awssts.Credentials) (string, error) {
+	if creds.SessionToken == "" {
+		return "", errors.New("console sign-in requires temporary credentials")
+	}
+	session, err := json.Marshal(map[string]string{
+		"sessionId":    creds.AccessKeyID,
+		"sessionKey":   creds.SecretAccessKey,
+		"sessionToken": creds.SessionToken,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("Action", "getSigninToken")
+	q.Set("Session", string(session))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, federationURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("federation getSigninToken: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("federation getSigninToken: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("federation getSigninToken: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("federation getSigninToken: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var out struct {
+		SigninToken string `json:"SigninToken"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil || out.SigninToken == "" {
+		return "", errors.New("federation getSigninToken: no SigninToken in response")
+	}
+	return out.SigninToken, nil
+}
+
+// LoginURL returns the URL that signs the browser in with token and then
+// opens destination.
+func LoginURL(federationURL, token, destination string) string {
+	q := url.Values{}
+	q.Set("Action", "login")
+	q.Set("Issuer", Issuer)
+	q.Set("Destination", destination)
+	q.Set("SigninToken", token)
+	return federationURL + "?" + q.Encode()
+}
+
+// Destination resolves a --destination value against the console URL: a
+// path such as "/ec2/home" (or "ec2/home") is appended, while an absolute
+// https URL is used as is.
+func Destination(consoleURL, dest string) (string, error) {
+	dest = strings.TrimSpace(dest)
+	if dest == "" {
+		return consoleURL, nil
+	}
+	if strings.Contains(dest, "://") {
+		u, err := url.Parse(dest)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return "", fmt.Errorf("invalid destination %q: expected a console path or https URL", dest)
+		}
+		return dest, nil
+	}
+	return strings.TrimSuffix(consoleURL, "/") + "/" + strings.TrimPrefix(dest, "/"), nil
+}
@@ -0,0 +1,92 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/jlis/aws-mfa-go/internal/awssts"
+)
+
+func TestSigninTokenAndLoginURL(t *testing.T) {
+	var gotSession map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("Action") != "getSigninToken" {
+			t.Errorf("unexpected action %q", r.URL.Query().Get("Action"))
+		}
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("Session")), &gotSession); err != nil {
+			t.Errorf("Session is not JSON: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"SigninToken":"TOKEN123"}`))
+	}))
+	defer srv.Close()
+
+	creds := awssts.Credentials{AccessKeyID: "ASIA", SecretAccessKey: "SECRET", SessionToken: "SESSION"}
+	token, err := SigninToken(context.Background(), srv.Client(), srv.URL, creds)
+	if err != nil {
+		t.Fatalf("SigninToken: %v", err)
+	}
+	if token != "TOKEN123" {
+		t.Fatalf("expected TOKEN123, got %q", token)
+	}
+	want := map[string]string{"sessionId": "ASIA", "sessionKey": "SECRET", "sessionToken": "SESSION"}
+	for k, v := range want {
+		if gotSession[k] != v {
+			t.Fatalf("expected session %s=%q, got %q", k, v, gotSession[k])
+		}
+	}
+
+	u, err := url.Parse(LoginURL(srv.URL, token, "https://console.aws.amazon.com/ec2/home"))
+	if err != nil {
+		t.Fatalf("parse login URL: %v", err)
+	}
+	q := u.Query()
+	if q.Get("Action") != "login" || q.Get("SigninToken") != "TOKEN123" || q.Get("Destination") != "https://console.aws.amazon.com/ec2/home" || q.Get("Issuer") != Issuer {
+		t.Fatalf("unexpected login URL query: %v", q)
+	}
+}
+
+func TestSigninTokenRejectsErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	creds := awssts.Credentials{AccessKeyID: "ASIA", SecretAccessKey: "SECRET", SessionToken: "SESSION"}
+	if _, err := SigninToken(context.Background(), srv.Client(), srv.URL, creds); err == nil {
+		t.Fatalf("expected error for a failed request")
+	}
+	creds.SessionToken = ""
+	if _, err := SigninToken(context.Background(), srv.Client(), srv.URL, creds); err == nil {
+		t.Fatalf("expected error for long-term credentials")
+	}
+}
+
+func TestDestination(t *testing.T) {
+	tests := []struct {
+		dest    string
+		want    string
+		wantErr bool
+	}{
+		{"", "https://console.aws.amazon.com/", false},
+		{"/ec2/home?region=eu-west-1", "https://console.aws.amazon.com/ec2/home?region=eu-west-1", false},
+		{"s3/home", "https://console.aws.amazon.com/s3/home", false},
+		{"https://eu-west-1.console.aws.amazon.com/lambda/home", "https://eu-west-1.console.aws.amazon.com/lambda/home", false},
+		{"http://evil.example/", "", true},
+	}
+	for _, tt := range tests {
+		got, err := Destination("https://console.aws.amazon.com/", tt.dest)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Destination(%q): expected error", tt.dest)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Destination(%q) = %q, %v; want %q", tt.dest, got, err, tt.want)
+		}
+	}
+}
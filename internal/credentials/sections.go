@@ -9,6 +9,8 @@ import (
 type SectionNames struct {
 	LongTerm  string
 	ShortTerm string
+	// Session holds the cached MFA session that role credentials are assumed from.
+	Session string
 }
 
 // ComputeSectionNames implements the upstream aws-mfa naming rules.
@@ -17,6 +19,7 @@ type SectionNames struct {
 // - Long-term suffix "none": <profile>
 // - Short-term default / "none": <profile>
 // - Short-term suffix set: <profile>-<suffix>
+// - MFA session (role mode only): <profile>-mfa-session
 func ComputeSectionNames(profile, longTermSuffix, shortTermSuffix string) (SectionNames, error) {
 	profile = strings.TrimSpace(profile)
 	if profile == "" {
@@ -50,5 +53,14 @@ func ComputeSectionNames(profile, longTermSuffix, shortTermSuffix string) (Secti
 		return SectionNames{}, fmt.Errorf("long-term section name %q equals short-term section name %q", longName, shortName)
 	}
 
-	return SectionNames{LongTerm: longName, ShortTerm: shortName}, nil
+	// Session may equal the other names; that only matters in role mode,
+	// where the caller checks it.
+	sessionName := fmt.Sprintf("%s-mfa-session", profile)
+	return SectionNames{LongTerm: longName, ShortTerm: shortName, Session: sessionName}, nil
+}
+
+// HopSectionName names the section caching the n-th (1-based) intermediate
+// role of a role chain whose final credentials are written to shortTerm.
+func HopSectionName(shortTerm string, n int) string {
+	return fmt.Sprintf("%s-hop-%d", shortTerm, n)
 }
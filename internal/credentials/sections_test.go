@@ -34,3 +34,18 @@ func TestComputeSectionNames_EqualRejected(t *testing.T) {
 		t.Fatalf("expected error when long-term and short-term names match")
 	}
 }
+
+func TestComputeSectionNames_Session(t *testing.T) {
+	names, err := ComputeSectionNames("prod", "", "admin")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if names.Session != "prod-mfa-session" {
+		t.Fatalf("session: expected %q, got %q", "prod-mfa-session", names.Session)
+	}
+
+	// Outside role mode the MFA session section is unused, so the name is free.
+	if _, err := ComputeSectionNames("prod", "", "mfa-session"); err != nil {
+		t.Fatalf("expected no error for a short-term section named like the MFA session, got %v", err)
+	}
+}
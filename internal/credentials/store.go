@@ -56,6 +56,17 @@ func Load(path string) (*Store, error) {
 
 func (s *Store) Path() string { return s.path }
 
+// Sections returns the names of the sections in file order.
+func (s *Store) Sections() []string {
+	var names []string
+	for _, name := range s.ini.SectionStrings() {
+		if name != ini.DefaultSection {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 func (s *Store) HasSection(name string) bool {
 	_, err := s.ini.GetSection(name)
 	return err == nil
@@ -141,3 +152,22 @@ func (s *Store) SaveAtomic() error {
 	}
 	return nil
 }
+
+// parentKey records which section a short-term section was derived from.
+const parentKey = "parent_section"
+
+// SetParent records that the credentials in child were obtained using the
+// credentials in parent (for example a role session assumed from an MFA session).
+func (s *Store) SetParent(child, parent string) {
+	if parent == "" {
+		s.DeleteKey(child, parentKey)
+		return
+	}
+	s.Set(child, parentKey, parent)
+}
+
+// Parent returns the section child was derived from, if recorded.
+func (s *Store) Parent(child string) (string, bool) {
+	v, ok := s.Get(child, parentKey)
+	return v, ok && v != ""
+}
@@ -40,3 +40,56 @@ func TestStore_LoadMissing_SaveAtomic(t *testing.T) {
 		t.Fatalf("Get: expected %q ok=true, got %q ok=%v", "ASIA_TEST", v, ok)
 	}
 }
+
+func TestStore_ParentRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "credentials")
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if _, ok := s.Parent("prod"); ok {
+		t.Fatalf("expected no parent before SetParent")
+	}
+
+	s.SetParent("prod", "prod-mfa-session")
+	if err := s.SaveAtomic(); err != nil {
+		t.Fatalf("SaveAtomic: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load (after save): %v", err)
+	}
+	if p, ok := loaded.Parent("prod"); !ok || p != "prod-mfa-session" {
+		t.Fatalf("Parent: expected %q ok=true, got %q ok=%v", "prod-mfa-session", p, ok)
+	}
+
+	loaded.SetParent("prod", "")
+	if _, ok := loaded.Parent("prod"); ok {
+		t.Fatalf("expected parent to be cleared")
+	}
+}
+
+func TestStore_SectionsInFileOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(path, []byte("[prod-long-term]\na = 1\n[default]\nb = 2\n[dev-long-term]\nc = 3\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	got := s.Sections()
+	want := []string{"prod-long-term", "default", "dev-long-term"}
+	if len(got) != len(want) {
+		t.Fatalf("Sections() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Sections() = %v, want %v", got, want)
+		}
+	}
+}
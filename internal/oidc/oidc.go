@@ -0,0 +1,205 @@
+// Package oidc implements the parts of OpenID Connect needed to obtain an ID
+// token interactively: discovery, the OAuth 2.0 device authorization grant
+// (RFC 8628) and refresh tokens.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPClient is the subset of *http.Client the package needs.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client talks to an OpenID provider.
+type Client struct {
+	HTTP HTTPClient
+	// Sleep waits between polls; nil uses a timer that stops when ctx is done.
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// Provider holds the endpoints from the discovery document.
+type Provider struct {
+	Issuer                      string `json:"issuer"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+}
+
+// DeviceAuthorization is the response of the device authorization endpoint.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// Token is the response of the token endpoint.
+type Token struct {
+	IDToken      string `json:"id_token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// Error is an OAuth 2.0 error response.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oidc: %s: %s", e.Code, e.Description)
+	}
+	return "oidc: " + e.Code
+}
+
+// defaultInterval is the RFC 8628 polling interval when the provider sends none.
+const defaultInterval = 5 * time.Second
+
+// Discover fetches the discovery document of issuer.
+func (c Client) Discover(ctx context.Context, issuer string) (Provider, error) {
+	u := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return Provider{}, fmt.Errorf("oidc discovery: %w", err)
+	}
+	var p Provider
+	if err := c.do(req, &p); err != nil {
+		return Provider{}, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if p.TokenEndpoint == "" {
+		return Provider{}, errors.New("oidc discovery: no token_endpoint")
+	}
+	if p.Issuer != "" && strings.TrimSuffix(p.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return Provider{}, fmt.Errorf("oidc discovery: issuer mismatch: configured %s, provider says %s", issuer, p.Issuer)
+	}
+	return p, nil
+}
+
+// StartDeviceAuthorization requests a device code and user code.
+func (c Client) StartDeviceAuthorization(ctx context.Context, p Provider, clientID string, scopes []string) (DeviceAuthorization, error) {
+	if p.DeviceAuthorizationEndpoint == "" {
+		return DeviceAuthorization{}, errors.New("oidc: provider does not support the device authorization grant")
+	}
+	var da DeviceAuthorization
+	err := c.postForm(ctx, p.DeviceAuthorizationEndpoint, url.Values{
+		"client_id": {clientID},
+		"scope":     {strings.Join(scopes, " ")},
+	}, &da)
+	if err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("oidc device authorization: %w", err)
+	}
+	if da.DeviceCode == "" || da.UserCode == "" || da.VerificationURI == "" {
+		return DeviceAuthorization{}, errors.New("oidc device authorization: incomplete response")
+	}
+	return da, nil
+}
+
+// PollToken polls the token endpoint until the user approved (or denied)
+// the device authorization, or it expired.
+func (c Client) PollToken(ctx context.Context, p Provider, clientID string, da DeviceAuthorization) (Token, error) {
+	interval := time.Duration(da.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	form := url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {da.DeviceCode},
+		"client_id":   {clientID},
+	}
+	for {
+		if err := c.sleep(ctx, interval); err != nil {
+			return Token{}, err
+		}
+
+		var tok Token
+		err := c.postForm(ctx, p.TokenEndpoint, form, &tok)
+		var oauthErr *Error
+		switch {
+		case err == nil:
+			return tok, nil
+		case errors.As(err, &oauthErr) && oauthErr.Code == "authorization_pending":
+		case errors.As(err, &oauthErr) && oauthErr.Code == "slow_down":
+			interval += 5 * time.Second
+		default:
+			return Token{}, fmt.Errorf("oidc token: %w", err)
+		}
+	}
+}
+
+// Refresh exchanges a refresh token for new tokens.
+func (c Client) Refresh(ctx context.Context, p Provider, clientID, refreshToken string, scopes []string) (Token, error) {
+	var tok Token
+	err := c.postForm(ctx, p.TokenEndpoint, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {clientID},
+		"scope":         {strings.Join(scopes, " ")},
+	}, &tok)
+	if err != nil {
+		return Token{}, fmt.Errorf("oidc refresh: %w", err)
+	}
+	return tok, nil
+}
+
+func (c Client) postForm(ctx context.Context, endpoint string, form url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req, out)
+}
+
+// do sends req and decodes a JSON response into out, or an OAuth error
+// response into *Error.
+func (c Client) do(req *http.Request, out any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr Error
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Code != "" {
+			return &oauthErr
+		}
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+func (c Client) sleep(ctx context.Context, d time.Duration) error {
+	if c.Sleep != nil {
+		return c.Sleep(ctx, d)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,136 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// mockIdP serves discovery, device authorization and token endpoints.
+// The device flow is approved after pending polls.
+type mockIdP struct {
+	srv     *httptest.Server
+	pending int
+	polls   int
+}
+
+func newMockIdP(t *testing.T, pending int) *mockIdP {
+	t.Helper()
+	m := &mockIdP{pending: pending}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                        m.srv.URL,
+			"device_authorization_endpoint": m.srv.URL + "/device",
+			"token_endpoint":                m.srv.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "cli" || r.FormValue("scope") != "openid offline_access" {
+			t.Errorf("unexpected device request: %v", r.Form)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"device_code": "DEV", "user_code": "ABCD-EFGH",
+			"verification_uri": m.srv.URL + "/activate", "expires_in": 600, "interval": 1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("grant_type") {
+		case "urn:ietf:params:oauth:grant-type:device_code":
+			m.polls++
+			if m.polls <= m.pending {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "authorization_pending"})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"id_token": "ID1", "refresh_token": "R1"})
+		case "refresh_token":
+			if r.FormValue("refresh_token") != "R1" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"id_token": "ID2"})
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		}
+	})
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestDeviceFlow(t *testing.T) {
+	idp := newMockIdP(t, 2)
+	var slept []time.Duration
+	c := Client{HTTP: idp.srv.Client(), Sleep: func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}}
+	ctx := context.Background()
+
+	p, err := c.Discover(ctx, idp.srv.URL+"/")
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	da, err := c.StartDeviceAuthorization(ctx, p, "cli", []string{"openid", "offline_access"})
+	if err != nil {
+		t.Fatalf("StartDeviceAuthorization: %v", err)
+	}
+	if da.UserCode != "ABCD-EFGH" {
+		t.Fatalf("unexpected user code %q", da.UserCode)
+	}
+	tok, err := c.PollToken(ctx, p, "cli", da)
+	if err != nil {
+		t.Fatalf("PollToken: %v", err)
+	}
+	if tok.IDToken != "ID1" || tok.RefreshToken != "R1" {
+		t.Fatalf("unexpected token %+v", tok)
+	}
+	if idp.polls != 3 || len(slept) != 3 || slept[0] != time.Second {
+		t.Fatalf("expected 3 polls one second apart, got polls=%d slept=%v", idp.polls, slept)
+	}
+
+	tok, err = c.Refresh(ctx, p, "cli", "R1", []string{"openid"})
+	if err != nil || tok.IDToken != "ID2" {
+		t.Fatalf("Refresh: %+v, %v", tok, err)
+	}
+	_, err = c.Refresh(ctx, p, "cli", "stale", []string{"openid"})
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+		t.Fatalf("expected invalid_grant, got %v", err)
+	}
+}
+
+func TestPollTokenStopsOnDenial(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "access_denied", "error_description": "user declined"})
+	}))
+	defer srv.Close()
+
+	c := Client{HTTP: srv.Client(), Sleep: func(context.Context, time.Duration) error { return nil }}
+	_, err := c.PollToken(context.Background(), Provider{TokenEndpoint: srv.URL}, "cli", DeviceAuthorization{DeviceCode: "DEV"})
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "access_denied" {
+		t.Fatalf("expected access_denied, got %v", err)
+	}
+}
+
+func TestDiscoverRejectsIssuerMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"issuer": "https://other.example", "token_endpoint": "https://other.example/token"})
+	}))
+	defer srv.Close()
+
+	if _, err := (Client{HTTP: srv.Client()}).Discover(context.Background(), srv.URL); err == nil {
+		t.Fatalf("expected error for an issuer mismatch")
+	}
+}
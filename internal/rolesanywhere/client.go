@@ -0,0 +1,226 @@
+// Package rolesanywhere obtains temporary credentials from IAM Roles Anywhere
+// by signing a CreateSession request with an X.509 certificate and its key.
+package rolesanywhere
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPClient is the subset of *http.Client the package needs.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client calls the Roles Anywhere CreateSession API.
+type Client struct {
+	HTTP HTTPClient
+	// Endpoint is the service URL; empty uses the public endpoint of Region.
+	Endpoint string
+	Region   string
+	// Now stamps the request signature; nil uses time.Now.
+	Now func() time.Time
+}
+
+// CreateSessionInput are the parameters of CreateSession.
+type CreateSessionInput struct {
+	TrustAnchorARN  string `json:"trustAnchorArn"`
+	ProfileARN      string `json:"profileArn"`
+	RoleARN         string `json:"roleArn"`
+	DurationSeconds int32  `json:"durationSeconds,omitempty"`
+}
+
+// Credentials are the temporary credentials of the session.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// Error is an error response of the service.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rolesanywhere create-session: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Endpoint returns the public endpoint of the service in region.
+func Endpoint(region string) string {
+	if strings.HasPrefix(region, "cn-") {
+		return "https://rolesanywhere." + region + ".amazonaws.com.cn"
+	}
+	return "https://rolesanywhere." + region + ".amazonaws.com"
+}
+
+// RegionFromARN returns the region of a trust anchor (or profile) ARN.
+func RegionFromARN(arn string) (string, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "rolesanywhere" || parts[3] == "" {
+		return "", fmt.Errorf("invalid Roles Anywhere ARN %q", arn)
+	}
+	return parts[3], nil
+}
+
+// CreateSession exchanges the certificate for temporary credentials of the
+// role. chain lists intermediate certificates, if the trust anchor needs them.
+func (c Client) CreateSession(ctx context.Context, in CreateSessionInput, cert *x509.Certificate, chain []*x509.Certificate, signer crypto.Signer) (Credentials, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = Endpoint(c.Region)
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/") + "/sessions")
+	if err != nil {
+		return Credentials{}, fmt.Errorf("rolesanywhere endpoint: %w", err)
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return Credentials{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return Credentials{}, err
+	}
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	if err := sign(req, body, c.Region, now().UTC(), cert, chain, signer); err != nil {
+		return Credentials{}, err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("rolesanywhere create-session: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Credentials{}, fmt.Errorf("rolesanywhere create-session: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(raw, &e)
+		if e.Message == "" {
+			e.Message = strings.TrimSpace(string(raw))
+		}
+		return Credentials{}, &Error{StatusCode: resp.StatusCode, Message: e.Message}
+	}
+
+	var out struct {
+		CredentialSet []struct {
+			Credentials struct {
+				AccessKeyID     string `json:"accessKeyId"`
+				SecretAccessKey string `json:"secretAccessKey"`
+				SessionToken    string `json:"sessionToken"`
+				Expiration      string `json:"expiration"`
+			} `json:"credentials"`
+		} `json:"credentialSet"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return Credentials{}, fmt.Errorf("rolesanywhere create-session: decode response: %w", err)
+	}
+	if len(out.CredentialSet) == 0 {
+		return Credentials{}, errors.New("rolesanywhere create-session: no credentials in response")
+	}
+	cr := out.CredentialSet[0].Credentials
+	exp, err := time.Parse(time.RFC3339, cr.Expiration)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("rolesanywhere create-session: invalid expiration %q", cr.Expiration)
+	}
+	return Credentials{
+		AccessKeyID:     cr.AccessKeyID,
+		SecretAccessKey: cr.SecretAccessKey,
+		SessionToken:    cr.SessionToken,
+		Expiration:      exp.UTC(),
+	}, nil
+}
+
+// sign adds the Roles Anywhere flavour of a SigV4 signature to req: the
+// string to sign is signed with the certificate's key, and the credential is
+// the certificate's serial number.
+func sign(req *http.Request, body []byte, region string, now time.Time, cert *x509.Certificate, chain []*x509.Certificate, signer crypto.Signer) error {
+	var algorithm string
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		algorithm = "AWS4-X509-RSA-SHA256"
+	case *ecdsa.PublicKey:
+		algorithm = "AWS4-X509-ECDSA-SHA256"
+	default:
+		return fmt.Errorf("unsupported key type %T: expected RSA or ECDSA", signer.Public())
+	}
+
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-X509", base64.StdEncoding.EncodeToString(cert.Raw))
+	if len(chain) > 0 {
+		ders := make([]string, len(chain))
+		for i, c := range chain {
+			ders[i] = base64.StdEncoding.EncodeToString(c.Raw)
+		}
+		req.Header.Set("X-Amz-X509-Chain", strings.Join(ders, ","))
+	}
+
+	headers := []string{"content-type", "host", "x-amz-date", "x-amz-x509"}
+	if len(chain) > 0 {
+		headers = append(headers, "x-amz-x509-chain")
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := now.Format("20060102") + "/" + region + "/rolesanywhere/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	digest := sha256.Sum256([]byte(stringToSign))
+	sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("sign rolesanywhere request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, cert.SerialNumber.String(), scope, signedHeaders, hex.EncodeToString(sig)))
+	return nil
+}
@@ -0,0 +1,172 @@
+package rolesanywhere
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeKeyPair writes a self-signed certificate and its key as PEM files.
+func writeKeyPair(t *testing.T, dir, name string) (certPath, keyPath string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(424242),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	certPath = filepath.Join(dir, name+".pem")
+	keyPath = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return certPath, keyPath
+}
+
+func TestCreateSessionSignsWithCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeKeyPair(t, dir, "server")
+	cert, chain, err := LoadCertificate(certPath)
+	if err != nil {
+		t.Fatalf("LoadCertificate: %v", err)
+	}
+	signer, err := LoadSigner(keyPath, cert, KeyOptions{})
+	if err != nil {
+		t.Fatalf("LoadSigner: %v", err)
+	}
+	defer func() { _ = signer.Close() }()
+
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+	var gotBody CreateSessionInput
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &gotBody)
+
+		if r.Method != http.MethodPost || r.URL.Path != "/sessions" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("X-Amz-X509") != base64.StdEncoding.EncodeToString(cert.Raw) {
+			t.Errorf("X-Amz-X509 does not hold the certificate")
+		}
+
+		// Rebuild the string to sign and check the signature with the certificate.
+		const scope = "20260209/eu-west-1/rolesanywhere/aws4_request"
+		wantAuth := "AWS4-X509-ECDSA-SHA256 Credential=424242/" + scope + ", SignedHeaders=content-type;host;x-amz-date;x-amz-x509, Signature="
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, wantAuth) {
+			t.Errorf("Authorization = %q, want prefix %q", auth, wantAuth)
+		}
+		bodyHash := sha256.Sum256(body)
+		canonical := "POST\n/sessions\n\n" +
+			"content-type:application/json\n" +
+			"host:" + r.Host + "\n" +
+			"x-amz-date:20260209T110000Z\n" +
+			"x-amz-x509:" + r.Header.Get("X-Amz-X509") + "\n\n" +
+			"content-type;host;x-amz-date;x-amz-x509\n" +
+			hex.EncodeToString(bodyHash[:])
+		canonicalHash := sha256.Sum256([]byte(canonical))
+		digest := sha256.Sum256([]byte("AWS4-X509-ECDSA-SHA256\n20260209T110000Z\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])))
+		sig, _ := hex.DecodeString(strings.TrimPrefix(auth, wantAuth))
+		if !ecdsa.VerifyASN1(cert.PublicKey.(*ecdsa.PublicKey), digest[:], sig) {
+			t.Errorf("signature does not verify")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"credentialSet":[{"credentials":{"accessKeyId":"ASIA_RA","secretAccessKey":"S","sessionToken":"T","expiration":"2026-02-09T12:00:00Z"}}],"subjectArn":"arn:aws:rolesanywhere:eu-west-1:123456789012:subject/x"}`))
+	}))
+	defer srv.Close()
+
+	c := Client{HTTP: srv.Client(), Endpoint: srv.URL, Region: "eu-west-1", Now: func() time.Time { return now }}
+	in := CreateSessionInput{
+		TrustAnchorARN:  "arn:aws:rolesanywhere:eu-west-1:123456789012:trust-anchor/ta",
+		ProfileARN:      "arn:aws:rolesanywhere:eu-west-1:123456789012:profile/p",
+		RoleARN:         "arn:aws:iam::123456789012:role/lab",
+		DurationSeconds: 3600,
+	}
+	creds, err := c.CreateSession(context.Background(), in, cert, chain, signer)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if !reflect.DeepEqual(gotBody, in) {
+		t.Fatalf("request body = %+v, want %+v", gotBody, in)
+	}
+	if creds.AccessKeyID != "ASIA_RA" || !creds.Expiration.Equal(time.Date(2026, 2, 9, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected credentials: %+v", creds)
+	}
+}
+
+func TestLoadSignerRejectsOtherKey(t *testing.T) {
+	dir := t.TempDir()
+	certPath, _ := writeKeyPair(t, dir, "a")
+	_, otherKey := writeKeyPair(t, dir, "b")
+	cert, _, err := LoadCertificate(certPath)
+	if err != nil {
+		t.Fatalf("LoadCertificate: %v", err)
+	}
+	if _, err := LoadSigner(otherKey, cert, KeyOptions{}); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected a mismatch error, got %v", err)
+	}
+}
+
+func TestParsePKCS11URI(t *testing.T) {
+	pinFile := filepath.Join(t.TempDir(), "pin")
+	if err := os.WriteFile(pinFile, []byte("4321\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	got, err := parsePKCS11URI("pkcs11:token=lab%20hsm;object=server-key;id=%01%02?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=file:" + pinFile)
+	if err != nil {
+		t.Fatalf("parsePKCS11URI: %v", err)
+	}
+	want := pkcs11URI{Token: "lab hsm", Object: "server-key", ID: []byte{1, 2}, ModulePath: "/usr/lib/softhsm/libsofthsm2.so", PIN: "4321"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parsePKCS11URI = %+v, want %+v", got, want)
+	}
+
+	if _, err := parsePKCS11URI("pkcs11:token=lab"); err == nil {
+		t.Fatalf("expected an error without object or id")
+	}
+}
+
+func TestRegionFromARN(t *testing.T) {
+	if r, err := RegionFromARN("arn:aws:rolesanywhere:eu-west-1:123456789012:trust-anchor/ta"); err != nil || r != "eu-west-1" {
+		t.Fatalf("RegionFromARN = %q, %v", r, err)
+	}
+	if _, err := RegionFromARN("arn:aws:iam::123456789012:role/lab"); err == nil {
+		t.Fatalf("expected an error for a non-Roles Anywhere ARN")
+	}
+}
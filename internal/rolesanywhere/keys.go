@@ -0,0 +1,124 @@
+package rolesanywhere
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Signer signs with the certificate's private key. Close releases the
+// PKCS#11 session, if any.
+type Signer interface {
+	crypto.Signer
+	Close() error
+}
+
+// KeyOptions configure how a PKCS#11 key is opened.
+type KeyOptions struct {
+	// PKCS11Module is the PKCS#11 library, unless the URI has a module-path.
+	PKCS11Module string
+	// PIN is the user PIN, unless the URI has a pin-value or pin-source.
+	PIN string
+}
+
+// LoadCertificate reads a PEM file holding the certificate, optionally
+// followed by the intermediate certificates of its chain.
+func LoadCertificate(path string) (*x509.Certificate, []*x509.Certificate, error) {
+	raw, err := os.ReadFile(path) //nolint:gosec // G304: path is user-provided configuration
+	if err != nil {
+		return nil, nil, fmt.Errorf("read certificate: %w", err)
+	}
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(raw); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse certificate %s: %w", path, err)
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, nil, fmt.Errorf("no PEM certificate in %s", path)
+	}
+	return certs[0], certs[1:], nil
+}
+
+// LoadSigner opens the private key of cert: a PEM file (PKCS#8, PKCS#1 or
+// SEC 1), or a key on a token when key is a PKCS#11 URI ("pkcs11:...").
+func LoadSigner(key string, cert *x509.Certificate, opts KeyOptions) (Signer, error) {
+	if strings.HasPrefix(key, "pkcs11:") {
+		uri, err := parsePKCS11URI(key)
+		if err != nil {
+			return nil, err
+		}
+		if uri.ModulePath == "" {
+			uri.ModulePath = opts.PKCS11Module
+		}
+		if uri.PIN == "" {
+			uri.PIN = opts.PIN
+		}
+		if uri.ModulePath == "" {
+			return nil, errors.New("pkcs11 key: missing module: set module-path in the URI or the PKCS#11 module setting")
+		}
+		return openPKCS11Signer(uri, cert.PublicKey)
+	}
+
+	raw, err := os.ReadFile(key) //nolint:gosec // G304: path is user-provided configuration
+	if err != nil {
+		return nil, fmt.Errorf("read private key: %w", err)
+	}
+	block, rest := pem.Decode(raw)
+	for block != nil && !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		block, rest = pem.Decode(rest)
+	}
+	if block == nil {
+		return nil, fmt.Errorf("no PEM private key in %s", key)
+	}
+	if block.Type == "ENCRYPTED PRIVATE KEY" || strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		return nil, fmt.Errorf("private key %s is encrypted, which is not supported", key)
+	}
+	signer, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key %s: %w", key, err)
+	}
+	if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(cert.PublicKey) {
+		return nil, fmt.Errorf("private key %s does not match the certificate", key)
+	}
+	return fileSigner{signer}, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T: expected RSA or ECDSA", k)
+	}
+}
+
+// fileSigner is a key read from a file, which needs no cleanup.
+type fileSigner struct {
+	crypto.Signer
+}
+
+func (fileSigner) Close() error { return nil }
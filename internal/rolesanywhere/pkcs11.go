@@ -0,0 +1,143 @@
+//go:build cgo
+
+package rolesanywhere
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/miekg/pkcs11"
+)
+
+// sha256DigestInfo is the DER prefix of a PKCS #1 v1.5 SHA-256 DigestInfo.
+var sha256DigestInfo = []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+
+// pkcs11Signer signs with a private key that stays on a PKCS#11 token.
+type pkcs11Signer struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	pub     crypto.PublicKey
+}
+
+// openPKCS11Signer loads the module, logs in to the token and finds the
+// private key. pub is the certificate's public key.
+func openPKCS11Signer(uri pkcs11URI, pub crypto.PublicKey) (Signer, error) {
+	ctx := pkcs11.New(uri.ModulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("pkcs11: cannot load module %s", uri.ModulePath)
+	}
+	s := &pkcs11Signer{ctx: ctx, pub: pub}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("pkcs11: initialize %s: %w", uri.ModulePath, err)
+	}
+	if err := s.open(uri); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *pkcs11Signer) open(uri pkcs11URI) error {
+	slots, err := s.ctx.GetSlotList(true)
+	if err != nil {
+		return fmt.Errorf("pkcs11: list slots: %w", err)
+	}
+	slot, found := uint(0), false
+	for _, id := range slots {
+		info, err := s.ctx.GetTokenInfo(id)
+		if err == nil && (uri.Token == "" || info.Label == uri.Token) {
+			slot, found = id, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("pkcs11: no token %q", uri.Token)
+	}
+
+	if s.session, err = s.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION); err != nil {
+		return fmt.Errorf("pkcs11: open session: %w", err)
+	}
+	if uri.PIN != "" {
+		if err := s.ctx.Login(s.session, pkcs11.CKU_USER, uri.PIN); err != nil {
+			return fmt.Errorf("pkcs11: login: %w", err)
+		}
+	}
+
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY)}
+	if uri.Object != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, uri.Object))
+	}
+	if len(uri.ID) > 0 {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, uri.ID))
+	}
+	if err := s.ctx.FindObjectsInit(s.session, template); err != nil {
+		return fmt.Errorf("pkcs11: find key: %w", err)
+	}
+	keys, _, err := s.ctx.FindObjects(s.session, 1)
+	_ = s.ctx.FindObjectsFinal(s.session)
+	if err != nil {
+		return fmt.Errorf("pkcs11: find key: %w", err)
+	}
+	if len(keys) == 0 {
+		return errors.New("pkcs11: private key not found (check object/id and the PIN)")
+	}
+	s.key = keys[0]
+	return nil
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey { return s.pub }
+
+// Sign signs a SHA-256 digest, with PKCS #1 v1.5 for RSA keys and as an
+// ASN.1 signature for ECDSA keys, like the crypto package's keys do.
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, fmt.Errorf("pkcs11: unsupported hash %v", opts.HashFunc())
+	}
+	switch s.pub.(type) {
+	case *rsa.PublicKey:
+		msg := append(append([]byte{}, sha256DigestInfo...), digest...)
+		return s.sign(pkcs11.CKM_RSA_PKCS, msg)
+	case *ecdsa.PublicKey:
+		raw, err := s.sign(pkcs11.CKM_ECDSA, digest)
+		if err != nil {
+			return nil, err
+		}
+		// PKCS#11 returns r || s; Go (and Roles Anywhere) expect ASN.1.
+		half := len(raw) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			new(big.Int).SetBytes(raw[:half]),
+			new(big.Int).SetBytes(raw[half:]),
+		})
+	default:
+		return nil, fmt.Errorf("pkcs11: unsupported key type %T", s.pub)
+	}
+}
+
+func (s *pkcs11Signer) sign(mechanism uint, msg []byte) ([]byte, error) {
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, s.key); err != nil {
+		return nil, fmt.Errorf("pkcs11: sign: %w", err)
+	}
+	sig, err := s.ctx.Sign(s.session, msg)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: sign: %w", err)
+	}
+	return sig, nil
+}
+
+func (s *pkcs11Signer) Close() error {
+	if s.session != 0 {
+		_ = s.ctx.Logout(s.session)
+		_ = s.ctx.CloseSession(s.session)
+	}
+	err := s.ctx.Finalize()
+	s.ctx.Destroy()
+	return err
+}
@@ -0,0 +1,14 @@
+//go:build !cgo
+
+package rolesanywhere
+
+import (
+	"crypto"
+	"errors"
+)
+
+// openPKCS11Signer needs the cgo PKCS#11 bindings, which release builds
+// (CGO_ENABLED=0) do not include.
+func openPKCS11Signer(uri pkcs11URI, pub crypto.PublicKey) (Signer, error) {
+	return nil, errors.New("pkcs11 keys are not supported by this build (it was built without cgo)")
+}
@@ -0,0 +1,75 @@
+package rolesanywhere
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// pkcs11URI holds the RFC 7512 attributes used to find a private key.
+type pkcs11URI struct {
+	Token  string
+	Object string
+	ID     []byte
+	// ModulePath and PIN come from the module-path and pin-value (or
+	// pin-source) query attributes.
+	ModulePath string
+	PIN        string
+}
+
+// parsePKCS11URI parses a PKCS#11 URI such as
+// "pkcs11:token=lab;object=server-key?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234".
+func parsePKCS11URI(v string) (pkcs11URI, error) {
+	rest := strings.TrimPrefix(v, "pkcs11:")
+	path, query, _ := strings.Cut(rest, "?")
+
+	var u pkcs11URI
+	for _, attr := range strings.Split(path, ";") {
+		if attr == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(attr, "=")
+		if !ok {
+			return pkcs11URI{}, fmt.Errorf("invalid pkcs11 URI %q: attribute %q has no value", v, attr)
+		}
+		value, err := url.PathUnescape(raw)
+		if err != nil {
+			return pkcs11URI{}, fmt.Errorf("invalid pkcs11 URI %q: %w", v, err)
+		}
+		switch name {
+		case "token":
+			u.Token = value
+		case "object":
+			u.Object = value
+		case "id":
+			u.ID = []byte(value)
+		}
+	}
+	for _, attr := range strings.Split(query, "&") {
+		if attr == "" {
+			continue
+		}
+		name, raw, _ := strings.Cut(attr, "=")
+		value, err := url.PathUnescape(raw)
+		if err != nil {
+			return pkcs11URI{}, fmt.Errorf("invalid pkcs11 URI %q: %w", v, err)
+		}
+		switch name {
+		case "module-path":
+			u.ModulePath = value
+		case "pin-value":
+			u.PIN = value
+		case "pin-source":
+			pin, err := os.ReadFile(strings.TrimPrefix(value, "file:")) //nolint:gosec // G304: path is user-provided configuration
+			if err != nil {
+				return pkcs11URI{}, fmt.Errorf("read pkcs11 pin-source: %w", err)
+			}
+			u.PIN = strings.TrimSpace(string(pin))
+		}
+	}
+	if u.Object == "" && len(u.ID) == 0 {
+		return pkcs11URI{}, fmt.Errorf("invalid pkcs11 URI %q: set object or id to select the key", v)
+	}
+	return u, nil
+}
@@ -0,0 +1,109 @@
+// Package saml extracts the AWS roles offered in a SAML assertion.
+package saml
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RoleAttribute is the SAML attribute that lists the roles a user may assume,
+// as "role ARN,provider ARN" pairs (in either order).
+const RoleAttribute = "https://aws.amazon.com/SAML/Attributes/Role"
+
+// Role is a role offered in an assertion, with the SAML provider (the
+// principal) that vouches for it.
+type Role struct {
+	RoleARN      string
+	PrincipalARN string
+}
+
+// Normalize trims a base64 SAMLResponse, dropping the line breaks IdPs and
+// helpers often add, and checks that it decodes.
+func Normalize(assertion string) (string, error) {
+	v := strings.Join(strings.Fields(assertion), "")
+	if v == "" {
+		return "", errors.New("saml assertion is empty")
+	}
+	if _, err := base64.StdEncoding.DecodeString(v); err != nil {
+		return "", fmt.Errorf("saml assertion is not base64: %w", err)
+	}
+	return v, nil
+}
+
+// Roles returns the roles offered by a base64 SAMLResponse, in assertion order.
+func Roles(assertion string) ([]Role, error) {
+	v, err := Normalize(assertion)
+	if err != nil {
+		return nil, err
+	}
+	raw, _ := base64.StdEncoding.DecodeString(v)
+
+	var roles []Role
+	seen := map[Role]bool{}
+	dec := xml.NewDecoder(strings.NewReader(string(raw)))
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse saml assertion: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Attribute" || attr(start, "Name") != RoleAttribute {
+			continue
+		}
+		var a struct {
+			Values []string `xml:"AttributeValue"`
+		}
+		if err := dec.DecodeElement(&a, &start); err != nil {
+			return nil, fmt.Errorf("parse saml assertion: %w", err)
+		}
+		for _, value := range a.Values {
+			r, err := parseRole(value)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[r] {
+				seen[r] = true
+				roles = append(roles, r)
+			}
+		}
+	}
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("saml assertion offers no AWS roles (missing %s attribute)", RoleAttribute)
+	}
+	return roles, nil
+}
+
+// parseRole parses a "role ARN,provider ARN" pair.
+func parseRole(value string) (Role, error) {
+	parts := strings.Split(strings.TrimSpace(value), ",")
+	if len(parts) == 2 {
+		a, b := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if isProvider(a) {
+			a, b = b, a
+		}
+		if strings.Contains(a, ":role/") && isProvider(b) {
+			return Role{RoleARN: a, PrincipalARN: b}, nil
+		}
+	}
+	return Role{}, fmt.Errorf("invalid saml role attribute value %q: expected a role ARN and a saml-provider ARN", value)
+}
+
+func isProvider(arn string) bool {
+	return strings.Contains(arn, ":saml-provider/")
+}
+
+func attr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
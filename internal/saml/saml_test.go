@@ -0,0 +1,68 @@
+package saml
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const response = `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">
+  <saml:Assertion>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/RoleSessionName">
+        <saml:AttributeValue>alice@example.com</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">
+        <saml:AttributeValue>arn:aws:iam::111111111111:role/dev,arn:aws:iam::111111111111:saml-provider/corp</saml:AttributeValue>
+        <saml:AttributeValue>arn:aws:iam::222222222222:saml-provider/corp, arn:aws:iam::222222222222:role/admin</saml:AttributeValue>
+        <saml:AttributeValue>arn:aws:iam::111111111111:role/dev,arn:aws:iam::111111111111:saml-provider/corp</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+
+func encode(xml string) string {
+	return base64.StdEncoding.EncodeToString([]byte(xml))
+}
+
+func TestRoles(t *testing.T) {
+	// IdP helpers often wrap the base64 output.
+	enc := encode(response)
+	wrapped := enc[:40] + "\n" + enc[40:] + "\n"
+
+	got, err := Roles(wrapped)
+	if err != nil {
+		t.Fatalf("Roles: %v", err)
+	}
+	want := []Role{
+		{RoleARN: "arn:aws:iam::111111111111:role/dev", PrincipalARN: "arn:aws:iam::111111111111:saml-provider/corp"},
+		{RoleARN: "arn:aws:iam::222222222222:role/admin", PrincipalARN: "arn:aws:iam::222222222222:saml-provider/corp"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Roles = %+v, want %+v", got, want)
+	}
+}
+
+func TestRolesErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		assertion string
+		want      string
+	}{
+		"empty":      {"  \n", "empty"},
+		"not base64": {"<Response/>", "not base64"},
+		"not xml":    {encode("<Response><Attribute"), "parse saml assertion"},
+		"no roles":   {encode(`<Response><Attribute Name="other"><AttributeValue>x</AttributeValue></Attribute></Response>`), "offers no AWS roles"},
+		"bad pair": {
+			encode(`<Response><Attribute Name="https://aws.amazon.com/SAML/Attributes/Role"><AttributeValue>arn:aws:iam::1:role/dev</AttributeValue></Attribute></Response>`),
+			"invalid saml role attribute value",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Roles(tc.assertion)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
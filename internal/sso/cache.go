@@ -0,0 +1,96 @@
+package sso
+
+import (
+	"crypto/sha1" //nolint:gosec // G505: the AWS CLI names cache files by the SHA-1 of the start URL
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cacheTimeLayout is the timestamp layout of the AWS CLI token cache.
+const cacheTimeLayout = "2006-01-02T15:04:05Z"
+
+// CachedToken is an entry of the AWS CLI SSO token cache. The AWS CLI and
+// SDKs read accessToken and expiresAt; the client registration and refresh
+// token let later logins skip the browser.
+type CachedToken struct {
+	StartURL              string `json:"startUrl"`
+	Region                string `json:"region"`
+	AccessToken           string `json:"accessToken"`
+	ExpiresAt             string `json:"expiresAt"`
+	RefreshToken          string `json:"refreshToken,omitempty"`
+	ClientID              string `json:"clientId,omitempty"`
+	ClientSecret          string `json:"clientSecret,omitempty"`
+	RegistrationExpiresAt string `json:"registrationExpiresAt,omitempty"`
+}
+
+// CacheFile returns the cache file of startURL in dir, named like the AWS CLI
+// does for profiles configured with sso_start_url.
+func CacheFile(dir, startURL string) string {
+	sum := sha1.Sum([]byte(startURL)) //nolint:gosec // G401: not used for security
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// LoadToken reads a cache file.
+func LoadToken(path string) (CachedToken, error) {
+	raw, err := os.ReadFile(path) //nolint:gosec // G304: path is derived from user configuration
+	if err != nil {
+		return CachedToken{}, err
+	}
+	var t CachedToken
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return CachedToken{}, fmt.Errorf("parse sso cache %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// SaveToken writes a cache file atomically, readable only by the user.
+func SaveToken(path string, t CachedToken) error {
+	raw, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create sso cache dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".token-*")
+	if err != nil {
+		return fmt.Errorf("write sso cache: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(raw); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write sso cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write sso cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write sso cache: %w", err)
+	}
+	return nil
+}
+
+// FormatTime formats a cache timestamp.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(cacheTimeLayout)
+}
+
+// ParseTime parses a cache timestamp. Older AWS CLI versions wrote a "UTC"
+// suffix instead of "Z".
+func ParseTime(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if strings.HasSuffix(v, "UTC") {
+		v = strings.TrimSuffix(v, "UTC") + "Z"
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parse sso cache time %q: %w", v, err)
+	}
+	return t.UTC(), nil
+}
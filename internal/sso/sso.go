@@ -0,0 +1,231 @@
+// Package sso obtains IAM Identity Center (SSO) role credentials: the SSO OIDC
+// device authorization flow, role credentials from the SSO portal, and the
+// token cache shared with the AWS CLI (~/.aws/sso/cache).
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	ssotypes "github.com/aws/aws-sdk-go-v2/service/sso/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	oidctypes "github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
+)
+
+// Options configure a Client.
+type Options struct {
+	// Region is the sso_region of the profile.
+	Region string
+	// OIDCEndpointURL and PortalEndpointURL override the SSO OIDC and SSO
+	// portal endpoints (for example a local mock).
+	OIDCEndpointURL   string
+	PortalEndpointURL string
+	HTTPClient        aws.HTTPClient
+	// Sleep waits between token polls; nil uses a timer that stops when ctx is done.
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// Client talks to the SSO OIDC and SSO portal services.
+type Client struct {
+	oidc   *ssooidc.Client
+	portal *sso.Client
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+// Registration is a registered public OIDC client.
+type Registration struct {
+	ClientID     string
+	ClientSecret string
+	ExpiresAt    time.Time
+}
+
+// DeviceAuthorization is the result of StartDeviceAuthorization.
+type DeviceAuthorization struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	Interval                time.Duration
+}
+
+// AccessToken is an SSO access token, with the refresh token if one was issued.
+type AccessToken struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// Credentials are role credentials returned by the SSO portal.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// defaultInterval is the polling interval when the service sends none.
+const defaultInterval = 5 * time.Second
+
+// ErrUnauthorized is returned by RoleCredentials when the access token was
+// rejected (for example revoked before its expiration).
+var ErrUnauthorized = errors.New("sso: access token rejected")
+
+// NewClient creates a Client. Neither service needs AWS credentials: calls
+// are authorized by the client registration and the access token.
+func NewClient(opts Options) *Client {
+	cfg := aws.Config{
+		Region:      opts.Region,
+		Credentials: aws.AnonymousCredentials{},
+		HTTPClient:  opts.HTTPClient,
+	}
+	return &Client{
+		oidc: ssooidc.NewFromConfig(cfg, func(o *ssooidc.Options) {
+			if opts.OIDCEndpointURL != "" {
+				o.EndpointResolver = ssooidc.EndpointResolverFromURL(opts.OIDCEndpointURL)
+			}
+		}),
+		portal: sso.NewFromConfig(cfg, func(o *sso.Options) {
+			if opts.PortalEndpointURL != "" {
+				o.EndpointResolver = sso.EndpointResolverFromURL(opts.PortalEndpointURL)
+			}
+		}),
+		sleep: opts.Sleep,
+	}
+}
+
+// Register registers a public client named clientName.
+func (c *Client) Register(ctx context.Context, clientName string) (Registration, error) {
+	out, err := c.oidc.RegisterClient(ctx, &ssooidc.RegisterClientInput{
+		ClientName: aws.String(clientName),
+		ClientType: aws.String("public"),
+	})
+	if err != nil {
+		return Registration{}, fmt.Errorf("sso register client: %w", err)
+	}
+	return Registration{
+		ClientID:     aws.ToString(out.ClientId),
+		ClientSecret: aws.ToString(out.ClientSecret),
+		ExpiresAt:    time.Unix(out.ClientSecretExpiresAt, 0).UTC(),
+	}, nil
+}
+
+// StartDeviceAuthorization requests a device code and user code for startURL.
+func (c *Client) StartDeviceAuthorization(ctx context.Context, reg Registration, startURL string) (DeviceAuthorization, error) {
+	out, err := c.oidc.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     aws.String(reg.ClientID),
+		ClientSecret: aws.String(reg.ClientSecret),
+		StartUrl:     aws.String(startURL),
+	})
+	if err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("sso device authorization: %w", err)
+	}
+	interval := time.Duration(out.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	return DeviceAuthorization{
+		DeviceCode:              aws.ToString(out.DeviceCode),
+		UserCode:                aws.ToString(out.UserCode),
+		VerificationURI:         aws.ToString(out.VerificationUri),
+		VerificationURIComplete: aws.ToString(out.VerificationUriComplete),
+		Interval:                interval,
+	}, nil
+}
+
+// PollToken polls for the access token until the user approved (or denied)
+// the device authorization, or it expired. now stamps the token's expiration.
+func (c *Client) PollToken(ctx context.Context, reg Registration, da DeviceAuthorization, now func() time.Time) (AccessToken, error) {
+	interval := da.Interval
+	for {
+		if err := c.wait(ctx, interval); err != nil {
+			return AccessToken{}, err
+		}
+		out, err := c.oidc.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     aws.String(reg.ClientID),
+			ClientSecret: aws.String(reg.ClientSecret),
+			GrantType:    aws.String("urn:ietf:params:oauth:grant-type:device_code"),
+			DeviceCode:   aws.String(da.DeviceCode),
+		})
+		var pending *oidctypes.AuthorizationPendingException
+		var slowDown *oidctypes.SlowDownException
+		switch {
+		case err == nil:
+			return accessToken(out, now), nil
+		case errors.As(err, &pending):
+		case errors.As(err, &slowDown):
+			interval += 5 * time.Second
+		default:
+			return AccessToken{}, fmt.Errorf("sso create token: %w", err)
+		}
+	}
+}
+
+// Refresh exchanges a refresh token for a new access token.
+func (c *Client) Refresh(ctx context.Context, reg Registration, refreshToken string, now func() time.Time) (AccessToken, error) {
+	out, err := c.oidc.CreateToken(ctx, &ssooidc.CreateTokenInput{
+		ClientId:     aws.String(reg.ClientID),
+		ClientSecret: aws.String(reg.ClientSecret),
+		GrantType:    aws.String("refresh_token"),
+		RefreshToken: aws.String(refreshToken),
+	})
+	if err != nil {
+		return AccessToken{}, fmt.Errorf("sso refresh token: %w", err)
+	}
+	tok := accessToken(out, now)
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = refreshToken
+	}
+	return tok, nil
+}
+
+// RoleCredentials returns credentials for roleName in accountID.
+func (c *Client) RoleCredentials(ctx context.Context, accessToken, accountID, roleName string) (Credentials, error) {
+	out, err := c.portal.GetRoleCredentials(ctx, &sso.GetRoleCredentialsInput{
+		AccessToken: aws.String(accessToken),
+		AccountId:   aws.String(accountID),
+		RoleName:    aws.String(roleName),
+	})
+	if err != nil {
+		var unauthorized *ssotypes.UnauthorizedException
+		if errors.As(err, &unauthorized) {
+			return Credentials{}, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+		}
+		return Credentials{}, fmt.Errorf("sso get role credentials: %w", err)
+	}
+	if out.RoleCredentials == nil {
+		return Credentials{}, errors.New("sso get role credentials: no credentials in response")
+	}
+	rc := out.RoleCredentials
+	return Credentials{
+		AccessKeyID:     aws.ToString(rc.AccessKeyId),
+		SecretAccessKey: aws.ToString(rc.SecretAccessKey),
+		SessionToken:    aws.ToString(rc.SessionToken),
+		Expiration:      time.UnixMilli(rc.Expiration).UTC(),
+	}, nil
+}
+
+func accessToken(out *ssooidc.CreateTokenOutput, now func() time.Time) AccessToken {
+	return AccessToken{
+		AccessToken:  aws.ToString(out.AccessToken),
+		RefreshToken: aws.ToString(out.RefreshToken),
+		ExpiresAt:    now().Add(time.Duration(out.ExpiresIn) * time.Second).UTC(),
+	}
+}
+
+func (c *Client) wait(ctx context.Context, d time.Duration) error {
+	if c.sleep != nil {
+		return c.sleep(ctx, d)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,146 @@
+package sso
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mockSSO serves the SSO OIDC and SSO portal APIs.
+type mockSSO struct {
+	pending  int // CreateToken answers authorization_pending this many times
+	tokens   int
+	revoked  bool
+	gotRoles []string
+}
+
+func (m *mockSSO) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var body map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	switch r.URL.Path {
+	case "/client/register":
+		writeJSON(w, map[string]any{"clientId": "CID", "clientSecret": "SECRET", "clientSecretExpiresAt": 1893456000})
+	case "/device_authorization":
+		writeJSON(w, map[string]any{"deviceCode": "DEV", "userCode": "ABCD-EFGH", "verificationUriComplete": "https://device.sso/?code=ABCD-EFGH", "interval": 1})
+	case "/token":
+		if m.pending > 0 {
+			m.pending--
+			w.Header().Set("X-Amzn-Errortype", "AuthorizationPendingException")
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]any{"error": "authorization_pending"})
+			return
+		}
+		m.tokens++
+		writeJSON(w, map[string]any{"accessToken": "AT", "refreshToken": "RT", "expiresIn": 28800})
+	case "/federation/credentials":
+		if m.revoked || r.Header.Get("X-Amz-Sso_bearer_token") != "AT" {
+			w.Header().Set("X-Amzn-Errortype", "UnauthorizedException")
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSON(w, map[string]any{"message": "Session token not found or invalid"})
+			return
+		}
+		m.gotRoles = append(m.gotRoles, r.URL.Query().Get("account_id")+"/"+r.URL.Query().Get("role_name"))
+		writeJSON(w, map[string]any{"roleCredentials": map[string]any{
+			"accessKeyId": "ASIA_SSO", "secretAccessKey": "S", "sessionToken": "T", "expiration": int64(1770638400000),
+		}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestClient(t *testing.T, m *mockSSO) *Client {
+	t.Helper()
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	return NewClient(Options{
+		Region:            "eu-west-1",
+		OIDCEndpointURL:   srv.URL,
+		PortalEndpointURL: srv.URL,
+		HTTPClient:        srv.Client(),
+		Sleep:             func(context.Context, time.Duration) error { return nil },
+	})
+}
+
+func TestDeviceLoginAndRoleCredentials(t *testing.T) {
+	m := &mockSSO{pending: 2}
+	c := newTestClient(t, m)
+	ctx := context.Background()
+	now := time.Date(2026, 2, 9, 11, 0, 0, 0, time.UTC)
+
+	reg, err := c.Register(ctx, "aws-mfa-go")
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if reg.ClientID != "CID" || reg.ExpiresAt.Year() != 2030 {
+		t.Fatalf("unexpected registration: %+v", reg)
+	}
+	da, err := c.StartDeviceAuthorization(ctx, reg, "https://corp.awsapps.com/start")
+	if err != nil {
+		t.Fatalf("StartDeviceAuthorization: %v", err)
+	}
+	tok, err := c.PollToken(ctx, reg, da, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("PollToken: %v", err)
+	}
+	if tok.AccessToken != "AT" || tok.RefreshToken != "RT" || !tok.ExpiresAt.Equal(now.Add(8*time.Hour)) || m.pending != 0 {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+
+	creds, err := c.RoleCredentials(ctx, tok.AccessToken, "123456789012", "Developer")
+	if err != nil {
+		t.Fatalf("RoleCredentials: %v", err)
+	}
+	if creds.AccessKeyID != "ASIA_SSO" || !creds.Expiration.Equal(time.Date(2026, 2, 9, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected credentials: %+v", creds)
+	}
+	if len(m.gotRoles) != 1 || m.gotRoles[0] != "123456789012/Developer" {
+		t.Fatalf("unexpected role requests: %v", m.gotRoles)
+	}
+
+	m.revoked = true
+	if _, err := c.RoleCredentials(ctx, tok.AccessToken, "123456789012", "Developer"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestTokenCache(t *testing.T) {
+	dir := t.TempDir()
+	// The AWS CLI names the file after the SHA-1 of the start URL.
+	path := CacheFile(dir, "https://my-sso-portal.awsapps.com/start")
+	if filepath.Base(path) != "c7aaaf71fcc8777ae2475525ed049d39fe16c484.json" {
+		t.Fatalf("unexpected cache file name %s", filepath.Base(path))
+	}
+
+	want := CachedToken{
+		StartURL:    "https://my-sso-portal.awsapps.com/start",
+		Region:      "us-east-1",
+		AccessToken: "AT",
+		ExpiresAt:   FormatTime(time.Date(2026, 2, 9, 19, 0, 0, 0, time.UTC)),
+	}
+	if err := SaveToken(path, want); err != nil {
+		t.Fatalf("SaveToken: %v", err)
+	}
+	got, err := LoadToken(path)
+	if err != nil {
+		t.Fatalf("LoadToken: %v", err)
+	}
+	if got != want || got.ExpiresAt != "2026-02-09T19:00:00Z" {
+		t.Fatalf("LoadToken = %+v, want %+v", got, want)
+	}
+
+	for _, v := range []string{"2026-02-09T19:00:00Z", "2026-02-09T19:00:00UTC"} {
+		if ts, err := ParseTime(v); err != nil || !ts.Equal(time.Date(2026, 2, 9, 19, 0, 0, 0, time.UTC)) {
+			t.Fatalf("ParseTime(%q) = %v, %v", v, ts, err)
+		}
+	}
+}